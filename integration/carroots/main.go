@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/campaign"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/env"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/model"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log/v2"
+	_ "github.com/joho/godotenv/autoload"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var logger = logging.Logger("carroots")
+
+const progressID = "task_result"
+
+// Progress records up to which result the roots have been discovered
+type Progress struct {
+	ID            string    `bson:"_id"`
+	LastCreatedAt time.Time `bson:"last_created_at"`
+}
+
+func main() {
+	app := &cli.App{
+		Name: "carroots",
+		Usage: "Record the payload roots found in the CAR header of the pieces retrieved over HTTP, " +
+			"and test them with GraphSync and Bitswap when they differ from the deal label",
+		Action: run,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "requester",
+				Usage:    "Name of the requester to tag the test result",
+				Aliases:  []string{"r"},
+				Required: true,
+			},
+			&cli.DurationFlag{
+				Name:  "since",
+				Usage: "How far back to look at results on the first run",
+				Value: 24 * time.Hour,
+			},
+		},
+	}
+	err := app.Run(os.Args)
+	if err != nil {
+		logger.Fatal(err)
+	}
+}
+
+func run(c *cli.Context) error {
+	ctx := c.Context
+	resultClient, err := mongo.Connect(ctx, options.Client().ApplyURI(env.GetRequiredString(env.ResultMongoURI)))
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to mongo resultDB")
+	}
+	//nolint:errcheck
+	defer resultClient.Disconnect(ctx)
+	resultCollection := resultClient.Database(env.GetRequiredString(env.ResultMongoDatabase)).Collection("task_result")
+
+	dealsClient, err := mongo.Connect(ctx,
+		options.Client().ApplyURI(env.GetRequiredString(env.StatemarketdealsMongoURI)))
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to mongo statemarketdealsDB")
+	}
+	//nolint:errcheck
+	defer dealsClient.Disconnect(ctx)
+	database := dealsClient.Database(env.GetRequiredString(env.StatemarketdealsMongoDatabase))
+	dealCollection := database.Collection("state_market_deals")
+	rootCollection := database.Collection("deal_roots")
+	progressCollection := database.Collection("carroots_progress")
+
+	_, err = rootCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "deal_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "label_matches", Value: 1}}},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to create deal_roots indexes")
+	}
+
+	progress := Progress{ID: progressID, LastCreatedAt: time.Now().Add(-c.Duration("since"))}
+	err = progressCollection.FindOne(ctx, bson.M{"_id": progressID}).Decode(&progress)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return errors.Wrap(err, "failed to get progress")
+	}
+
+	cursor, err := resultCollection.Find(ctx, carRootsFilter(progress.LastCreatedAt),
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return errors.Wrap(err, "failed to query results")
+	}
+	var results []task.Result
+	err = cursor.All(ctx, &results)
+	if err != nil {
+		return errors.Wrap(err, "failed to decode results")
+	}
+	logger.Infow("Results with CAR roots", "count", len(results), "since", progress.LastCreatedAt)
+	if len(results) == 0 {
+		return nil
+	}
+
+	deals, err := findDeals(ctx, dealCollection, results)
+	if err != nil {
+		return err
+	}
+
+	known, err := findRoots(ctx, rootCollection, deals)
+	if err != nil {
+		return err
+	}
+	roots, candidates, mismatches := planRoots(results, deals, known, time.Now())
+
+	if len(candidates) > 0 {
+		queue, err := campaign.NewMongoQueueFromEnv(ctx)
+		if err != nil {
+			return err
+		}
+		pipeline, _, err := campaign.NewPipelineFromEnv(ctx, c.String("requester"), queue)
+		if err != nil {
+			return err
+		}
+		pipeline.Modules = campaign.RootModules
+
+		stats, err := pipeline.Run(ctx, candidates)
+		if err != nil {
+			return errors.Wrap(err, "failed to add tasks")
+		}
+		stats.Log()
+	}
+
+	// The roots are saved once their tasks are queued, so that a failed run schedules them again on the next one
+	for _, root := range roots {
+		_, err = rootCollection.ReplaceOne(ctx, bson.M{"deal_id": root.DealID}, root, options.Replace().SetUpsert(true))
+		if err != nil {
+			return errors.Wrap(err, "failed to save deal root")
+		}
+	}
+
+	logger.Infow("Discovered roots", "results", len(results), "mismatches", mismatches, "scheduled", len(candidates))
+	progress.LastCreatedAt = results[len(results)-1].CreatedAt
+	_, err = progressCollection.ReplaceOne(ctx, bson.M{"_id": progressID}, progress, options.Replace().SetUpsert(true))
+	return errors.Wrap(err, "failed to save progress")
+}
+
+// carRootsFilter selects the HTTP results of deals created after since, whose piece started with a CAR header.
+func carRootsFilter(since time.Time) bson.M {
+	return bson.M{
+		"task.module":           task.HTTP,
+		"task.metadata.deal_id": bson.M{"$exists": true},
+		"result.car_roots.0":    bson.M{"$exists": true},
+		"created_at":            bson.M{"$gt": since},
+	}
+}
+
+// findDeals returns the active deals of the results by deal ID.
+func findDeals(ctx context.Context, collection *mongo.Collection, results []task.Result) (
+	map[string]model.DealState, error) {
+	dealIDs := make([]int32, 0, len(results))
+	for _, result := range results {
+		dealID, err := strconv.ParseInt(result.Metadata["deal_id"], 10, 32)
+		if err != nil {
+			logger.Warnw("Invalid deal ID in result metadata", "deal_id", result.Metadata["deal_id"])
+			continue
+		}
+		dealIDs = append(dealIDs, int32(dealID))
+	}
+
+	cursor, err := collection.Find(ctx, bson.M{"deal_id": bson.M{"$in": dealIDs}})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query deals")
+	}
+	var documents []model.DealState
+	err = cursor.All(ctx, &documents)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode deals")
+	}
+
+	deals := make(map[string]model.DealState, len(documents))
+	for _, deal := range documents {
+		deals[strconv.Itoa(int(deal.DealID))] = deal
+	}
+	return deals, nil
+}
+
+// findRoots returns the saved roots of the deals by deal ID.
+func findRoots(ctx context.Context, collection *mongo.Collection, deals map[string]model.DealState) (
+	map[int32]model.DealRoot, error) {
+	dealIDs := make([]int32, 0, len(deals))
+	for _, deal := range deals {
+		dealIDs = append(dealIDs, deal.DealID)
+	}
+
+	cursor, err := collection.Find(ctx, bson.M{"deal_id": bson.M{"$in": dealIDs}})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query deal roots")
+	}
+	var documents []model.DealRoot
+	err = cursor.All(ctx, &documents)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode deal roots")
+	}
+
+	roots := make(map[int32]model.DealRoot, len(documents))
+	for _, root := range documents {
+		roots[root.DealID] = root
+	}
+	return roots, nil
+}
+
+// planRoots returns the roots discovered by the results, in the order of the results, the deals whose label does not
+// match a root that was not known before, to be tested on that root, and the number of mismatches.
+// known holds the saved roots by deal ID and is updated with the discovered ones.
+func planRoots(
+	results []task.Result,
+	deals map[string]model.DealState,
+	known map[int32]model.DealRoot,
+	now time.Time,
+) ([]model.DealRoot, campaign.SliceSource, int) {
+	var roots []model.DealRoot
+	var candidates campaign.SliceSource
+	var mismatches int
+	for _, result := range results {
+		deal, ok := deals[result.Metadata["deal_id"]]
+		if !ok {
+			logger.Debugw("Deal of the result is no longer active", "deal_id", result.Metadata["deal_id"])
+			continue
+		}
+
+		root, err := discoverRoot(result, deal, now)
+		if err != nil {
+			logger.Warnw("Invalid CAR root", "deal_id", deal.DealID, "err", err)
+			continue
+		}
+		roots = append(roots, root)
+		previous := known[deal.DealID]
+		known[deal.DealID] = root
+
+		if root.LabelMatches {
+			continue
+		}
+		mismatches++
+		logger.Warnw("Deal label does not match the CAR root", "deal_id", deal.DealID,
+			"provider", deal.Provider, "label", deal.Label, "root", root.Root)
+
+		// The root has been tested already if it was known before this result
+		if previous.Root == root.Root {
+			continue
+		}
+		candidates = append(candidates, rootCandidate(deal, root))
+	}
+	return roots, candidates, mismatches
+}
+
+// discoverRoot returns the root read by an HTTP retrieval of the piece of the deal.
+func discoverRoot(result task.Result, deal model.DealState, now time.Time) (model.DealRoot, error) {
+	root, err := cid.Decode(result.Result.CARRoots[0])
+	if err != nil {
+		return model.DealRoot{}, errors.Wrap(err, "failed to decode root")
+	}
+
+	return model.DealRoot{
+		DealID:       deal.DealID,
+		Provider:     deal.Provider,
+		PieceCID:     deal.PieceCID,
+		Label:        deal.Label,
+		Root:         root.String(),
+		Roots:        result.Result.CARRoots,
+		LabelMatches: sameCID(deal.Label, root),
+		DiscoveredAt: now,
+	}, nil
+}
+
+// sameCID tells whether the label is the root, ignoring the CID version.
+func sameCID(label string, root cid.Cid) bool {
+	labelCID, err := cid.Decode(label)
+	if err != nil {
+		return false
+	}
+	return labelCID.Prefix().Codec == root.Prefix().Codec && string(labelCID.Hash()) == string(root.Hash())
+}
+
+// rootCandidate tests the root of a deal instead of its label.
+func rootCandidate(deal model.DealState, root model.DealRoot) campaign.Candidate {
+	return campaign.Candidate{
+		Provider:    deal.Provider,
+		Client:      deal.Client,
+		ActivatedAt: model.EpochToTime(deal.SectorStart),
+		PayloadCID:  root.Root,
+		PieceCID:    deal.PieceCID,
+		PieceSize:   deal.PieceSize,
+		Metadata: map[string]string{
+			"deal_id":     strconv.Itoa(int(deal.DealID)),
+			"client":      deal.Client,
+			"root_source": "car_header",
+		},
+	}
+}
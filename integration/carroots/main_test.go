@@ -0,0 +1,111 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/model"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/testutil/bsonmatch"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscoverRoot(t *testing.T) {
+	rootV0 := "QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n"
+	rootV1 := cid.NewCidV1(cid.DagProtobuf, cid.MustParse(rootV0).Hash()).String()
+	deal := model.DealState{DealID: 7, Provider: "f01000", PieceCID: "piece", Label: rootV0}
+	now := time.Now()
+
+	result := task.Result{Result: task.RetrievalResult{CARRoots: []string{rootV1}}}
+	root, err := discoverRoot(result, deal, now)
+	assert.NoError(t, err)
+	assert.Equal(t, model.DealRoot{
+		DealID:       7,
+		Provider:     "f01000",
+		PieceCID:     "piece",
+		Label:        rootV0,
+		Root:         rootV1,
+		Roots:        []string{rootV1},
+		LabelMatches: true,
+		DiscoveredAt: now,
+	}, root)
+
+	deal.Label = "my dataset"
+	root, err = discoverRoot(result, deal, now)
+	assert.NoError(t, err)
+	assert.False(t, root.LabelMatches)
+
+	candidate := rootCandidate(deal, root)
+	assert.Equal(t, rootV1, candidate.PayloadCID)
+	assert.Equal(t, "7", candidate.Key())
+	assert.Equal(t, "car_header", candidate.Metadata["root_source"])
+
+	_, err = discoverRoot(task.Result{Result: task.RetrievalResult{CARRoots: []string{"bad"}}}, deal, now)
+	assert.Error(t, err)
+}
+
+func TestCarRootsFilter(t *testing.T) {
+	since := time.Now().UTC().Truncate(time.Millisecond)
+	result := func(module task.ModuleName, metadata map[string]string, roots []string) task.Result {
+		return task.Result{
+			Task:      task.Task{Module: module, Metadata: metadata},
+			Result:    task.RetrievalResult{Success: true, CARRoots: roots},
+			CreatedAt: since.Add(time.Minute),
+		}
+	}
+	deal := map[string]string{"deal_id": "7"}
+	roots := []string{"bafyroot"}
+
+	for _, tc := range []struct {
+		name    string
+		result  task.Result
+		matched bool
+	}{
+		{"deal with roots", result(task.HTTP, deal, roots), true},
+		{"graphsync", result(task.GraphSync, deal, roots), false},
+		{"no deal", result(task.HTTP, map[string]string{"row": "1"}, roots), false},
+		{"no roots", result(task.HTTP, deal, nil), false},
+	} {
+		matched, err := bsonmatch.Match(tc.result, carRootsFilter(since))
+		assert.NoError(t, err)
+		assert.Equal(t, tc.matched, matched, tc.name)
+	}
+
+	old := result(task.HTTP, deal, roots)
+	old.CreatedAt = since
+	matched, err := bsonmatch.Match(old, carRootsFilter(since))
+	assert.NoError(t, err)
+	assert.False(t, matched)
+}
+
+func TestPlanRoots(t *testing.T) {
+	root := "QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n"
+	deals := map[string]model.DealState{
+		"7": {DealID: 7, Provider: "f01000", Label: "my dataset"},
+		"8": {DealID: 8, Provider: "f01000", Label: root},
+	}
+	result := func(dealID string) task.Result {
+		return task.Result{
+			Task:   task.Task{Metadata: map[string]string{"deal_id": dealID}},
+			Result: task.RetrievalResult{CARRoots: []string{root}},
+		}
+	}
+	results := []task.Result{result("7"), result("7"), result("8"), result("9")}
+	now := time.Now()
+
+	// Nothing is saved until the tasks are queued, so a rerun after a failure schedules the mismatch again
+	for i := 0; i < 2; i++ {
+		roots, candidates, mismatches := planRoots(results, deals, map[int32]model.DealRoot{}, now)
+		assert.Len(t, roots, 3)
+		assert.Equal(t, 2, mismatches)
+		assert.Len(t, candidates, 1)
+		assert.Equal(t, "7", candidates[0].Key())
+	}
+
+	// Once saved, the root is not scheduled again
+	known := map[int32]model.DealRoot{7: {DealID: 7, Root: root}}
+	_, candidates, mismatches := planRoots(results, deals, known, now)
+	assert.Equal(t, 2, mismatches)
+	assert.Empty(t, candidates)
+}
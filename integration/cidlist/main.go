@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/campaign"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/google/uuid"
+	logging "github.com/ipfs/go-log/v2"
+	_ "github.com/joho/godotenv/autoload"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+var logger = logging.Logger("cidlist")
+
+func main() {
+	app := &cli.App{
+		Name:      "cidlist",
+		Usage:     "Send tasks for a list of (provider, payload CID, piece CID) rows read from JSONL or CSV",
+		ArgsUsage: "[file...]",
+		Action:    run,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "format",
+				Usage:   "jsonl or csv, guessed from the file extension if not set, jsonl for stdin",
+				Aliases: []string{"f"},
+			},
+			&cli.StringFlag{
+				Name:     "requester",
+				Usage:    "Name of the requester to tag the test result",
+				Aliases:  []string{"r"},
+				Required: true,
+			},
+			&cli.StringSliceFlag{
+				Name:  "modules",
+				Usage: "Modules to test the rows with, unless a row sets its own",
+				Value: cli.NewStringSlice(string(task.GraphSync), string(task.Bitswap), string(task.HTTP)),
+			},
+			&cli.StringFlag{
+				Name:  "campaign-id",
+				Usage: "Campaign ID to tag the tasks with, a new one is generated if not set",
+			},
+			&cli.BoolFlag{
+				Name:  "wait",
+				Usage: "Wait for the results and print them per row",
+			},
+			&cli.DurationFlag{
+				Name:  "wait-timeout",
+				Usage: "How long to wait for the results",
+				Value: time.Hour,
+			},
+		},
+	}
+	err := app.Run(os.Args)
+	if err != nil {
+		logger.Fatal(err)
+	}
+}
+
+func run(c *cli.Context) error {
+	ctx := c.Context
+	requester := c.String("requester")
+	modules, err := pipelineModules(c.StringSlice("modules"))
+	if err != nil {
+		return err
+	}
+
+	inputs := c.Args().Slice()
+	if len(inputs) == 0 {
+		inputs = []string{"-"}
+	}
+	var rows []Row
+	for _, input := range inputs {
+		inputRows, err := readInput(input, c.String("format"))
+		if err != nil {
+			return err
+		}
+		for i := range inputRows {
+			inputRows[i].Input = input
+		}
+		rows = append(rows, inputRows...)
+	}
+	logger.Infow("Rows read", "count", len(rows))
+
+	queue, err := campaign.NewMongoQueueFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+	pipeline, _, err := campaign.NewPipelineFromEnv(ctx, requester, queue)
+	if err != nil {
+		return err
+	}
+
+	campaignID := c.String("campaign-id")
+	if campaignID == "" {
+		campaignID = uuid.New().String()
+	}
+	pipeline.Modules = modules
+	pipeline.Metadata = map[string]string{"campaign_id": campaignID}
+
+	stats, err := pipeline.Run(ctx, rowSource(rows))
+	if err != nil {
+		return errors.Wrap(err, "failed to add tasks")
+	}
+	logger.Infow("Tasks added", "campaignID", campaignID, "tasks", stats.Tasks, "errors", stats.Results)
+
+	if !c.Bool("wait") {
+		return nil
+	}
+
+	results, err := queue.WaitForResults(ctx, campaign.CampaignResultFilter(requester, campaignID),
+		stats.Tasks+stats.Results, c.Duration("wait-timeout"), 10*time.Second)
+	if err != nil {
+		return err
+	}
+
+	printResults(os.Stdout, rows, results)
+	return nil
+}
+
+func readInput(input string, format string) ([]Row, error) {
+	if format == "" {
+		format = FormatJSONL
+		if strings.EqualFold(filepath.Ext(input), ".csv") {
+			format = FormatCSV
+		}
+	}
+
+	if input == "-" {
+		return ReadRows(os.Stdin, format)
+	}
+
+	file, err := os.Open(input)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open input")
+	}
+	defer file.Close()
+
+	rows, err := ReadRows(file, format)
+	return rows, errors.Wrap(err, input)
+}
+
+// pipelineModules returns the deal modules with the given names, without assuming that the payload CID is a label.
+func pipelineModules(names []string) ([]campaign.Module, error) {
+	var modules []campaign.Module
+	for _, name := range names {
+		found := false
+		for _, module := range campaign.DealModules {
+			if string(module.Name) != name {
+				continue
+			}
+			metadata := make(map[string]string, len(module.Metadata))
+			for k, v := range module.Metadata {
+				if k != "assume_label" {
+					metadata[k] = v
+				}
+			}
+			module.Metadata = metadata
+			modules = append(modules, module)
+			found = true
+		}
+		if !found {
+			return nil, errors.Errorf("unknown module %s", name)
+		}
+	}
+	return modules, nil
+}
+
+// rowSource yields a candidate per row, tagged with its input and line number.
+func rowSource(rows []Row) campaign.Source {
+	return campaign.SourceFunc(func(ctx context.Context, yield func(campaign.Candidate) error) error {
+		for _, row := range rows {
+			err := yield(campaign.Candidate{
+				Provider:   row.Provider,
+				PayloadCID: row.PayloadCID,
+				PieceCID:   row.PieceCID,
+				PieceSize:  row.PieceSize,
+				Modules:    row.Modules,
+				Metadata:   map[string]string{"row": row.ID()},
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+//nolint:forbidigo
+func printResults(w io.Writer, rows []Row, results []task.Result) {
+	perRow := make(map[string][]task.Result)
+	for _, result := range results {
+		perRow[result.Metadata["row"]] = append(perRow[result.Metadata["row"]], result)
+	}
+
+	writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ROW\tPROVIDER\tMODULE\tCID\tSTATUS\tTTFB\tSPEED\tERROR")
+	for _, row := range rows {
+		rowResults := perRow[row.ID()]
+		if len(rowResults) == 0 {
+			fmt.Fprintf(writer, "%s\t%s\t-\t-\tno result\t\t\t\n", row.ID(), row.Provider)
+			continue
+		}
+		for _, result := range rowResults {
+			status := "failed"
+			if result.Result.Success {
+				status = "success"
+			}
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%.0f B/s\t%s\n",
+				row.ID(), row.Provider, result.Module, result.Content.CID, status,
+				result.Result.TTFB, result.Result.Speed, result.Result.ErrorMessage)
+		}
+	}
+	writer.Flush()
+}
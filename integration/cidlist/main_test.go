@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/campaign"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRowsOfSeveralInputs(t *testing.T) {
+	rows := []Row{
+		{Provider: "f01000", PayloadCID: testPayload, Input: "a.jsonl", Line: 1},
+		{Provider: "f02000", PayloadCID: testPayload, Input: "b.jsonl", Line: 1},
+	}
+
+	var keys []string
+	err := rowSource(rows).Candidates(context.Background(), func(candidate campaign.Candidate) error {
+		keys = append(keys, candidate.Metadata["row"])
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.jsonl:1", "b.jsonl:1"}, keys)
+
+	results := []task.Result{
+		{
+			Task:   task.Task{Module: task.Bitswap, Metadata: map[string]string{"row": "a.jsonl:1"}},
+			Result: task.RetrievalResult{Success: true},
+		},
+		{
+			Task:   task.Task{Module: task.Bitswap, Metadata: map[string]string{"row": "b.jsonl:1"}},
+			Result: task.RetrievalResult{ErrorMessage: "not found"},
+		},
+	}
+	var out bytes.Buffer
+	printResults(&out, rows, results)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Contains(t, lines[1], "a.jsonl:1")
+	assert.Contains(t, lines[1], "success")
+	assert.NotContains(t, lines[1], "not found")
+	assert.Contains(t, lines[2], "b.jsonl:1")
+	assert.Contains(t, lines[2], "not found")
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+)
+
+//nolint:gochecknoglobals
+var knownModules = []task.ModuleName{task.GraphSync, task.Bitswap, task.HTTP}
+
+// Row is a content to test. The payload CID is tested with GraphSync and Bitswap, the piece CID with HTTP.
+type Row struct {
+	Provider   string            `json:"provider"`
+	PayloadCID string            `json:"payload_cid"`
+	PieceCID   string            `json:"piece_cid"`
+	PieceSize  uint64            `json:"piece_size"`
+	Modules    []task.ModuleName `json:"modules"`
+	// Input the row was read from and its line there, starting at 1
+	Input string `json:"-"`
+	Line  int    `json:"-"`
+}
+
+// ID identifies the row across all the inputs.
+func (r Row) ID() string {
+	return r.Input + ":" + strconv.Itoa(r.Line)
+}
+
+func (r Row) Validate() error {
+	if r.Provider == "" {
+		return errors.New("provider is required")
+	}
+	if r.PayloadCID == "" && r.PieceCID == "" {
+		return errors.New("payload_cid or piece_cid is required")
+	}
+	for _, c := range []string{r.PayloadCID, r.PieceCID} {
+		if c == "" {
+			continue
+		}
+		if _, err := cid.Decode(c); err != nil {
+			return errors.Wrapf(err, "invalid CID %s", c)
+		}
+	}
+	for _, module := range r.Modules {
+		if !slices.Contains(knownModules, module) {
+			return errors.Errorf("unknown module %s", module)
+		}
+	}
+	return nil
+}
+
+// ReadRows reads and validates the rows of a JSONL or CSV input. CSV inputs need a header naming
+// the columns provider, payload_cid, piece_cid, piece_size and modules, the last three being optional.
+// Multiple modules are separated by ";" in CSV.
+func ReadRows(r io.Reader, format string) ([]Row, error) {
+	var rows []Row
+	var err error
+	switch format {
+	case FormatJSONL:
+		rows, err = readJSONL(r)
+	case FormatCSV:
+		rows, err = readCSV(r)
+	default:
+		return nil, errors.Errorf("unknown format %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		if err := row.Validate(); err != nil {
+			return nil, errors.Wrapf(err, "invalid row at line %d", row.Line)
+		}
+	}
+	return rows, nil
+}
+
+func readJSONL(r io.Reader) ([]Row, error) {
+	var rows []Row
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var row Row
+		if err := json.Unmarshal([]byte(text), &row); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse line %d", line)
+		}
+		row.Line = line
+		rows = append(rows, row)
+	}
+	return rows, errors.Wrap(scanner.Err(), "failed to read input")
+}
+
+func readCSV(r io.Reader) ([]Row, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read header")
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["provider"]; !ok {
+		return nil, errors.New("header has no provider column")
+	}
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var rows []Row
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read record")
+		}
+
+		line, _ := reader.FieldPos(0)
+		row := Row{
+			Provider:   field(record, "provider"),
+			PayloadCID: field(record, "payload_cid"),
+			PieceCID:   field(record, "piece_cid"),
+			Line:       line,
+		}
+		if size := field(record, "piece_size"); size != "" {
+			row.PieceSize, err = strconv.ParseUint(size, 10, 64)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid piece_size at line %d", line)
+			}
+		}
+		if modules := field(record, "modules"); modules != "" {
+			for _, module := range strings.Split(modules, ";") {
+				row.Modules = append(row.Modules, task.ModuleName(strings.TrimSpace(module)))
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
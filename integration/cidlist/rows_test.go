@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testPayload = "bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi"
+	testPiece   = "baga6ea4seaqao7s73y24kcutaosvacpdjgfe5pw76ooefnyqw4ynr3d2y6x2mpq"
+)
+
+func TestReadRowsJSONL(t *testing.T) {
+	input := `{"provider":"f01000","payload_cid":"` + testPayload + `","piece_cid":"` + testPiece + `","piece_size":1024}
+
+{"provider":"f02000","payload_cid":"` + testPayload + `","modules":["bitswap"]}
+`
+	rows, err := ReadRows(strings.NewReader(input), FormatJSONL)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 2)
+	assert.Equal(t, Row{Provider: "f01000", PayloadCID: testPayload, PieceCID: testPiece, PieceSize: 1024, Line: 1}, rows[0])
+	assert.Equal(t, 3, rows[1].Line)
+	assert.Equal(t, []task.ModuleName{task.Bitswap}, rows[1].Modules)
+}
+
+func TestReadRowsCSV(t *testing.T) {
+	input := "provider,payload_cid,piece_cid,piece_size,modules\n" +
+		"f01000," + testPayload + "," + testPiece + ",1024,graphsync;http\n" +
+		"f02000,," + testPiece + ",,\n"
+	rows, err := ReadRows(strings.NewReader(input), FormatCSV)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 2)
+	assert.Equal(t, Row{
+		Provider:   "f01000",
+		PayloadCID: testPayload,
+		PieceCID:   testPiece,
+		PieceSize:  1024,
+		Modules:    []task.ModuleName{task.GraphSync, task.HTTP},
+		Line:       2,
+	}, rows[0])
+	assert.Equal(t, Row{Provider: "f02000", PieceCID: testPiece, Line: 3}, rows[1])
+}
+
+func TestReadRowsInvalid(t *testing.T) {
+	_, err := ReadRows(strings.NewReader(`{"provider":"f01000"}`), FormatJSONL)
+	assert.ErrorContains(t, err, "line 1")
+
+	_, err = ReadRows(strings.NewReader(`{"provider":"f01000","payload_cid":"notacid"}`), FormatJSONL)
+	assert.ErrorContains(t, err, "invalid CID")
+
+	_, err = ReadRows(strings.NewReader("payload_cid\n"+testPayload+"\n"), FormatCSV)
+	assert.ErrorContains(t, err, "no provider column")
+
+	_, err = ReadRows(strings.NewReader("provider,payload_cid,modules\nf01000,"+testPayload+",ftp\n"), FormatCSV)
+	assert.ErrorContains(t, err, "unknown module ftp")
+}
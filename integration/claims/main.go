@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/bcicen/jstream"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/env"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/model"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/model/rpc"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/resolver"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/snapshot"
+	"github.com/filecoin-project/go-address"
+	"github.com/google/uuid"
+	logging "github.com/ipfs/go-log/v2"
+	_ "github.com/joho/godotenv/autoload"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var logger = logging.Logger("claims")
+
+// claimDocument is a claim as stored in the claims collection, with the ingestion run that last saw it
+type claimDocument struct {
+	model.Claim `bson:",inline"`
+	SnapshotRun string `bson:"snapshot_run"`
+}
+
+func main() {
+	ctx := context.Background()
+	err := refresh(ctx)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+// refresh reads all verified registry claims, either from Lotus StateGetAllClaims or from a JSON dump
+// of its result given by CLAIMS_SOURCE or the first argument, and replaces the content of the claims collection.
+func refresh(ctx context.Context) error {
+	// Loads the network profile, which formats the provider and client addresses with its prefix
+	model.GetNetwork()
+	batchSize := env.GetInt(env.ClaimsBatchSize, 1000)
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(env.GetRequiredString(env.StatemarketdealsMongoURI)))
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to mongo")
+	}
+
+	//nolint:errcheck
+	defer client.Disconnect(ctx)
+	collection := client.Database(env.GetRequiredString(env.StatemarketdealsMongoDatabase)).Collection("claims")
+	err = ensureIndexes(ctx, collection)
+	if err != nil {
+		return err
+	}
+
+	source := env.GetString(env.ClaimsSource, "")
+	if len(os.Args) > 1 {
+		source = os.Args[1]
+	}
+
+	runID := uuid.New().String()
+	start := time.Now()
+	count := 0
+	models := make([]mongo.WriteModel, 0, batchSize)
+	flush := func() error {
+		if len(models) == 0 {
+			return nil
+		}
+
+		_, err := collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			return errors.Wrap(err, "failed to write claims into mongo")
+		}
+
+		models = models[:0]
+		logger.With("count", count, "claims_per_second", float64(count)/time.Since(start).Seconds()).
+			Info("wrote batch of claims into mongo")
+		return nil
+	}
+
+	err = readClaims(ctx, source, func(claim model.Claim) error {
+		count++
+		models = append(models, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"claim_id": claim.ClaimID}).
+			SetReplacement(claimDocument{Claim: claim, SnapshotRun: runID}).
+			SetUpsert(true))
+		if len(models) >= batchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = flush()
+	if err != nil {
+		return err
+	}
+
+	// Claims that have not been seen in this run have expired or been removed
+	result, err := collection.DeleteMany(ctx, bson.M{"snapshot_run": bson.M{"$ne": runID}})
+	if err != nil {
+		return errors.Wrap(err, "failed to delete removed claims")
+	}
+
+	logger.With("count", count, "removed", result.DeletedCount, "duration", time.Since(start)).
+		Info("finished ingesting claims into mongo")
+	return nil
+}
+
+func readClaims(ctx context.Context, source string, yield func(model.Claim) error) error {
+	if source != "" {
+		logger.With("source", source).Info("getting claims from dump")
+		claims, err := snapshot.Open(ctx, source, "")
+		if err != nil {
+			return err
+		}
+
+		defer claims.Close()
+		return decodeClaims(claims, yield)
+	}
+
+	lotusClient, err := resolver.NewLotusClient(resolver.LotusEndpointsFromEnv(),
+		env.GetDuration(env.LotusAPITimeout, 30*time.Second))
+	if err != nil {
+		return errors.Wrap(err, "failed to create lotus client")
+	}
+
+	logger.Info("getting claims from lotus")
+	var claims map[string]rpc.Claim
+	err = lotusClient.CallFor(ctx, &claims, "Filecoin.StateGetAllClaims", nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to get claims")
+	}
+
+	for claimID, claim := range claims {
+		document, err := claimDocumentOf(claimID, claim)
+		if err != nil {
+			return err
+		}
+		if err := yield(document); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeClaims streams the claims of a decompressed StateGetAllClaims dump to yield.
+func decodeClaims(r io.Reader, yield func(model.Claim) error) error {
+	jsonDecoder := jstream.NewDecoder(r, 1).EmitKV()
+	for stream := range jsonDecoder.Stream() {
+		keyValuePair, ok := stream.Value.(jstream.KV)
+		if !ok {
+			return errors.New("failed to get key value pair")
+		}
+
+		var claim rpc.Claim
+		err := mapstructure.Decode(keyValuePair.Value, &claim)
+		if err != nil {
+			return errors.Wrap(err, "failed to decode claim")
+		}
+
+		document, err := claimDocumentOf(keyValuePair.Key, claim)
+		if err != nil {
+			return err
+		}
+		if err := yield(document); err != nil {
+			return err
+		}
+	}
+
+	if jsonDecoder.Err() != nil {
+		logger.With("position", jsonDecoder.Pos()).Warn("prematurely reached end of json stream")
+		return errors.Wrap(jsonDecoder.Err(), "failed to decode json further")
+	}
+	return nil
+}
+
+func claimDocumentOf(claimID string, claim rpc.Claim) (model.Claim, error) {
+	id, err := strconv.ParseUint(claimID, 10, 64)
+	if err != nil {
+		return model.Claim{}, errors.Wrap(err, "failed to convert claim id to int")
+	}
+
+	provider, err := address.NewIDAddress(claim.Provider)
+	if err != nil {
+		return model.Claim{}, errors.Wrap(err, "failed to convert provider to address")
+	}
+
+	client, err := address.NewIDAddress(claim.Client)
+	if err != nil {
+		return model.Claim{}, errors.Wrap(err, "failed to convert client to address")
+	}
+
+	return model.Claim{
+		ClaimID:    id,
+		Provider:   provider.String(),
+		Client:     client.String(),
+		PieceCID:   claim.Data.Root,
+		PieceSize:  claim.Size,
+		TermMin:    claim.TermMin,
+		TermMax:    claim.TermMax,
+		TermStart:  claim.TermStart,
+		Expiration: claim.TermStart + claim.TermMax,
+		Sector:     claim.Sector,
+	}, nil
+}
+
+// ensureIndexes creates the indexes used by ingestion and the claim source queries.
+func ensureIndexes(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "claim_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "client", Value: 1}, {Key: "term_start", Value: 1}}},
+		{Keys: bson.D{{Key: "provider", Value: 1}, {Key: "client", Value: 1}, {Key: "piece_cid", Value: 1}}},
+		{Keys: bson.D{{Key: "snapshot_run", Value: 1}}},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to create claims indexes")
+	}
+
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadClaimsFromDump(t *testing.T) {
+	model.SetNetwork(model.Mainnet)
+	var claims []model.Claim
+	err := readClaims(context.Background(), "testdata/claims.json", func(claim model.Claim) error {
+		claims = append(claims, claim)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []model.Claim{
+		{
+			ClaimID:    7,
+			Provider:   "f02000",
+			Client:     "f01000",
+			PieceCID:   "baga6ea4seaqhvtixhcqowbx2jadbnzvhgqbzyc7zyawhyjeqqtbcrzpbkm2fwma",
+			PieceSize:  34359738368,
+			TermMin:    518400,
+			TermMax:    5256000,
+			TermStart:  3000000,
+			Expiration: 8256000,
+			Sector:     42,
+		},
+	}, claims)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/campaign"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/env"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	logging "github.com/ipfs/go-log/v2"
+	_ "github.com/joho/godotenv/autoload"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var logger = logging.Logger("coverage")
+
+// Number of deals drawn per overdue provider to find one that can be tested with all overdue modules
+const dealsPerProvider = 10
+
+const (
+	StatusCovered    = "covered"
+	StatusPending    = "pending"
+	StatusScheduled  = "scheduled"
+	StatusUntestable = "untestable"
+)
+
+// ProviderReport is upserted into coverage_report for each active provider after every run.
+type ProviderReport struct {
+	Provider   string                        `bson:"provider"`
+	Status     string                        `bson:"status"`
+	Overdue    []task.ModuleName             `bson:"overdue,omitempty"`
+	LastTested map[task.ModuleName]time.Time `bson:"last_tested,omitempty"`
+	Reason     string                        `bson:"reason,omitempty"`
+	UpdatedAt  time.Time                     `bson:"updated_at"`
+}
+
+func main() {
+	ctx := context.Background()
+	integration, err := NewCoverageIntegration(ctx)
+	if err != nil {
+		panic(err)
+	}
+
+	interval := env.GetDuration(env.CoverageInterval, time.Hour)
+	for {
+		err := integration.RunOnce(ctx)
+		if err != nil {
+			logger.Error(err)
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+type CoverageIntegration struct {
+	requester        string
+	slas             []campaign.CoverageSLA
+	deps             campaign.Deps
+	pipeline         *campaign.Pipeline
+	reportCollection *mongo.Collection
+}
+
+func NewCoverageIntegration(ctx context.Context) (*CoverageIntegration, error) {
+	slas, err := campaign.ParseCoverageSLAs(env.GetString(env.CoverageSLA, "http=24h"))
+	if err != nil {
+		return nil, err
+	}
+	if len(slas) == 0 {
+		return nil, errors.Errorf("%s is empty", env.CoverageSLA)
+	}
+
+	deps, err := campaign.NewDepsFromEnv(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	requester := env.GetString(env.CoverageRequester, "coverage")
+	pipeline := campaign.NewPipeline(requester, deps.Resolvers.Provider, deps.Resolvers.Location, deps.Queue,
+		deps.Retriever)
+	pipeline.Timeout = env.GetDuration(env.FilplusIntegrationTaskTimeout, 15*time.Second)
+
+	resultClient, err := mongo.Connect(ctx, options.Client().ApplyURI(env.GetRequiredString(env.ResultMongoURI)))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to mongo resultDB")
+	}
+	reportCollection := resultClient.
+		Database(env.GetRequiredString(env.ResultMongoDatabase)).
+		Collection("coverage_report")
+	_, err = reportCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "provider", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create coverage_report index")
+	}
+
+	return &CoverageIntegration{
+		requester:        requester,
+		slas:             slas,
+		deps:             deps,
+		pipeline:         pipeline,
+		reportCollection: reportCollection,
+	}, nil
+}
+
+func (c *CoverageIntegration) RunOnce(ctx context.Context) error {
+	logger.Info("start checking provider coverage")
+	now := time.Now().UTC()
+	providers, err := campaign.GetActiveProviders(ctx, c.deps.MarketDeals, campaign.Filters{})
+	if err != nil {
+		return err
+	}
+
+	var longest time.Duration
+	for _, sla := range c.slas {
+		if sla.Every > longest {
+			longest = sla.Every
+		}
+	}
+
+	lastTested, err := campaign.GetLastTested(ctx, c.deps.Queue.ResultCollection(), now.Add(-longest))
+	if err != nil {
+		return err
+	}
+
+	pending, err := campaign.GetPending(ctx, c.deps.Queue.TaskCollection(), c.requester)
+	if err != nil {
+		return err
+	}
+
+	reports := make(map[string]*ProviderReport, len(providers))
+	var candidates []campaign.Candidate
+	for _, provider := range providers {
+		report := &ProviderReport{
+			Provider:   provider,
+			Status:     StatusCovered,
+			LastTested: lastTested[provider],
+			UpdatedAt:  now,
+		}
+		reports[provider] = report
+
+		overdue := lastTested.Overdue(provider, c.slas, pending, now)
+		if len(overdue) == 0 {
+			if len(pending[provider]) > 0 {
+				report.Status = StatusPending
+			}
+			continue
+		}
+
+		report.Overdue = overdue
+		candidate, ok, reason, err := c.coverageCandidate(ctx, provider, overdue)
+		if err != nil {
+			return err
+		}
+		report.Reason = reason
+		if !ok {
+			report.Status = StatusUntestable
+			continue
+		}
+
+		report.Status = StatusScheduled
+		candidates = append(candidates, candidate)
+	}
+
+	stats, err := c.pipeline.Run(ctx, campaign.SliceSource(candidates))
+	if err != nil {
+		return errors.Wrap(err, "failed to add tasks")
+	}
+
+	for provider, reason := range stats.Untestable {
+		reports[provider].Status = StatusUntestable
+		reports[provider].Reason = reason
+	}
+
+	countPerStatus := make(map[string]int)
+	for _, report := range reports {
+		countPerStatus[report.Status]++
+		if report.Status == StatusUntestable {
+			logger.With("provider", report.Provider, "overdue", report.Overdue, "reason", report.Reason).
+				Warn("provider cannot be tested")
+		}
+		_, err = c.reportCollection.ReplaceOne(ctx, bson.M{"provider": report.Provider}, report,
+			options.Replace().SetUpsert(true))
+		if err != nil {
+			return errors.Wrap(err, "failed to write coverage report")
+		}
+	}
+
+	logger.With("providers", len(providers), "covered", countPerStatus[StatusCovered],
+		"pending", countPerStatus[StatusPending], "scheduled", countPerStatus[StatusScheduled],
+		"untestable", countPerStatus[StatusUntestable], "tasks", stats.Tasks).
+		Info("finished checking provider coverage")
+	return nil
+}
+
+// coverageCandidate draws a few active deals of the provider and picks one to test the overdue modules with.
+// The reason explains which modules cannot be tested, if any.
+func (c *CoverageIntegration) coverageCandidate(
+	ctx context.Context,
+	provider string,
+	overdue []task.ModuleName,
+) (campaign.Candidate, bool, string, error) {
+	source := campaign.NewMarketDealSource(c.deps.MarketDeals, campaign.Filters{Providers: []string{provider}},
+		dealsPerProvider)
+	var deals []campaign.Candidate
+	err := source.Candidates(ctx, func(candidate campaign.Candidate) error {
+		deals = append(deals, candidate)
+		return nil
+	})
+	if err != nil {
+		return campaign.Candidate{}, false, "", err
+	}
+
+	candidate, ok := campaign.CoverageCandidate(deals, overdue)
+	if !ok {
+		return campaign.Candidate{}, false, "no active deal with a CID label", nil
+	}
+
+	var missing []string
+	for _, module := range overdue {
+		if (module == task.GraphSync || module == task.Bitswap) && candidate.PayloadCID == "" {
+			missing = append(missing, string(module))
+		}
+	}
+	if len(missing) == 0 {
+		return candidate, true, "", nil
+	}
+
+	reason := "no deal with a payload CID for " + strings.Join(missing, ",")
+	return candidate, len(missing) < len(overdue), reason, nil
+}
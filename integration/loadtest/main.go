@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/campaign"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/data-preservation-programs/RetrievalBot/worker/stub"
+	"github.com/google/uuid"
+	logging "github.com/ipfs/go-log/v2"
+	_ "github.com/joho/godotenv/autoload"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var logger = logging.Logger("loadtest")
+
+func main() {
+	app := &cli.App{
+		Name: "loadtest",
+		Usage: "Fill the configured queue with synthetic tasks, run in-process stub workers on them " +
+			"and report the claim latency, throughput, result insert latency and lock contention",
+		Action: run,
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:    "tasks",
+				Usage:   "Number of synthetic tasks to queue",
+				Aliases: []string{"n"},
+				Value:   10000,
+			},
+			&cli.IntFlag{
+				Name:    "workers",
+				Usage:   "Number of stub workers polling the queue concurrently",
+				Aliases: []string{"c"},
+				Value:   10,
+			},
+			&cli.IntFlag{
+				Name:  "providers",
+				Usage: "Number of synthetic providers the tasks are spread over",
+				Value: 100,
+			},
+			&cli.IntFlag{
+				Name:  "batch-size",
+				Usage: "Number of tasks inserted at once when filling the queue",
+				Value: 1000,
+			},
+			&cli.StringFlag{
+				Name:  "stub-config",
+				Usage: "Config file of the stub workers, STUB_WORKER_CONFIG if not set",
+			},
+			&cli.DurationFlag{
+				Name:  "poll-interval",
+				Usage: "How long a worker waits after finding no task",
+				Value: 10 * time.Millisecond,
+			},
+			&cli.DurationFlag{
+				Name:  "task-timeout",
+				Usage: "Timeout of the synthetic tasks",
+				Value: 10 * time.Second,
+			},
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Usage: "How long to run the workers before giving up on the remaining tasks",
+				Value: time.Hour,
+			},
+			&cli.BoolFlag{
+				Name:  "keep",
+				Usage: "Keep the remaining tasks and the results of the run instead of deleting them",
+			},
+		},
+	}
+	err := app.Run(os.Args)
+	if err != nil {
+		logger.Fatal(err)
+	}
+}
+
+func run(c *cli.Context) error {
+	ctx := c.Context
+	worker, err := stub.NewWorkerFromEnv()
+	if err != nil {
+		return err
+	}
+	if path := c.String("stub-config"); path != "" {
+		config, err := stub.LoadConfig(path)
+		if err != nil {
+			return err
+		}
+		worker = stub.NewWorker(config)
+	}
+
+	queue, err := campaign.NewMongoQueueFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+	//nolint:errcheck
+	defer queue.TaskCollection().Database().Client().Disconnect(ctx)
+	//nolint:errcheck
+	defer queue.ResultCollection().Database().Client().Disconnect(ctx)
+
+	// Tasks of a run get their own module so that the workers of the deployment and of other runs ignore them
+	module := task.ModuleName("loadtest-" + uuid.New().String())
+	logger.Infow("Starting load test", "module", module)
+	if !c.Bool("keep") {
+		defer cleanup(queue, module)
+	}
+
+	tasks := c.Int("tasks")
+	fillStart := time.Now()
+	err = fill(ctx, queue, module, tasks, c.Int("providers"), c.Int("batch-size"), c.Duration("task-timeout"))
+	if err != nil {
+		return err
+	}
+	fillElapsed := time.Since(fillStart)
+	logger.Infow("Queue filled", "tasks", tasks, "elapsed", fillElapsed)
+
+	recorder := &Recorder{}
+	workers := c.Int("workers")
+	status := NewStatusSampler(queue.TaskCollection().Database())
+	err = status.Start(ctx)
+	if err != nil {
+		logger.With("err", err).Warn("Cannot read serverStatus, lock contention will not be reported")
+	}
+
+	runStart := time.Now()
+	runWorkers(ctx, queue, module, worker, workers, tasks, recorder, c.Duration("poll-interval"), c.Duration("timeout"))
+	elapsed := time.Since(runStart)
+
+	report := recorder.Report(workers, tasks, fillElapsed, elapsed)
+	report.Contention = status.Stop(ctx)
+	report.Print(os.Stdout)
+	return nil
+}
+
+// fill queues the synthetic tasks, spread over the providers, in batches.
+func fill(
+	ctx context.Context,
+	queue *campaign.MongoQueue,
+	module task.ModuleName,
+	count int,
+	providers int,
+	batchSize int,
+	timeout time.Duration,
+) error {
+	now := time.Now().UTC()
+	batch := make([]task.Task, 0, batchSize)
+	for i := 0; i < count; i++ {
+		batch = append(batch, task.Task{
+			Requester: "loadtest",
+			Module:    module,
+			Provider:  task.Provider{ID: fmt.Sprintf("f0%d", 1000+i%providers)},
+			Content:   task.Content{CID: fmt.Sprintf("loadtest-%d", i)},
+			Timeout:   timeout,
+			CreatedAt: now.Add(time.Duration(i)),
+		})
+		if len(batch) == batchSize || i == count-1 {
+			err := queue.AddTasks(ctx, batch)
+			if err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	return nil
+}
+
+// runWorkers polls the queue with the workers until all the tasks are done or the timeout expires.
+func runWorkers(
+	parent context.Context,
+	queue *campaign.MongoQueue,
+	module task.ModuleName,
+	worker task.Worker,
+	workers int,
+	tasks int,
+	recorder *Recorder,
+	pollInterval time.Duration,
+	timeout time.Duration,
+) {
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	done := make(chan struct{}, tasks)
+	config := task.WorkerProcessConfig{
+		TaskCollection:   queue.TaskCollection(),
+		ResultCollection: queue.ResultCollection(),
+		Retriever:        task.Retriever{PublicIP: "127.0.0.1", City: "loadtest"},
+		PollInterval:     pollInterval,
+		TimeoutBuffer:    time.Second,
+		Observer: func(stats task.PollStats) {
+			recorder.Observe(stats)
+			done <- struct{}{}
+		},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		process := task.NewWorkerProcess(module, worker, config)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				err := process.Poll(ctx)
+				if err != nil && ctx.Err() == nil {
+					logger.With("err", err).Error("Poll failed")
+				}
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for completed := 0; completed < tasks; {
+		select {
+		case <-ctx.Done():
+			logger.Warnw("Timed out before all the tasks were done", "completed", completed, "tasks", tasks)
+			completed = tasks
+		case <-done:
+			completed++
+		case <-ticker.C:
+			logger.Infow("Progress", "completed", completed, "tasks", tasks)
+		}
+	}
+	cancel()
+	wg.Wait()
+}
+
+// cleanupFilters selects the tasks and the results of the run. Results keep their task under task.
+func cleanupFilters(module task.ModuleName) (taskFilter bson.M, resultFilter bson.M) {
+	return bson.M{"module": module}, bson.M{"task.module": module}
+}
+
+// cleanup deletes the remaining tasks and the results of the run.
+func cleanup(queue *campaign.MongoQueue, module task.ModuleName) {
+	ctx := context.Background()
+	taskFilter, resultFilter := cleanupFilters(module)
+	for collection, filter := range map[*mongo.Collection]bson.M{
+		queue.TaskCollection():   taskFilter,
+		queue.ResultCollection(): resultFilter,
+	} {
+		deleted, err := collection.DeleteMany(ctx, filter)
+		if err != nil {
+			logger.With("err", errors.Wrap(err, "failed to clean up"), "collection", collection.Name()).Error()
+			continue
+		}
+		logger.Infow("Cleaned up", "collection", collection.Name(), "deleted", deleted.DeletedCount)
+	}
+}
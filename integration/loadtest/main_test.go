@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/testutil/bsonmatch"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanupFilters(t *testing.T) {
+	module := task.ModuleName("loadtest-run")
+	taskFilter, resultFilter := cleanupFilters(module)
+
+	queued := task.Task{Module: module}
+	matched, err := bsonmatch.Match(queued, taskFilter)
+	assert.NoError(t, err)
+	assert.True(t, matched)
+
+	result := task.Result{Task: queued}
+	matched, err = bsonmatch.Match(result, resultFilter)
+	assert.NoError(t, err)
+	assert.True(t, matched)
+
+	other := task.Result{Task: task.Task{Module: task.HTTP}}
+	matched, err = bsonmatch.Match(other, resultFilter)
+	assert.NoError(t, err)
+	assert.False(t, matched)
+}
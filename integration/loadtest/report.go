@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+)
+
+// Recorder collects the stats of the polls of the workers.
+type Recorder struct {
+	mu         sync.Mutex
+	claims     []time.Duration
+	works      []time.Duration
+	inserts    []time.Duration
+	emptyPolls int
+}
+
+func (r *Recorder) Observe(stats task.PollStats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.claims = append(r.claims, stats.Claim)
+	r.works = append(r.works, stats.Work)
+	r.inserts = append(r.inserts, stats.Insert)
+	r.emptyPolls += stats.EmptyPolls
+}
+
+func (r *Recorder) Count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.claims)
+}
+
+// Latency summarizes durations with their percentiles.
+type Latency struct {
+	Count int
+	Mean  time.Duration
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+func Summarize(durations []time.Duration) Latency {
+	if len(durations) == 0 {
+		return Latency{}
+	}
+
+	sorted := make([]time.Duration, len(durations))
+	copy(sorted, durations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+
+	percentile := func(p float64) time.Duration {
+		return sorted[int(p*float64(len(sorted)-1))]
+	}
+	return Latency{
+		Count: len(sorted),
+		Mean:  total / time.Duration(len(sorted)),
+		P50:   percentile(0.5),
+		P90:   percentile(0.9),
+		P99:   percentile(0.99),
+		Max:   sorted[len(sorted)-1],
+	}
+}
+
+// Report is the outcome of a load test.
+type Report struct {
+	Workers int
+	Tasks   int
+	Fill    time.Duration
+	Elapsed time.Duration
+	Claim   Latency
+	Work    Latency
+	Insert  Latency
+	Empty   int
+	Contention
+}
+
+// Contention is read from the serverStatus of the queue database, if allowed.
+type Contention struct {
+	Available bool
+	// Write conflicts retried by the server during the run
+	WriteConflicts int64
+	// Largest number of operations seen waiting for a lock
+	MaxLockQueue int64
+}
+
+func (r *Recorder) Report(workers int, tasks int, fill time.Duration, elapsed time.Duration) Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return Report{
+		Workers: workers,
+		Tasks:   tasks,
+		Fill:    fill,
+		Elapsed: elapsed,
+		Claim:   Summarize(r.claims),
+		Work:    Summarize(r.works),
+		Insert:  Summarize(r.inserts),
+		Empty:   r.emptyPolls,
+	}
+}
+
+func (r Report) Print(w io.Writer) {
+	fmt.Fprintf(w, "workers: %d, tasks: %d, completed: %d\n", r.Workers, r.Tasks, r.Claim.Count)
+	fmt.Fprintf(w, "fill: %s (%.1f tasks/s)\n", r.Fill.Round(time.Millisecond), rate(r.Tasks, r.Fill))
+	fmt.Fprintf(w, "run: %s (%.1f tasks/s)\n", r.Elapsed.Round(time.Millisecond), rate(r.Claim.Count, r.Elapsed))
+	fmt.Fprintf(w, "empty polls: %d\n", r.Empty)
+	if r.Available {
+		fmt.Fprintf(w, "write conflicts: %d, max lock queue: %d\n", r.WriteConflicts, r.MaxLockQueue)
+	} else {
+		fmt.Fprintln(w, "write conflicts and lock queue: serverStatus not available")
+	}
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "\tmean\tp50\tp90\tp99\tmax")
+	for _, row := range []struct {
+		name    string
+		latency Latency
+	}{{"claim", r.Claim}, {"work", r.Work}, {"insert", r.Insert}} {
+		l := row.latency
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\n", row.name, l.Mean, l.P50, l.P90, l.P99, l.Max)
+	}
+	table.Flush()
+}
+
+func rate(count int, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(count) / elapsed.Seconds()
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummarize(t *testing.T) {
+	assert.Equal(t, Latency{}, Summarize(nil))
+
+	var durations []time.Duration
+	for i := 100; i > 0; i-- {
+		durations = append(durations, time.Duration(i)*time.Millisecond)
+	}
+	assert.Equal(t, Latency{
+		Count: 100,
+		Mean:  50500 * time.Microsecond,
+		P50:   50 * time.Millisecond,
+		P90:   90 * time.Millisecond,
+		P99:   99 * time.Millisecond,
+		Max:   100 * time.Millisecond,
+	}, Summarize(durations))
+	assert.Equal(t, 100*time.Millisecond, durations[0])
+}
+
+func TestRecorder(t *testing.T) {
+	recorder := &Recorder{}
+	recorder.Observe(task.PollStats{
+		EmptyPolls: 2,
+		Claim:      time.Millisecond,
+		Work:       time.Second,
+		Insert:     3 * time.Millisecond,
+	})
+	recorder.Observe(task.PollStats{Claim: 3 * time.Millisecond, Work: time.Second, Insert: time.Millisecond})
+	assert.Equal(t, 2, recorder.Count())
+
+	report := recorder.Report(2, 4, time.Second, 2*time.Second)
+	assert.Equal(t, 2, report.Empty)
+	assert.Equal(t, 2*time.Millisecond, report.Claim.Mean)
+	assert.Equal(t, 3*time.Millisecond, report.Insert.Max)
+
+	var out bytes.Buffer
+	report.Print(&out)
+	assert.Contains(t, out.String(), "run: 2s (1.0 tasks/s)")
+	assert.Contains(t, out.String(), "serverStatus not available")
+}
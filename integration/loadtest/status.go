@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// StatusSampler reads the write conflicts and the lock queue from the serverStatus of a database during a run.
+type StatusSampler struct {
+	database  *mongo.Database
+	interval  time.Duration
+	mu        sync.Mutex
+	start     serverStatus
+	maxQueue  int64
+	available bool
+	stop      chan struct{}
+	wg        sync.WaitGroup
+}
+
+type serverStatus struct {
+	GlobalLock struct {
+		CurrentQueue struct {
+			Total int64 `bson:"total"`
+		} `bson:"currentQueue"`
+	} `bson:"globalLock"`
+	Metrics struct {
+		Operation struct {
+			WriteConflicts int64 `bson:"writeConflicts"`
+		} `bson:"operation"`
+	} `bson:"metrics"`
+}
+
+func NewStatusSampler(database *mongo.Database) *StatusSampler {
+	return &StatusSampler{database: database, interval: time.Second, stop: make(chan struct{})}
+}
+
+func (s *StatusSampler) read(ctx context.Context) (serverStatus, error) {
+	var status serverStatus
+	err := s.database.RunCommand(ctx, bson.D{{Key: "serverStatus", Value: 1}}).Decode(&status)
+	return status, errors.Wrap(err, "failed to run serverStatus")
+}
+
+// Start reads the initial status and samples the lock queue until Stop is called.
+func (s *StatusSampler) Start(ctx context.Context) error {
+	start, err := s.read(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.start = start
+	s.maxQueue = start.GlobalLock.CurrentQueue.Total
+	s.available = true
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.sample(ctx)
+			}
+		}
+	}()
+	return nil
+}
+
+func (s *StatusSampler) sample(ctx context.Context) {
+	status, err := s.read(ctx)
+	if err != nil {
+		logger.With("err", err).Debug("Cannot sample serverStatus")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if status.GlobalLock.CurrentQueue.Total > s.maxQueue {
+		s.maxQueue = status.GlobalLock.CurrentQueue.Total
+	}
+}
+
+// Stop returns the contention seen since Start, if the serverStatus could be read.
+func (s *StatusSampler) Stop(ctx context.Context) Contention {
+	if !s.available {
+		return Contention{}
+	}
+
+	close(s.stop)
+	s.wg.Wait()
+	end, err := s.read(ctx)
+	if err != nil {
+		logger.With("err", err).Warn("Cannot read the final serverStatus")
+		return Contention{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if end.GlobalLock.CurrentQueue.Total > s.maxQueue {
+		s.maxQueue = end.GlobalLock.CurrentQueue.Total
+	}
+	return Contention{
+		Available:      true,
+		WriteConflicts: end.Metrics.Operation.WriteConflicts - s.start.Metrics.Operation.WriteConflicts,
+		MaxLockQueue:   s.maxQueue,
+	}
+}
@@ -6,7 +6,7 @@ import (
 	"strconv"
 	"time"
 
-	"github.com/data-preservation-programs/RetrievalBot/integration/filplus/util"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/campaign"
 	"github.com/data-preservation-programs/RetrievalBot/pkg/model"
 	"github.com/data-preservation-programs/RetrievalBot/pkg/model/rpc"
 	"github.com/data-preservation-programs/RetrievalBot/pkg/resolver"
@@ -17,7 +17,6 @@ import (
 	_ "github.com/joho/godotenv/autoload"
 	"github.com/pkg/errors"
 	"github.com/urfave/cli/v2"
-	"github.com/ybbus/jsonrpc/v3"
 )
 
 //nolint:forbidigo,forcetypeassert,exhaustive
@@ -34,34 +33,34 @@ func main() {
 			if err != nil {
 				return errors.Wrap(err, "failed to parse dealID")
 			}
-			providerResolver, err := resolver.NewProviderResolver(
-				"https://api.node.glif.io/rpc/v0",
-				"",
-				time.Minute,
-			)
+			providerResolver, err := resolver.NewProviderResolverFromEnv()
 			if err != nil {
 				return errors.Wrap(err, "failed to create provider resolver")
 			}
 
+			locationResolver := resolver.NewLocationResolver("", time.Minute)
+			err = resolver.EnablePersistentCacheFromEnv(ctx, providerResolver, &locationResolver)
+			if err != nil {
+				return errors.Wrap(err, "failed to enable persistent cache")
+			}
+
 			providerInfo, err := providerResolver.ResolveProvider(ctx, providerID)
 			if err != nil {
 				return errors.Wrap(err, "failed to resolve provider")
 			}
 
-			locationResolver := resolver.NewLocationResolver("", time.Minute)
 			_, err = locationResolver.ResolveMultiaddrsBytes(ctx, providerInfo.Multiaddrs)
 			if err != nil {
 				return errors.Wrap(err, "failed to resolve location")
 			}
 
-			ipInfo, err := resolver.GetPublicIPInfo(ctx, "", "")
+			retriever, err := campaign.NewRetrieverFromEnv(ctx)
 			if err != nil {
-				panic(err)
+				return err
 			}
 
-			lotusClient := jsonrpc.NewClient("https://api.node.glif.io")
 			var deal rpc.Deal
-			err = lotusClient.CallFor(ctx, &deal, "Filecoin.StateMarketStorageDeal", dealID, nil)
+			err = providerResolver.LotusClient().CallFor(ctx, &deal, "Filecoin.StateMarketStorageDeal", dealID, nil)
 			if err != nil {
 				return errors.Wrap(err, "failed to get deal")
 			}
@@ -82,18 +81,21 @@ func main() {
 					LastUpdated: deal.State.LastUpdatedEpoch,
 				},
 			}
-			tasks, results := util.AddTasks(ctx, "oneoff", ipInfo, dealStates, locationResolver, *providerResolver)
-			if len(results) > 0 {
+			queue := &campaign.MemoryQueue{}
+			pipeline := campaign.NewPipeline("oneoff", providerResolver, &locationResolver, queue, retriever)
+			_, err = pipeline.Run(ctx, campaign.DealSource(dealStates))
+			if err != nil {
+				return errors.Wrap(err, "failed to create tasks")
+			}
+			if len(queue.Results) > 0 {
 				fmt.Println("Errors encountered when creating tasks:")
-				for _, result := range results {
-					r := result.(task.Result)
+				for _, r := range queue.Results {
 					fmt.Println(r)
 				}
 			}
-			if len(tasks) > 0 {
+			if len(queue.Tasks) > 0 {
 				fmt.Println("Retrieval Test Results:")
-				for _, tsk := range tasks {
-					t := tsk.(task.Task)
+				for _, t := range queue.Tasks {
 					var result *task.RetrievalResult
 					fmt.Printf(" -- Test %s --\n", t.Module)
 					switch t.Module {
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/convert"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/env"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/model"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/resolver"
+	logging "github.com/ipfs/go-log/v2"
+	_ "github.com/joho/godotenv/autoload"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var logger = logging.Logger("provider-history")
+
+type ChainHead struct {
+	Height int32
+}
+
+func main() {
+	ctx := context.Background()
+	integration, err := NewProviderHistoryIntegration(ctx)
+	if err != nil {
+		panic(err)
+	}
+
+	interval := env.GetDuration(env.ProviderHistoryInterval, time.Hour)
+	for {
+		err := integration.RunOnce(ctx)
+		if err != nil {
+			logger.Error(err)
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+type ProviderHistoryIntegration struct {
+	marketDealsCollection *mongo.Collection
+	providerResolver      *resolver.ProviderResolver
+	history               *resolver.ProviderHistory
+}
+
+func NewProviderHistoryIntegration(ctx context.Context) (*ProviderHistoryIntegration, error) {
+	stateMarketDealsClient, err := mongo.
+		Connect(ctx, options.Client().ApplyURI(env.GetRequiredString(env.StatemarketdealsMongoURI)))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to mongo statemarketdealsDB")
+	}
+	marketDealsCollection := stateMarketDealsClient.
+		Database(env.GetRequiredString(env.StatemarketdealsMongoDatabase)).
+		Collection("state_market_deals")
+
+	providerResolver, err := resolver.NewProviderResolverFromEnv()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create provider resolver")
+	}
+
+	history, err := resolver.OpenProviderHistoryFromEnv(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if history == nil {
+		return nil, errors.Errorf("%s not set", env.ResultMongoURI)
+	}
+
+	return &ProviderHistoryIntegration{
+		marketDealsCollection: marketDealsCollection,
+		providerResolver:      providerResolver,
+		history:               history,
+	}, nil
+}
+
+func (p *ProviderHistoryIntegration) RunOnce(ctx context.Context) error {
+	logger.Info("start snapshotting providers with active deals")
+	providers, err := p.marketDealsCollection.Distinct(ctx, "provider", bson.M{
+		"sector_start": bson.M{"$gt": 0},
+		"end":          bson.M{"$gt": model.TimeToEpoch(time.Now())},
+		"slashed":      bson.M{"$lt": 0},
+		"inactive":     bson.M{"$ne": true},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to get providers with active deals")
+	}
+
+	var head ChainHead
+	err = p.providerResolver.LotusClient().CallFor(ctx, &head, "Filecoin.ChainHead")
+	if err != nil {
+		return errors.Wrap(err, "failed to get chain head")
+	}
+
+	changed := 0
+	failed := 0
+	for _, value := range providers {
+		provider, ok := value.(string)
+		if !ok {
+			continue
+		}
+
+		minerInfo, err := p.providerResolver.FetchMinerInfo(ctx, provider)
+		if err != nil {
+			logger.With("provider", provider, "err", err).Warn("failed to get miner info")
+			failed++
+			continue
+		}
+
+		inserted, err := p.history.Record(ctx, model.ProviderSnapshot{
+			Provider:   provider,
+			PeerID:     minerInfo.PeerId,
+			Multiaddrs: convert.MultiaddrsBytesToStringArraySkippingError(minerInfo.Multiaddrs),
+			Epoch:      head.Height,
+			CreatedAt:  time.Now().UTC(),
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to record provider snapshot")
+		}
+
+		if inserted {
+			logger.With("provider", provider, "peerID", minerInfo.PeerId, "epoch", head.Height).
+				Info("provider endpoint changed")
+			changed++
+		}
+	}
+
+	logger.With("providers", len(providers), "changed", changed, "failed", failed, "epoch", head.Height).
+		Info("finished snapshotting providers")
+	return nil
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/campaign"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/data-preservation-programs/RetrievalBot/worker/bitswap"
+	"github.com/data-preservation-programs/RetrievalBot/worker/graphsync"
+	"github.com/data-preservation-programs/RetrievalBot/worker/http"
+	"github.com/google/uuid"
+	logging "github.com/ipfs/go-log/v2"
+	_ "github.com/joho/godotenv/autoload"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var logger = logging.Logger("replay")
+
+// PastResult is a task_result document with its ID.
+type PastResult struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	task.Result `bson:",inline"`
+}
+
+// Replay pairs a past result with the task replaying it and its outcome, once known.
+type Replay struct {
+	Original PastResult
+	Task     task.Task
+	Result   *task.RetrievalResult
+}
+
+//nolint:gochecknoglobals
+var workers = map[task.ModuleName]task.Worker{
+	task.GraphSync: graphsync.Worker{},
+	task.Bitswap:   bitswap.Worker{},
+	task.HTTP:      http.Worker{},
+}
+
+func main() {
+	app := &cli.App{
+		Name: "replay",
+		Usage: "Re-run the tasks of past results selected by filter, either inline or through the queue, " +
+			"and compare the original and new outcomes",
+		Action: run,
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:    "provider",
+				Usage:   "Providers of the results to replay",
+				Aliases: []string{"p"},
+			},
+			&cli.StringSliceFlag{
+				Name:  "module",
+				Usage: "Modules of the results to replay",
+			},
+			&cli.StringSliceFlag{
+				Name:  "error-code",
+				Usage: "Error codes of the results to replay",
+			},
+			&cli.StringFlag{
+				Name:  "requester",
+				Usage: "Requester of the results to replay",
+			},
+			&cli.StringFlag{
+				Name:  "from",
+				Usage: "Replay the results created from this time, as RFC3339 or YYYY-MM-DD",
+			},
+			&cli.StringFlag{
+				Name:  "to",
+				Usage: "Replay the results created before this time, as RFC3339 or YYYY-MM-DD",
+			},
+			&cli.Int64Flag{
+				Name:  "limit",
+				Usage: "Maximum number of results to replay, the latest first",
+				Value: 100,
+			},
+			&cli.StringFlag{
+				Name:  "replay-requester",
+				Usage: "Requester of the new tasks",
+				Value: "replay",
+			},
+			&cli.BoolFlag{
+				Name:  "inline",
+				Usage: "Run the tasks in this process instead of sending them to the queue",
+			},
+			&cli.BoolFlag{
+				Name:  "wait",
+				Usage: "Wait for the results of the queued tasks and compare them",
+			},
+			&cli.DurationFlag{
+				Name:  "wait-timeout",
+				Usage: "How long to wait for the results",
+				Value: time.Hour,
+			},
+		},
+	}
+	err := app.Run(os.Args)
+	if err != nil {
+		logger.Fatal(err)
+	}
+}
+
+func run(c *cli.Context) error {
+	ctx := c.Context
+	filter, err := resultFilter(c.StringSlice("provider"), c.StringSlice("module"), c.StringSlice("error-code"),
+		c.String("requester"), c.String("from"), c.String("to"))
+	if err != nil {
+		return err
+	}
+
+	queue, err := campaign.NewMongoQueueFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+
+	cursor, err := queue.ResultCollection().Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(c.Int64("limit")))
+	if err != nil {
+		return errors.Wrap(err, "failed to query results")
+	}
+	var originals []PastResult
+	err = cursor.All(ctx, &originals)
+	if err != nil {
+		return errors.Wrap(err, "failed to decode results")
+	}
+	logger.Infow("Results to replay", "filter", filter, "count", len(originals))
+	if len(originals) == 0 {
+		return nil
+	}
+
+	campaignID := uuid.New().String()
+	now := time.Now().UTC()
+	replays := make([]Replay, len(originals))
+	for i, original := range originals {
+		replays[i] = Replay{Original: original, Task: replayTask(original, c.String("replay-requester"), campaignID, now)}
+	}
+
+	if c.Bool("inline") {
+		runInline(replays)
+		printComparison(os.Stdout, replays)
+		return nil
+	}
+
+	tasks := make([]task.Task, len(replays))
+	for i, replay := range replays {
+		tasks[i] = replay.Task
+	}
+	err = queue.AddTasks(ctx, tasks)
+	if err != nil {
+		return err
+	}
+	logger.Infow("Tasks added", "campaignID", campaignID, "tasks", len(tasks))
+
+	if !c.Bool("wait") {
+		return nil
+	}
+
+	results, err := queue.WaitForResults(ctx, campaign.CampaignResultFilter(c.String("replay-requester"), campaignID),
+		len(tasks), c.Duration("wait-timeout"), 10*time.Second)
+	if err != nil {
+		return err
+	}
+
+	matchResults(replays, results)
+	printComparison(os.Stdout, replays)
+	return nil
+}
+
+// resultFilter selects the results by provider, module, error code, requester and creation time.
+func resultFilter(
+	providers []string,
+	modules []string,
+	errorCodes []string,
+	requester string,
+	from string,
+	to string,
+) (bson.M, error) {
+	filter := bson.M{}
+	if len(providers) > 0 {
+		filter["task.provider.id"] = bson.M{"$in": providers}
+	}
+	if len(modules) > 0 {
+		filter["task.module"] = bson.M{"$in": modules}
+	}
+	if len(errorCodes) > 0 {
+		filter["result.error_code"] = bson.M{"$in": errorCodes}
+	}
+	if requester != "" {
+		filter["task.requester"] = requester
+	}
+
+	createdAt := bson.M{}
+	for op, value := range map[string]string{"$gte": from, "$lt": to} {
+		if value == "" {
+			continue
+		}
+		t, err := parseTime(value)
+		if err != nil {
+			return nil, err
+		}
+		createdAt[op] = t
+	}
+	if len(createdAt) > 0 {
+		filter["created_at"] = createdAt
+	}
+	return filter, nil
+}
+
+func parseTime(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, nil
+	}
+
+	t, err = time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, errors.Errorf("cannot parse time %s, expected RFC3339 or YYYY-MM-DD", value)
+	}
+	return t, nil
+}
+
+// replayTask returns the task of the original result with a fresh creation time, the requester of the replay
+// and a reference to the original result.
+func replayTask(original PastResult, requester string, campaignID string, now time.Time) task.Task {
+	replayed := original.Task
+	replayed.Requester = requester
+	replayed.CreatedAt = now
+	replayed.Metadata = make(map[string]string, len(original.Metadata)+2)
+	for k, v := range original.Metadata {
+		replayed.Metadata[k] = v
+	}
+	replayed.Metadata["replay_of"] = original.ID.Hex()
+	replayed.Metadata["campaign_id"] = campaignID
+	return replayed
+}
+
+// runInline runs the tasks one by one with the worker of their module.
+func runInline(replays []Replay) {
+	for i := range replays {
+		replay := &replays[i]
+		worker, ok := workers[replay.Task.Module]
+		if !ok {
+			logger.Warnw("Cannot run module inline", "module", replay.Task.Module)
+			continue
+		}
+
+		logger.Infow("Running task", "provider", replay.Task.Provider.ID, "module", replay.Task.Module,
+			"cid", replay.Task.Content.CID)
+		result, err := task.ResolveWorkResult(worker.DoWork(replay.Task))
+		if err != nil {
+			result = task.NewErrorRetrievalResult(task.RetrievalFailure, err)
+		}
+		replay.Result = result
+	}
+}
+
+// matchResults sets the outcome of each replay from the new results referencing its original.
+func matchResults(replays []Replay, results []task.Result) {
+	perOriginal := make(map[string]task.RetrievalResult, len(results))
+	for _, result := range results {
+		perOriginal[result.Metadata["replay_of"]] = result.Result
+	}
+	for i := range replays {
+		if result, ok := perOriginal[replays[i].Original.ID.Hex()]; ok {
+			replays[i].Result = &result
+		}
+	}
+}
+
+//nolint:errcheck
+func printComparison(w io.Writer, replays []Replay) {
+	writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ORIGINAL\tCREATED AT\tPROVIDER\tMODULE\tCID\tBEFORE\tAFTER\tCHANGED")
+	for _, replay := range replays {
+		original := replay.Original
+		after := "no result"
+		changed := "-"
+		if replay.Result != nil {
+			after = outcome(*replay.Result)
+			changed = "no"
+			if replay.Result.Success != original.Result.Result.Success ||
+				replay.Result.ErrorCode != original.Result.Result.ErrorCode {
+				changed = "yes"
+			}
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			original.ID.Hex(), original.CreatedAt.Format(time.RFC3339), original.Provider.ID, original.Module,
+			original.Content.CID, outcome(original.Result.Result), after, changed)
+	}
+	writer.Flush()
+}
+
+func outcome(result task.RetrievalResult) string {
+	if result.Success {
+		return fmt.Sprintf("success (ttfb %s, %.0f B/s)", result.TTFB.Round(time.Millisecond), result.Speed)
+	}
+	return fmt.Sprintf("%s: %s", result.ErrorCode, result.ErrorMessage)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/testutil/bsonmatch"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestResultFilter(t *testing.T) {
+	filter, err := resultFilter([]string{"f01000"}, []string{"http"}, []string{"timeout", "not_found"}, "spade",
+		"2024-03-01", "2024-03-02T12:00:00Z")
+	assert.NoError(t, err)
+	assert.Equal(t, bson.M{
+		"task.provider.id":  bson.M{"$in": []string{"f01000"}},
+		"task.module":       bson.M{"$in": []string{"http"}},
+		"result.error_code": bson.M{"$in": []string{"timeout", "not_found"}},
+		"task.requester":    "spade",
+		"created_at": bson.M{
+			"$gte": time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			"$lt":  time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC),
+		},
+	}, filter)
+
+	filter, err = resultFilter(nil, nil, nil, "", "", "")
+	assert.NoError(t, err)
+	assert.Empty(t, filter)
+
+	_, err = resultFilter(nil, nil, nil, "", "yesterday", "")
+	assert.Error(t, err)
+}
+
+func TestResultFilterMatchesResult(t *testing.T) {
+	filter, err := resultFilter([]string{"f01000"}, []string{"http"}, []string{"timeout"}, "spade",
+		"2024-03-01", "2024-03-02")
+	assert.NoError(t, err)
+	result := task.Result{
+		Task: task.Task{
+			Requester: "spade",
+			Module:    task.HTTP,
+			Provider:  task.Provider{ID: "f01000"},
+		},
+		Result:    task.RetrievalResult{ErrorCode: "timeout"},
+		CreatedAt: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+	}
+	matched, err := bsonmatch.Match(result, filter)
+	assert.NoError(t, err)
+	assert.True(t, matched)
+
+	result.Task.Provider.ID = "f02000"
+	matched, err = bsonmatch.Match(result, filter)
+	assert.NoError(t, err)
+	assert.False(t, matched)
+}
+
+func TestReplayTask(t *testing.T) {
+	created := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	id := primitive.NewObjectID()
+	document, err := bson.Marshal(PastResult{ID: id, Result: task.Result{
+		Task: task.Task{
+			Requester: "spade",
+			Module:    task.HTTP,
+			Metadata:  map[string]string{"retrieve_type": "piece"},
+			Provider:  task.Provider{ID: "f01000"},
+			Content:   task.Content{CID: "baga"},
+			Timeout:   time.Minute,
+		},
+		Result:    task.RetrievalResult{ErrorCode: task.Timeout, ErrorMessage: "timed out"},
+		CreatedAt: created,
+	}})
+	assert.NoError(t, err)
+	var original PastResult
+	assert.NoError(t, bson.Unmarshal(document, &original))
+	assert.Equal(t, id, original.ID)
+	assert.Equal(t, "f01000", original.Provider.ID)
+	assert.Equal(t, task.Timeout, original.Result.Result.ErrorCode)
+	assert.Equal(t, created, original.CreatedAt)
+
+	now := time.Now()
+	replayed := replayTask(original, "replay", "campaign", now)
+	assert.Equal(t, task.Task{
+		Requester: "replay",
+		Module:    task.HTTP,
+		Metadata: map[string]string{
+			"retrieve_type": "piece",
+			"replay_of":     id.Hex(),
+			"campaign_id":   "campaign",
+		},
+		Provider:  task.Provider{ID: "f01000"},
+		Content:   task.Content{CID: "baga"},
+		Timeout:   time.Minute,
+		CreatedAt: now,
+	}, replayed)
+	assert.Equal(t, map[string]string{"retrieve_type": "piece"}, original.Metadata)
+}
+
+func TestComparison(t *testing.T) {
+	failed := PastResult{ID: primitive.NewObjectID()}
+	failed.Provider.ID = "f01000"
+	failed.Module = task.HTTP
+	failed.Result.Result = task.RetrievalResult{ErrorCode: task.Timeout, ErrorMessage: "timed out"}
+	unchanged := PastResult{ID: primitive.NewObjectID()}
+	unchanged.Result.Result = task.RetrievalResult{Success: true, TTFB: time.Second, Speed: 100}
+	missing := PastResult{ID: primitive.NewObjectID()}
+	replays := []Replay{{Original: failed}, {Original: unchanged}, {Original: missing}}
+
+	matchResults(replays, []task.Result{
+		{
+			Task:   task.Task{Metadata: map[string]string{"replay_of": failed.ID.Hex()}},
+			Result: task.RetrievalResult{Success: true, TTFB: 2 * time.Second, Speed: 1000},
+		},
+		{
+			Task:   task.Task{Metadata: map[string]string{"replay_of": unchanged.ID.Hex()}},
+			Result: task.RetrievalResult{Success: true, TTFB: time.Second, Speed: 200},
+		},
+	})
+	assert.True(t, replays[0].Result.Success)
+	assert.Nil(t, replays[2].Result)
+
+	var out bytes.Buffer
+	printComparison(&out, replays)
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	assert.Len(t, lines, 4)
+	assert.Regexp(t, `f01000\s+http\s+timeout: timed out\s+success \(ttfb 2s, 1000 B/s\)\s+yes$`, string(lines[1]))
+	assert.Regexp(t, `success \(ttfb 1s, 100 B/s\)\s+success \(ttfb 1s, 200 B/s\)\s+no$`, string(lines[2]))
+	assert.Regexp(t, `no result\s+-$`, string(lines[3]))
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/resolver"
+	logging "github.com/ipfs/go-log/v2"
+	_ "github.com/joho/godotenv/autoload"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var logger = logging.Logger("resolver-cache")
+
+var namespaceFlag = &cli.StringFlag{
+	Name:     "namespace",
+	Usage:    "Cache namespace, either provider or location",
+	Aliases:  []string{"n"},
+	Required: true,
+}
+
+var filterFlags = []cli.Flag{
+	&cli.BoolFlag{
+		Name:  "errors",
+		Usage: "Only include negative entries, i.e. failed lookups",
+	},
+	&cli.BoolFlag{
+		Name:  "changed",
+		Usage: "Only include providers whose peer ID or multiaddrs have changed",
+	},
+	&cli.BoolFlag{
+		Name:  "expired",
+		Usage: "Only include expired entries",
+	},
+}
+
+func main() {
+	app := &cli.App{
+		Name:  "resolvercache",
+		Usage: "Inspect and invalidate the persistent provider and location resolver cache",
+		Commands: []*cli.Command{
+			{
+				Name:   "list",
+				Usage:  "List cache entries",
+				Flags:  append([]cli.Flag{namespaceFlag}, filterFlags...),
+				Action: list,
+			},
+			{
+				Name:      "get",
+				Usage:     "Show a single cache entry",
+				ArgsUsage: "key",
+				Flags:     []cli.Flag{namespaceFlag},
+				Action:    get,
+			},
+			{
+				Name:      "invalidate",
+				Usage:     "Remove cache entries by key, or all entries that match the filters",
+				ArgsUsage: "[key...]",
+				Flags: append([]cli.Flag{namespaceFlag, &cli.BoolFlag{
+					Name:  "all",
+					Usage: "Remove all entries of the namespace that match the filters",
+				}}, filterFlags...),
+				Action: invalidate,
+			},
+		},
+	}
+
+	err := app.Run(os.Args)
+	if err != nil {
+		logger.Fatal(err)
+	}
+}
+
+func openCache(ctx context.Context, namespace string) (*resolver.PersistentCache[bson.M], error) {
+	if namespace != resolver.ProviderCacheNamespace && namespace != resolver.LocationCacheNamespace {
+		return nil, errors.Errorf("unknown namespace %s", namespace)
+	}
+
+	collection, err := resolver.OpenCacheCollection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if collection == nil {
+		return nil, errors.New("RESOLVER_CACHE_MONGO_URI is not set")
+	}
+
+	// TTLs are only used when writing, which this command never does
+	return resolver.NewPersistentCache[bson.M](collection, namespace, 0, 0, nil), nil
+}
+
+func listFilter(c *cli.Context) resolver.CacheListFilter {
+	return resolver.CacheListFilter{
+		ErrorsOnly:  c.Bool("errors"),
+		ChangedOnly: c.Bool("changed"),
+		ExpiredOnly: c.Bool("expired"),
+	}
+}
+
+//nolint:forbidigo
+func printEntry(entry resolver.CacheEntry[bson.M]) {
+	status := "valid"
+	if entry.IsExpired() {
+		status = "expired"
+	}
+	fmt.Printf("%s [%s] updated %s, expires %s\n",
+		entry.Key, status, entry.UpdatedAt.Format(time.RFC3339), entry.ExpiresAt.Format(time.RFC3339))
+	if entry.Error != nil {
+		fmt.Printf("  error (%s): %s\n", entry.Error.Kind, entry.Error.Message)
+	}
+	if entry.Value != nil {
+		fmt.Printf("  value: %v\n", *entry.Value)
+	}
+	if !entry.ChangedAt.IsZero() {
+		fmt.Printf("  changed at %s, previous: %v\n", entry.ChangedAt.Format(time.RFC3339), entry.Previous)
+	}
+}
+
+func list(c *cli.Context) error {
+	cache, err := openCache(c.Context, c.String("namespace"))
+	if err != nil {
+		return err
+	}
+
+	entries, err := cache.List(c.Context, listFilter(c))
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		printEntry(entry)
+	}
+
+	logger.Infof("%d entries found", len(entries))
+	return nil
+}
+
+func get(c *cli.Context) error {
+	key := c.Args().First()
+	if key == "" {
+		return errors.New("please specify the key")
+	}
+
+	cache, err := openCache(c.Context, c.String("namespace"))
+	if err != nil {
+		return err
+	}
+
+	entry, err := cache.Peek(c.Context, key)
+	if err != nil {
+		return err
+	}
+
+	if entry == nil {
+		return errors.Errorf("no entry found for %s", key)
+	}
+
+	printEntry(*entry)
+	return nil
+}
+
+func invalidate(c *cli.Context) error {
+	cache, err := openCache(c.Context, c.String("namespace"))
+	if err != nil {
+		return err
+	}
+
+	var deleted int64
+	switch {
+	case c.Bool("all"):
+		deleted, err = cache.InvalidateMatching(c.Context, listFilter(c))
+	case c.Args().Len() > 0:
+		deleted, err = cache.Invalidate(c.Context, c.Args().Slice()...)
+	default:
+		return errors.New("please specify the keys to invalidate or --all")
+	}
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("%d entries invalidated", deleted)
+	return nil
+}
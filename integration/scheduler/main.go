@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/campaign"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/env"
+	logging "github.com/ipfs/go-log/v2"
+	_ "github.com/joho/godotenv/autoload"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+var logger = logging.Logger("scheduler")
+
+func main() {
+	app := &cli.App{
+		Name:  "scheduler",
+		Usage: "run every campaign of a YAML/JSON config file and reload it when it changes",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "config",
+				Usage:   "Path to the campaign config file",
+				Aliases: []string{"c"},
+				Value:   env.GetString(env.CampaignConfig, "campaigns.yaml"),
+			},
+		},
+		Action: run,
+	}
+
+	err := app.Run(os.Args)
+	if err != nil {
+		logger.Fatal(err)
+	}
+}
+
+// Scheduler runs one goroutine per campaign and, when the config file changes, restarts only the campaigns
+// whose definition changed.
+type Scheduler struct {
+	deps campaign.Deps
+	runs map[string]*campaignRun
+}
+
+type campaignRun struct {
+	definition campaign.Definition
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+func run(c *cli.Context) error {
+	ctx := c.Context
+	path := c.String("config")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read %s", path)
+	}
+
+	config, err := campaign.ParseConfig(data)
+	if err != nil {
+		return err
+	}
+
+	deps, err := campaign.NewDepsFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+
+	deps.Resolvers.Provider.LotusClient().
+		StartHealthCheck(ctx, env.GetDuration(env.LotusAPIHealthCheckInterval, time.Minute))
+
+	scheduler := &Scheduler{deps: deps, runs: make(map[string]*campaignRun)}
+	err = scheduler.Apply(ctx, config)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(env.GetDuration(env.CampaignConfigReloadInterval, 30*time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			scheduler.Stop()
+			return nil
+		case <-ticker.C:
+		}
+
+		newData, err := os.ReadFile(path)
+		if err != nil {
+			logger.With("path", path, "err", err).Error("failed to read campaign config")
+			continue
+		}
+
+		if bytes.Equal(data, newData) {
+			continue
+		}
+
+		newConfig, err := campaign.ParseConfig(newData)
+		if err != nil {
+			logger.With("path", path, "err", err).Error("invalid campaign config, keep running the previous one")
+			data = newData
+			continue
+		}
+
+		logger.With("path", path, "campaigns", len(newConfig.Campaigns)).Info("campaign config changed, reloading")
+		data = newData
+		err = scheduler.Apply(ctx, newConfig)
+		if err != nil {
+			logger.With("err", err).Error("failed to start campaigns, keep running the previous ones")
+		}
+	}
+}
+
+// Apply starts the campaigns that are new or whose definition changed, after stopping their previous run,
+// and stops the campaigns that were removed. Unchanged campaigns keep running on their cadence.
+func (s *Scheduler) Apply(ctx context.Context, config campaign.Config) error {
+	changed, removed := diffCampaigns(s.definitions(), config)
+	runners := make([]*campaign.Runner, 0, len(changed))
+	for _, definition := range changed {
+		runner, err := campaign.NewRunner(definition, s.deps)
+		if err != nil {
+			return errors.Wrapf(err, "failed to create campaign %s", definition.Name)
+		}
+		runners = append(runners, runner)
+	}
+
+	for _, name := range removed {
+		logger.With("campaign", name).Info("stopping removed campaign")
+		s.stop(name)
+	}
+	for _, runner := range runners {
+		s.stop(runner.Definition.Name)
+		logger.With("campaign", runner.Definition.Name, "requester", runner.Definition.Requester,
+			"cadence", time.Duration(runner.Definition.Cadence)).Info("starting campaign")
+		runCtx, cancel := context.WithCancel(ctx)
+		run := &campaignRun{definition: runner.Definition, cancel: cancel, done: make(chan struct{})}
+		s.runs[runner.Definition.Name] = run
+		go func(runner *campaign.Runner) {
+			runner.Run(runCtx)
+			close(run.done)
+		}(runner)
+	}
+
+	return nil
+}
+
+func (s *Scheduler) definitions() map[string]campaign.Definition {
+	definitions := make(map[string]campaign.Definition, len(s.runs))
+	for name, run := range s.runs {
+		definitions[name] = run.definition
+	}
+	return definitions
+}
+
+// diffCampaigns returns the definitions of the config that are not running as they are, and the names of the
+// running campaigns that are not in the config anymore.
+func diffCampaigns(
+	running map[string]campaign.Definition,
+	config campaign.Config,
+) ([]campaign.Definition, []string) {
+	var changed []campaign.Definition
+	names := make(map[string]struct{}, len(config.Campaigns))
+	for _, definition := range config.Campaigns {
+		names[definition.Name] = struct{}{}
+		previous, ok := running[definition.Name]
+		if !ok || !reflect.DeepEqual(previous, definition) {
+			changed = append(changed, definition)
+		}
+	}
+
+	var removed []string
+	for name := range running {
+		if _, ok := names[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(removed)
+	return changed, removed
+}
+
+// stop cancels the campaign and waits for its current run to finish.
+func (s *Scheduler) stop(name string) {
+	run, ok := s.runs[name]
+	if !ok {
+		return
+	}
+
+	run.cancel()
+	<-run.done
+	delete(s.runs, name)
+}
+
+// Stop cancels all campaigns and waits for their current run to finish.
+func (s *Scheduler) Stop() {
+	for name := range s.runs {
+		s.stop(name)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/campaign"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffCampaigns(t *testing.T) {
+	config, err := campaign.ParseConfig([]byte(`
+campaigns:
+  - name: unchanged
+    metadata: {team: a}
+  - name: changed
+    cadence: 10m
+  - name: added
+`))
+	assert.NoError(t, err)
+	previous, err := campaign.ParseConfig([]byte(`
+campaigns:
+  - name: unchanged
+    metadata: {team: a}
+  - name: changed
+    cadence: 5m
+  - name: removed
+`))
+	assert.NoError(t, err)
+	running := make(map[string]campaign.Definition)
+	for _, definition := range previous.Campaigns {
+		running[definition.Name] = definition
+	}
+
+	changed, removed := diffCampaigns(running, config)
+	assert.Equal(t, []campaign.Definition{config.Campaigns[1], config.Campaigns[2]}, changed)
+	assert.Equal(t, []string{"removed"}, removed)
+
+	changed, removed = diffCampaigns(nil, config)
+	assert.Equal(t, config.Campaigns, changed)
+	assert.Empty(t, removed)
+}
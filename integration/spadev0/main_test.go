@@ -1,25 +1,41 @@
 package main
 
 import (
+	"context"
+	"math/rand"
+	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/data-preservation-programs/RetrievalBot/pkg/campaign"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestSelectCidsToTest(t *testing.T) {
+	sampler := NewReplicaSampler(rand.New(rand.NewSource(1)))
 	// Sample data for testing
-	sampleData := map[int]ProviderReplicas{
-		123: {size: 128, replicas: []Replica{
-			{OptionalDagRoot: "root1", PieceCID: "cid1"},
-		}},
-		456: {size: 4096, replicas: []Replica{
-			{OptionalDagRoot: "root3", PieceCID: "cid3"},
-			{OptionalDagRoot: "root4", PieceCID: "cid4"},
-			{OptionalDagRoot: "root5", PieceCID: "cid5"},
-		}},
+	for _, replica := range []ActiveReplica{
+		{
+			Contracts: []Contract{{ProviderID: 123}},
+			Replica:   Replica{OptionalDagRoot: "root1", PieceCID: "cid1", PieceLog2Size: 37},
+		},
+		{
+			Contracts: []Contract{{ProviderID: 456}},
+			Replica:   Replica{OptionalDagRoot: "root3", PieceCID: "cid3", PieceLog2Size: 41},
+		},
+		{
+			Contracts: []Contract{{ProviderID: 456}},
+			Replica:   Replica{OptionalDagRoot: "root4", PieceCID: "cid4", PieceLog2Size: 40},
+		},
+		{
+			Contracts: []Contract{{ProviderID: 456}},
+			Replica:   Replica{OptionalDagRoot: "root5", PieceCID: "cid5", PieceLog2Size: 40},
+		},
+	} {
+		sampler.Add(replica)
 	}
 
-	toTest := selectReplicasToTest(sampleData)
+	toTest := sampler.Select()
 
 	// Ensure at least one replica is selected for each provider
 	for providerID, replicas := range toTest {
@@ -30,4 +46,78 @@ func TestSelectCidsToTest(t *testing.T) {
 
 	assert.Equal(t, 1, len(toTest[123]))
 	assert.Equal(t, 2, len(toTest[456]))
+	assert.NotEqual(t, toTest[456][0], toTest[456][1])
+}
+
+func TestReplicaSamplerIsUniformAndBounded(t *testing.T) {
+	sampler := NewReplicaSampler(rand.New(rand.NewSource(1)))
+	for i := 0; i < 10000; i++ {
+		sampler.Add(ActiveReplica{
+			Contracts: []Contract{{ProviderID: 1}},
+			Replica:   Replica{PieceCID: strconv.Itoa(i), PieceLog2Size: 35},
+		})
+	}
+
+	assert.Len(t, sampler.providers[1].reservoir, maxReservoirSize)
+	assert.Equal(t, 10000, sampler.providers[1].replicas)
+	// 10000 * 32 GiB = 312.5 TiB
+	toTest := sampler.Select()
+	assert.Len(t, toTest[1], 8)
+}
+
+func TestDecodeActiveReplicas(t *testing.T) {
+	list := `{
+		"state_epoch": 3000000,
+		"active_replicas": [
+			{"contracts": [{"provider_id": 1}, {"provider_id": 2}], "piece_cid": "cid1", "piece_log2_size": 35,
+			 "optional_dag_root": "root1"},
+			{"contracts": [{"provider_id": 1}], "piece_cid": "cid2", "piece_log2_size": 34}
+		],
+		"other": {"ignored": [1, 2]}
+	}`
+
+	var replicas []ActiveReplica
+	err := decodeActiveReplicas(strings.NewReader(list), func(replica ActiveReplica) error {
+		replicas = append(replicas, replica)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []ActiveReplica{
+		{
+			Contracts: []Contract{{ProviderID: 1}, {ProviderID: 2}},
+			Replica:   Replica{PieceCID: "cid1", PieceLog2Size: 35, OptionalDagRoot: "root1"},
+		},
+		{
+			Contracts: []Contract{{ProviderID: 1}},
+			Replica:   Replica{PieceCID: "cid2", PieceLog2Size: 34},
+		},
+	}, replicas)
+
+	err = decodeActiveReplicas(strings.NewReader(`{"active_replicas": [{"contracts": `), func(ActiveReplica) error {
+		return nil
+	})
+	assert.Error(t, err)
+}
+
+func TestReplicaSource(t *testing.T) {
+	var candidates []campaign.Candidate
+	err := replicaSource(map[int][]Replica{
+		1000: {
+			{PieceCID: "cid1", PieceLog2Size: 35, OptionalDagRoot: "root1"},
+			{PieceCID: "cid2", PieceLog2Size: 11},
+		},
+	}).Candidates(context.Background(), func(c campaign.Candidate) error {
+		candidates = append(candidates, c)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, candidates, 2)
+
+	assert.Equal(t, "f01000", candidates[0].Provider)
+	assert.Equal(t, "root1", candidates[0].PayloadCID)
+	assert.Equal(t, uint64(1)<<35, candidates[0].PieceSize)
+	assert.Empty(t, candidates[0].Metadata)
+
+	assert.Equal(t, "", candidates[1].PayloadCID)
+	assert.Equal(t, "2048", candidates[1].Metadata["retrieve_size"])
 }
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"container/heap"
+	"encoding/json"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// maxReservoirSize bounds the replicas kept per provider while streaming. numCidsToTest only reaches it
+// for providers storing 2^32 TiB, so the final selection is a uniform sample of all the replicas of a provider.
+const maxReservoirSize = 32
+
+type ActiveReplicas struct {
+	StateEpoch     uint            `json:"state_epoch"`
+	ActiveReplicas []ActiveReplica `json:"active_replicas"`
+}
+
+type ActiveReplica struct {
+	Contracts []Contract `json:"contracts"`
+	Replica
+}
+
+type Replica struct {
+	PieceCID        string `json:"piece_cid"`
+	PieceLog2Size   int    `json:"piece_log2_size"`
+	OptionalDagRoot string `json:"optional_dag_root"`
+}
+
+type Contract struct {
+	ProviderID           int `json:"provider_id"`
+	LegacyMarketID       int `json:"legacy_market_id"`
+	LegacyMarketEndEpoch int `json:"legacy_market_end_epoch"`
+}
+
+// decodeActiveReplicas streams the active_replicas of a decompressed replica list to yield,
+// without holding the list in memory.
+func decodeActiveReplicas(r io.Reader, yield func(ActiveReplica) error) error {
+	decoder := json.NewDecoder(r)
+	if err := expectDelim(decoder, '{'); err != nil {
+		return err
+	}
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return errors.Wrap(err, "failed to read key")
+		}
+
+		if key, ok := token.(string); !ok || key != "active_replicas" {
+			var skipped json.RawMessage
+			if err := decoder.Decode(&skipped); err != nil {
+				return errors.Wrapf(err, "failed to skip %v", token)
+			}
+			continue
+		}
+
+		if err := expectDelim(decoder, '['); err != nil {
+			return err
+		}
+		for decoder.More() {
+			var replica ActiveReplica
+			if err := decoder.Decode(&replica); err != nil {
+				return errors.Wrap(err, "failed to decode replica")
+			}
+			if err := yield(replica); err != nil {
+				return err
+			}
+		}
+		if err := expectDelim(decoder, ']'); err != nil {
+			return err
+		}
+	}
+
+	return expectDelim(decoder, '}')
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return errors.Wrapf(err, "failed to read %s", delim)
+	}
+	if token != delim {
+		return errors.Errorf("expected %s, got %v", delim, token)
+	}
+	return nil
+}
+
+type keyedReplica struct {
+	key     float64
+	replica Replica
+}
+
+// reservoir keeps the replicas with the smallest random keys, as a max-heap on the key.
+type reservoir []keyedReplica
+
+func (r reservoir) Len() int            { return len(r) }
+func (r reservoir) Less(i, j int) bool  { return r[i].key > r[j].key }
+func (r reservoir) Swap(i, j int)       { r[i], r[j] = r[j], r[i] }
+func (r *reservoir) Push(x interface{}) { *r = append(*r, x.(keyedReplica)) } //nolint:forcetypeassert
+func (r *reservoir) Pop() interface{} {
+	old := *r
+	item := old[len(old)-1]
+	*r = old[:len(old)-1]
+	return item
+}
+
+type providerReservoir struct {
+	// Total size of the replicas of the provider in GiB
+	size      int
+	replicas  int
+	reservoir reservoir
+}
+
+// ReplicaSampler draws the replicas to test per provider from a stream of replicas,
+// keeping at most maxReservoirSize replicas per provider in memory.
+type ReplicaSampler struct {
+	rng       *rand.Rand
+	providers map[int]*providerReservoir
+}
+
+func NewReplicaSampler(rng *rand.Rand) *ReplicaSampler {
+	return &ReplicaSampler{rng: rng, providers: make(map[int]*providerReservoir)}
+}
+
+func (s *ReplicaSampler) Add(replica ActiveReplica) {
+	size := (1 << replica.PieceLog2Size) >> 30 // Convert to GiB
+	for _, contract := range replica.Contracts {
+		provider, ok := s.providers[contract.ProviderID]
+		if !ok {
+			provider = &providerReservoir{}
+			s.providers[contract.ProviderID] = provider
+		}
+
+		provider.size += size
+		provider.replicas++
+		item := keyedReplica{key: s.rng.Float64(), replica: replica.Replica}
+		if provider.reservoir.Len() < maxReservoirSize {
+			heap.Push(&provider.reservoir, item)
+		} else if item.key < provider.reservoir[0].key {
+			provider.reservoir[0] = item
+			heap.Fix(&provider.reservoir, 0)
+		}
+	}
+}
+
+// Select returns numCidsToTest replicas for each provider, visiting providers in ascending order for logging.
+func (s *ReplicaSampler) Select() map[int][]Replica {
+	toTest := make(map[int][]Replica, len(s.providers))
+	providerIDs := make([]int, 0, len(s.providers))
+	for providerID := range s.providers {
+		providerIDs = append(providerIDs, providerID)
+	}
+	sort.Ints(providerIDs)
+
+	for _, providerID := range providerIDs {
+		provider := s.providers[providerID]
+		count := numCidsToTest(provider.size)
+
+		// This condition should not happen, but just in case there's a situation
+		// where a massive amount of bytes are being stored in relatively few CIDs
+		if count > provider.replicas {
+			logger.Warnf("provider %d only has %d replicas but we are trying to test %d",
+				providerID,
+				provider.replicas,
+				count,
+			)
+			count = provider.replicas
+		}
+
+		sorted := make(reservoir, len(provider.reservoir))
+		copy(sorted, provider.reservoir)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i].key < sorted[j].key })
+		for _, item := range sorted[:count] {
+			toTest[providerID] = append(toTest[providerID], item.replica)
+		}
+		logger.Debugf("provider %d is storing %d GiB will have %d tests\n", providerID, provider.size, count)
+	}
+
+	return toTest
+}
+
+// Compute a number of CIDs to test, based on the total size of data (assuming in GiB)
+// Minimum 1, then log2 of the size in TiB
+// ex:
+// < 4TiB = 1 cid
+// 4 TiB - 16TiB = 2 cids
+// 16 TiB - 32 TiB = 3 cids
+// 32 TiB - 64 TiB = 4 cids
+// 64 TiB - 128 TiB = 5 cids
+// 128 TiB - 256 TiB = 6 cids
+// etc...
+func numCidsToTest(sizeGiB int) int {
+	return int(math.Min(math.Max(math.Log2(float64(sizeGiB/1024)), 1), maxReservoirSize))
+}
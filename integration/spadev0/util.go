@@ -2,202 +2,109 @@ package main
 
 import (
 	"context"
-	"time"
+	"strconv"
 
-	"github.com/data-preservation-programs/RetrievalBot/pkg/convert"
-	"github.com/data-preservation-programs/RetrievalBot/pkg/env"
-	"github.com/data-preservation-programs/RetrievalBot/pkg/requesterror"
-	"github.com/data-preservation-programs/RetrievalBot/pkg/resolver"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/campaign"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/model"
 	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
 	"github.com/filecoin-project/go-address"
 	"github.com/pkg/errors"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func AddSpadeTasks(ctx context.Context, requester string, replicasToTest map[int][]Replica) error {
-	var tasks []interface{}
-	var results []interface{}
+const retrieveSize = 1048576
 
-	// set up cache and resolvers
-	providerCacheTTL := env.GetDuration(env.ProviderCacheTTL, 24*time.Hour)
-	locationCacheTTL := env.GetDuration(env.LocationCacheTTL, 24*time.Hour)
-	locationResolver := resolver.NewLocationResolver(env.GetRequiredString(env.IPInfoToken), locationCacheTTL)
-	providerResolver, err := resolver.NewProviderResolver(
-		env.GetString(env.LotusAPIUrl, "https://api.node.glif.io/rpc/v0"),
-		env.GetString(env.LotusAPIToken, ""),
-		providerCacheTTL)
-	if err != nil {
-		panic(err)
-	}
-
-	// Check public IP address
-	ipInfo, err := resolver.GetPublicIPInfo(ctx, "", "")
-	if err != nil {
-		panic(err)
-	}
-	logger.With("ipinfo", ipInfo).Infof("Public IP info retrieved")
-
-	address.CurrentNetwork = address.Mainnet
-
-	// For each SPID, assemble retrieval tasks for it
-	for spid, replicas := range replicasToTest {
-		strSpid, err := address.NewIDAddress(uint64(spid))
-		if err != nil {
-			logger.Errorf("failed to convert spid to address: %d : %v", spid, err)
-			continue
-		}
-		t, r := prepareTasksForSP(ctx, requester, strSpid, ipInfo, replicas, locationResolver, *providerResolver)
-
-		//nolint:asasalint
-		tasks = append(tasks, t)
-		//nolint:asasalint
-		results = append(results, r)
-	}
-
-	// Write resulting tasks and results to the DB
-	taskClient, err := mongo.
-		Connect(ctx, options.Client().ApplyURI(env.GetRequiredString(env.QueueMongoURI)))
-	if err != nil {
-		panic(err)
-	}
-	taskCollection := taskClient.
-		Database(env.GetRequiredString(env.QueueMongoDatabase)).Collection("task_queue")
-
-	if len(tasks) > 0 {
-		_, err = taskCollection.InsertMany(ctx, tasks)
-		if err != nil {
-			return errors.Wrap(err, "failed to insert tasks")
-		}
-	}
-
-	resultClient, err := mongo.Connect(ctx, options.Client().ApplyURI(env.GetRequiredString(env.ResultMongoURI)))
-	if err != nil {
-		panic(err)
-	}
-	resultCollection := resultClient.
-		Database(env.GetRequiredString(env.ResultMongoDatabase)).
-		Collection("task_result")
-
-	if len(results) > 0 {
-		_, err = resultCollection.InsertMany(ctx, results)
-		if err != nil {
-			return errors.Wrap(err, "failed to insert results")
-		}
-	}
-
-	return nil
-}
-
-var spadev0Metadata map[string]string = map[string]string{
-	"retrieve_type": "spade",
-	"retrieve_size": "1048576",
-	// todo: specify # of cids to test per layer of the tree TBD
+// SpadeOptions control how the replicas are tested
+type SpadeOptions struct {
+	Seed int64
+	// Number of DAG layers below the root retrieved by bitswap, 0 for the root block only
+	Layers int
+	// Number of blocks drawn at random from the links of each layer
+	CidsPerLayer int
 }
 
-func prepareTasksForSP(
+func AddSpadeTasks(
 	ctx context.Context,
+	queue campaign.Queue,
 	requester string,
-	spid address.Address,
-	ipInfo resolver.IPInfo,
-	replicas []Replica,
-	locationResolver resolver.LocationResolver,
-	providerResolver resolver.ProviderResolver,
-) (tasks []interface{}, results []interface{}) {
-	providerInfo, err := providerResolver.ResolveProvider(ctx, spid.String())
+	replicasToTest map[int][]Replica,
+	opts SpadeOptions,
+) error {
+	pipeline, _, err := campaign.NewPipelineFromEnv(ctx, requester, queue)
 	if err != nil {
-		logger.With("provider", spid).
-			Error("failed to resolve provider")
-		return
+		return err
 	}
+	pipeline.Modules = spadeModules(opts)
+	pipeline.Metadata = campaign.SamplingMetadata("log2_per_provider", opts.Seed)
 
-	location, err := locationResolver.ResolveMultiaddrsBytes(ctx, providerInfo.Multiaddrs)
+	_, err = pipeline.Run(ctx, replicaSource(replicasToTest))
 	if err != nil {
-		if errors.As(err, &requesterror.BogonIPError{}) ||
-			errors.As(err, &requesterror.InvalidIPError{}) ||
-			errors.As(err, &requesterror.HostLookupError{}) ||
-			errors.As(err, &requesterror.NoValidMultiAddrError{}) {
-			results = addErrorResults(requester, ipInfo, results, spid.String(), providerInfo, location,
-				task.NoValidMultiAddrs, err.Error())
-		} else {
-			logger.With("provider", spid, "err", err).
-				Error("failed to resolve provider location")
-			return
-		}
+		return errors.Wrap(err, "failed to add tasks")
 	}
 
-	for _, document := range replicas {
-		tasks = append(tasks, task.Task{
-			Requester: requester,
-			Module:    task.Bitswap,
-			Metadata:  spadev0Metadata,
-			Provider: task.Provider{
-				ID:         spid.String(),
-				PeerID:     providerInfo.PeerId,
-				Multiaddrs: convert.MultiaddrsBytesToStringArraySkippingError(providerInfo.Multiaddrs),
-				City:       location.City,
-				Region:     location.Region,
-				Country:    location.Country,
-				Continent:  location.Continent,
-			},
-			Content: task.Content{
-				CID: document.PieceCID,
-			},
-			CreatedAt: time.Now().UTC(),
-			Timeout:   env.GetDuration(env.FilplusIntegrationTaskTimeout, 15*time.Second),
-		})
-	}
+	return nil
+}
 
-	return tasks, results
+// replicaSource yields a candidate for each replica to test, keyed by the numeric provider ID.
+// Pieces smaller than the default retrieve size are retrieved in full by HTTP.
+func replicaSource(replicasToTest map[int][]Replica) campaign.Source {
+	return campaign.SourceFunc(func(ctx context.Context, yield func(campaign.Candidate) error) error {
+		// Loads the network profile, which formats the provider addresses with its prefix
+		model.GetNetwork()
+		for spid, replicas := range replicasToTest {
+			strSpid, err := address.NewIDAddress(uint64(spid))
+			if err != nil {
+				logger.Errorf("failed to convert spid to address: %d : %v", spid, err)
+				continue
+			}
+
+			for _, replica := range replicas {
+				pieceSize := uint64(1) << replica.PieceLog2Size
+				candidate := campaign.Candidate{
+					Provider:   strSpid.String(),
+					PayloadCID: replica.OptionalDagRoot,
+					PieceCID:   replica.PieceCID,
+					PieceSize:  pieceSize,
+					Metadata:   map[string]string{},
+				}
+				if pieceSize < retrieveSize {
+					candidate.Metadata["retrieve_size"] = strconv.FormatUint(pieceSize, 10)
+				}
+				err = yield(candidate)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
 }
 
-func addErrorResults(
-	requester string,
-	ipInfo resolver.IPInfo,
-	results []interface{},
-	spid string,
-	providerInfo resolver.MinerInfo,
-	location resolver.IPInfo,
-	errorCode task.ErrorCode,
-	errorMessage string,
-) []interface{} {
-	results = append(results, task.Result{
-		Task: task.Task{
-			Requester: requester,
-			Module:    "spadev0",
-			Metadata:  spadev0Metadata,
-			Provider: task.Provider{
-				ID:         spid,
-				PeerID:     providerInfo.PeerId,
-				Multiaddrs: convert.MultiaddrsBytesToStringArraySkippingError(providerInfo.Multiaddrs),
-				City:       location.City,
-				Region:     location.Region,
-				Country:    location.Country,
-				Continent:  location.Continent,
+// spadeModules tests the DAG root with graphsync and bitswap when the replica has one, and the piece with HTTP.
+func spadeModules(opts SpadeOptions) []campaign.Module {
+	return []campaign.Module{
+		{
+			Name: task.GraphSync,
+			Metadata: map[string]string{
+				"retrieve_type": "root_block",
 			},
-			CreatedAt: time.Now().UTC(),
-			Timeout:   env.GetDuration(env.FilplusIntegrationTaskTimeout, 15*time.Second)},
-		Retriever: task.Retriever{
-			PublicIP:  ipInfo.IP,
-			City:      ipInfo.City,
-			Region:    ipInfo.Region,
-			Country:   ipInfo.Country,
-			Continent: ipInfo.Continent,
-			ASN:       ipInfo.ASN,
-			ISP:       ipInfo.ISP,
-			Latitude:  ipInfo.Latitude,
-			Longitude: ipInfo.Longitude,
+			Content: campaign.PayloadContent,
 		},
-		Result: task.RetrievalResult{
-			Success:      false,
-			ErrorCode:    errorCode,
-			ErrorMessage: errorMessage,
-			TTFB:         0,
-			Speed:        0,
-			Duration:     0,
-			Downloaded:   0,
+		{
+			Name: task.Bitswap,
+			Metadata: map[string]string{
+				"retrieve_type":  "spade",
+				"layers":         strconv.Itoa(opts.Layers),
+				"cids_per_layer": strconv.Itoa(opts.CidsPerLayer),
+			},
+			Content: campaign.PayloadContent,
 		},
-		CreatedAt: time.Now().UTC(),
-	})
-	return results
+		{
+			Name: task.HTTP,
+			Metadata: map[string]string{
+				"retrieve_type": "piece",
+				"retrieve_size": strconv.Itoa(retrieveSize),
+			},
+			Content: campaign.PieceContent,
+		},
+	}
 }
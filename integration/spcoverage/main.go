@@ -1,17 +1,17 @@
 package main
 
 import (
+	"context"
 	"os"
 	"time"
 
-	"github.com/data-preservation-programs/RetrievalBot/integration/filplus/util"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/campaign"
 	"github.com/data-preservation-programs/RetrievalBot/pkg/env"
 	"github.com/data-preservation-programs/RetrievalBot/pkg/model"
-	"github.com/data-preservation-programs/RetrievalBot/pkg/resolver"
+	"github.com/google/uuid"
 	logging "github.com/ipfs/go-log/v2"
 	_ "github.com/joho/godotenv/autoload"
 	"github.com/pkg/errors"
-	"github.com/rjNemo/underscore"
 	"github.com/urfave/cli/v2"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -20,9 +20,17 @@ import (
 
 var logger = logging.Logger("spcoverage")
 
+const (
+	// Test every replica, i.e. one deal per (provider, piece)
+	ModeReplicas = "replicas"
+	// Test one piece per (client, provider)
+	ModeClientProvider = "client-provider"
+)
+
 type GroupID struct {
+	Client   string `bson:"client"`
 	Provider string `bson:"provider"`
-	PieceCID string `bson:"piece_cid"`
+	PieceCID string `bson:"piece_cid,omitempty"`
 }
 type Row struct {
 	ID       GroupID         `bson:"_id"`
@@ -32,7 +40,7 @@ type Row struct {
 func main() {
 	app := &cli.App{
 		Name:   "spcoverage",
-		Usage:  "Send tasks to make sure all deals of a given SPs are covered",
+		Usage:  "Send tasks to make sure all deals of given SPs, clients or allocators are covered",
 		Action: run,
 		Flags: []cli.Flag{
 			&cli.StringSliceFlag{
@@ -40,12 +48,40 @@ func main() {
 				Usage:   "The SPs to be covered",
 				Aliases: []string{"p"},
 			},
+			&cli.StringSliceFlag{
+				Name:    "client",
+				Usage:   "The clients whose data is to be covered",
+				Aliases: []string{"c"},
+			},
+			&cli.StringSliceFlag{
+				Name:    "allocator",
+				Usage:   "The allocators whose clients' data is to be covered, requires --allocator-file",
+				Aliases: []string{"a"},
+			},
+			&cli.StringFlag{
+				Name:  "allocator-file",
+				Usage: "YAML or JSON file mapping each allocator to its client addresses",
+			},
+			&cli.StringFlag{
+				Name:  "mode",
+				Usage: "replicas: test every replica of each piece, client-provider: test one piece per client and SP",
+				Value: ModeReplicas,
+			},
 			&cli.StringFlag{
 				Name:     "requester",
 				Usage:    "Name of the requester to tag the test result",
 				Aliases:  []string{"r"},
 				Required: true,
 			},
+			&cli.BoolFlag{
+				Name:  "wait",
+				Usage: "Wait for the results and print a summary per client",
+			},
+			&cli.DurationFlag{
+				Name:  "wait-timeout",
+				Usage: "How long to wait for the results",
+				Value: time.Hour,
+			},
 		},
 	}
 	err := app.Run(os.Args)
@@ -58,8 +94,22 @@ func run(c *cli.Context) error {
 	ctx := c.Context
 	sp := c.StringSlice("sp")
 	requester := c.String("requester")
-	if len(sp) == 0 {
-		logger.Fatal("Please specify the SPs to be covered")
+	mode := c.String("mode")
+	if mode != ModeReplicas && mode != ModeClientProvider {
+		return errors.Errorf("unknown mode %s", mode)
+	}
+
+	clients := c.StringSlice("client")
+	if allocators := c.StringSlice("allocator"); len(allocators) > 0 {
+		allocatorClients, err := loadAllocatorClients(c.String("allocator-file"), allocators)
+		if err != nil {
+			return err
+		}
+		clients = append(clients, allocatorClients...)
+	}
+
+	if len(sp) == 0 && len(clients) == 0 {
+		logger.Fatal("Please specify the SPs, clients or allocators to be covered")
 	}
 	if requester == "" {
 		logger.Fatal("Please specify the requester")
@@ -74,37 +124,31 @@ func run(c *cli.Context) error {
 	marketDealsCollection := stateMarketDealsClient.
 		Database(env.GetRequiredString(env.StatemarketdealsMongoDatabase)).
 		Collection("state_market_deals")
-
-	providerCacheTTL := env.GetDuration(env.ProviderCacheTTL, 24*time.Hour)
-	locationCacheTTL := env.GetDuration(env.LocationCacheTTL, 24*time.Hour)
-	locationResolver := resolver.NewLocationResolver(env.GetRequiredString(env.IPInfoToken), locationCacheTTL)
-	providerResolver, err := resolver.NewProviderResolver(
-		env.GetString(env.LotusAPIUrl, "https://api.node.glif.io/rpc/v0"),
-		env.GetString(env.LotusAPIToken, ""),
-		providerCacheTTL)
+	queue, err := campaign.NewMongoQueueFromEnv(ctx)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	// Check public IP address
-	ipInfo, err := resolver.GetPublicIPInfo(ctx, "", "")
+	pipeline, _, err := campaign.NewPipelineFromEnv(ctx, requester, queue)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	logger.With("ipinfo", ipInfo).Infof("Public IP info retrieved")
 
-	// Get all CIDs for the given SPs
-	//nolint:govet
+	campaignID := uuid.New().String()
+	pipeline.Metadata = map[string]string{"campaign_id": campaignID}
+
+	verified := true
+	match := campaign.Filters{Verified: &verified, Providers: sp, Clients: clients}.Match(time.Now())
+	groupID := bson.D{{Key: "client", Value: "$client"}, {Key: "provider", Value: "$provider"}}
+	if mode == ModeReplicas {
+		groupID = append(groupID, bson.E{Key: "piece_cid", Value: "$piece_cid"})
+	}
+
+	// Get all CIDs for the given SPs and clients
 	result, err := marketDealsCollection.Aggregate(ctx, mongo.Pipeline{
-		{{"$match", bson.M{
-			"sector_start": bson.M{"$gt": 0},
-			"end":          bson.M{"$gt": model.TimeToEpoch(time.Now())},
-			"verified":     true,
-			"slashed":      bson.M{"$lt": 0},
-			"provider":     bson.M{"$in": sp},
-		}}},
-		{{"$group", bson.D{
-			{"_id", bson.D{{"provider", "$provider"}, {"piece_cid", "$piece_cid"}}},
-			{"document", bson.D{{"$first", "$$ROOT"}}},
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: groupID},
+			{Key: "document", Value: bson.D{{Key: "$first", Value: "$$ROOT"}}},
 		}}},
 	})
 	if err != nil {
@@ -116,41 +160,35 @@ func run(c *cli.Context) error {
 		return errors.Wrap(err, "failed to decode market deals")
 	}
 
-	logger.Infow("Market deals retrieved", "count", len(rows))
-	documents := underscore.Map(rows, func(row Row) model.DealState {
-		return row.Document
+	logger.Infow("Market deals retrieved", "count", len(rows), "campaignID", campaignID)
+	source := campaign.SourceFunc(func(ctx context.Context, yield func(campaign.Candidate) error) error {
+		for _, row := range rows {
+			candidate, ok := campaign.DealCandidate(row.Document)
+			if !ok {
+				continue
+			}
+			candidate.Metadata["piece_cid"] = row.Document.PieceCID
+			if err := yield(candidate); err != nil {
+				return err
+			}
+		}
+		return nil
 	})
-	tasks, results := util.AddTasks(ctx, requester, ipInfo, documents, locationResolver, *providerResolver)
-
-	taskClient, err := mongo.
-		Connect(ctx, options.Client().ApplyURI(env.GetRequiredString(env.QueueMongoURI)))
+	stats, err := pipeline.Run(ctx, source)
 	if err != nil {
-		panic(err)
+		return errors.Wrap(err, "failed to add tasks")
 	}
-	taskCollection := taskClient.
-		Database(env.GetRequiredString(env.QueueMongoDatabase)).Collection("task_queue")
 
-	if len(tasks) > 0 {
-		_, err = taskCollection.InsertMany(ctx, tasks)
-		if err != nil {
-			return errors.Wrap(err, "failed to insert tasks")
-		}
+	if !c.Bool("wait") {
+		return nil
 	}
 
-	resultClient, err := mongo.Connect(ctx, options.Client().ApplyURI(env.GetRequiredString(env.ResultMongoURI)))
+	results, err := queue.WaitForResults(ctx, campaign.CampaignResultFilter(requester, campaignID),
+		stats.Tasks+stats.Results, c.Duration("wait-timeout"), 30*time.Second)
 	if err != nil {
-		panic(err)
-	}
-	resultCollection := resultClient.
-		Database(env.GetRequiredString(env.ResultMongoDatabase)).
-		Collection("task_result")
-
-	if len(results) > 0 {
-		_, err = resultCollection.InsertMany(ctx, results)
-		if err != nil {
-			return errors.Wrap(err, "failed to insert results")
-		}
+		return err
 	}
 
+	printSummaries(Summarize(results))
 	return nil
 }
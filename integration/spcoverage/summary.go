@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// ClientSummary describes how retrievable the data of a single client is across its storage providers.
+type ClientSummary struct {
+	Client         string
+	Pieces         int
+	Replicas       int
+	Retrievable    int
+	UnreachableSPs []string
+}
+
+func (s ClientSummary) ReplicasPerPiece() float64 {
+	if s.Pieces == 0 {
+		return 0
+	}
+	return float64(s.Replicas) / float64(s.Pieces)
+}
+
+// Summarize groups the results by client. A replica is retrievable if any module succeeded on it,
+// and a provider is unreachable if none of its replicas of the client are retrievable.
+func Summarize(results []task.Result) []ClientSummary {
+	type replica struct {
+		provider string
+		piece    string
+	}
+	retrievable := make(map[string]map[replica]bool)
+	for _, result := range results {
+		client := result.Metadata["client"]
+		if retrievable[client] == nil {
+			retrievable[client] = make(map[replica]bool)
+		}
+		r := replica{provider: result.Provider.ID, piece: result.Metadata["piece_cid"]}
+		retrievable[client][r] = retrievable[client][r] || result.Result.Success
+	}
+
+	summaries := make([]ClientSummary, 0, len(retrievable))
+	for client, replicas := range retrievable {
+		summary := ClientSummary{Client: client, Replicas: len(replicas)}
+		pieces := make(map[string]struct{})
+		reachable := make(map[string]bool)
+		for r, ok := range replicas {
+			pieces[r.piece] = struct{}{}
+			reachable[r.provider] = reachable[r.provider] || ok
+			if ok {
+				summary.Retrievable++
+			}
+		}
+		summary.Pieces = len(pieces)
+		for provider, ok := range reachable {
+			if !ok {
+				summary.UnreachableSPs = append(summary.UnreachableSPs, provider)
+			}
+		}
+		sort.Strings(summary.UnreachableSPs)
+		summaries = append(summaries, summary)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Client < summaries[j].Client
+	})
+	return summaries
+}
+
+//nolint:forbidigo
+func printSummaries(summaries []ClientSummary) {
+	for _, s := range summaries {
+		fmt.Printf("Client %s\n", s.Client)
+		fmt.Printf("  Pieces:             %d\n", s.Pieces)
+		fmt.Printf("  Replicas per piece: %.2f\n", s.ReplicasPerPiece())
+		fmt.Printf("  Retrievable:        %d/%d\n", s.Retrievable, s.Replicas)
+		fmt.Printf("  Unreachable SPs:    %v\n", s.UnreachableSPs)
+	}
+}
+
+// loadAllocatorClients reads a YAML or JSON file mapping allocators to their clients
+// and returns the clients of the given allocators.
+func loadAllocatorClients(path string, allocators []string) ([]string, error) {
+	if path == "" {
+		return nil, errors.New("--allocator requires --allocator-file")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read allocator file")
+	}
+	var mapping map[string][]string
+	err = yaml.Unmarshal(data, &mapping)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse allocator file")
+	}
+
+	var clients []string
+	for _, allocator := range allocators {
+		allocatorClients, ok := mapping[allocator]
+		if !ok {
+			return nil, errors.Errorf("allocator %s not found in %s", allocator, path)
+		}
+		clients = append(clients, allocatorClients...)
+	}
+	return clients, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummarize(t *testing.T) {
+	result := func(client, provider, piece string, module task.ModuleName, success bool) task.Result {
+		return task.Result{
+			Task: task.Task{
+				Module:   module,
+				Provider: task.Provider{ID: provider},
+				Metadata: map[string]string{"client": client, "piece_cid": piece},
+			},
+			Result: task.RetrievalResult{Success: success},
+		}
+	}
+
+	summaries := Summarize([]task.Result{
+		result("f01", "f0100", "piece1", task.HTTP, true),
+		result("f01", "f0100", "piece1", task.GraphSync, false),
+		result("f01", "f0200", "piece1", task.HTTP, false),
+		result("f01", "f0200", "piece2", task.HTTP, false),
+		result("f02", "f0100", "piece3", task.HTTP, true),
+	})
+
+	assert.Len(t, summaries, 2)
+	assert.Equal(t, ClientSummary{
+		Client:         "f01",
+		Pieces:         2,
+		Replicas:       3,
+		Retrievable:    1,
+		UnreachableSPs: []string{"f0200"},
+	}, summaries[0])
+	assert.Equal(t, 1.5, summaries[0].ReplicasPerPiece())
+	assert.Equal(t, ClientSummary{Client: "f02", Pieces: 1, Replicas: 1, Retrievable: 1}, summaries[1])
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/model"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	ReasonEnded   = "ended"
+	ReasonSlashed = "slashed"
+	ReasonMissing = "missing"
+)
+
+// archiveReason returns why a deal of the snapshot should be archived rather than kept live, or "" if it is live.
+func archiveReason(deal model.DealState, nowEpoch int32) string {
+	switch {
+	case deal.Slashed >= 0:
+		return ReasonSlashed
+	case deal.End <= nowEpoch:
+		return ReasonEnded
+	default:
+		return ""
+	}
+}
+
+type archiveRule struct {
+	reason string
+	match  bson.M
+}
+
+// archiveRules returns the filters of the live deals to archive for each reason.
+func archiveRules(nowEpoch int32) []archiveRule {
+	return []archiveRule{
+		{ReasonSlashed, bson.M{"slashed": bson.M{"$gte": 0}}},
+		{ReasonEnded, bson.M{"end": bson.M{"$lte": nowEpoch}}},
+		{ReasonMissing, bson.M{"inactive": true}},
+	}
+}
+
+// archiveWriteModel inserts a deal of the snapshot into the archive, keeping the first time it was archived.
+func archiveWriteModel(deal model.DealState, reason string, now time.Time) mongo.WriteModel {
+	return mongo.NewUpdateOneModel().
+		SetFilter(bson.M{"deal_id": deal.DealID}).
+		SetUpdate(bson.M{"$setOnInsert": model.ArchivedDeal{
+			DealState:     deal,
+			ArchiveReason: reason,
+			ArchivedAt:    now,
+		}}).
+		SetUpsert(true)
+}
+
+// archiveDeals moves the live deals matching the filter into the archive.
+func archiveDeals(
+	ctx context.Context,
+	live *mongo.Collection,
+	archive *mongo.Collection,
+	match bson.M,
+	reason string,
+	now time.Time,
+) (int64, error) {
+	cursor, err := live.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$unset", Value: bson.A{"_id", "snapshot_run"}}},
+		{{Key: "$set", Value: bson.M{"archive_reason": reason, "archived_at": now}}},
+		{{Key: "$merge", Value: bson.M{
+			"into":           archive.Name(),
+			"on":             "deal_id",
+			"whenMatched":    "keepExisting",
+			"whenNotMatched": "insert",
+		}}},
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to archive %s deals", reason)
+	}
+
+	//nolint:errcheck
+	cursor.Close(ctx)
+
+	result, err := live.DeleteMany(ctx, match)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to delete archived %s deals", reason)
+	}
+
+	return result.DeletedCount, nil
+}
+
+// ensureIndexes creates the indexes used by ingestion, archival and the task generation queries.
+// Collections filled before deal_id was unique are deduplicated first, as the unique index cannot be built otherwise.
+func ensureIndexes(ctx context.Context, live *mongo.Collection, archive *mongo.Collection) error {
+	for _, collection := range []*mongo.Collection{live, archive} {
+		unique, err := hasUniqueDealID(ctx, collection)
+		if err != nil {
+			return err
+		}
+		if unique {
+			continue
+		}
+
+		removed, err := dedupeDeals(ctx, collection)
+		if err != nil {
+			return err
+		}
+		logger.With("collection", collection.Name(), "removed", removed).
+			Info("removed duplicate deals before creating the unique deal_id index")
+	}
+
+	_, err := live.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "deal_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		// filplus and campaign sampling: verified active deals per client
+		{Keys: bson.D{{Key: "verified", Value: 1}, {Key: "client", Value: 1}, {Key: "sector_start", Value: 1}}},
+		// coverage and spcoverage: active deals per provider and piece
+		{Keys: bson.D{{Key: "provider", Value: 1}, {Key: "client", Value: 1}, {Key: "piece_cid", Value: 1}}},
+		// archival of ended deals
+		{Keys: bson.D{{Key: "end", Value: 1}}},
+		// marking deals missing from the snapshot
+		{Keys: bson.D{{Key: "snapshot_run", Value: 1}}},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to create state_market_deals indexes")
+	}
+
+	_, err = archive.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "deal_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "archive_reason", Value: 1}, {Key: "archived_at", Value: 1}}},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to create state_market_deals_archive indexes")
+	}
+
+	return nil
+}
+
+func hasUniqueDealID(ctx context.Context, collection *mongo.Collection) (bool, error) {
+	specifications, err := collection.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to list %s indexes", collection.Name())
+	}
+
+	for _, specification := range specifications {
+		keys, err := specification.KeysDocument.Elements()
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to read %s index keys", collection.Name())
+		}
+		if len(keys) == 1 && keys[0].Key() == "deal_id" && specification.Unique != nil && *specification.Unique {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+const dedupeBatchSize = 1000
+
+type duplicateDeal struct {
+	DealID int32         `bson:"_id"`
+	IDs    []interface{} `bson:"ids"`
+}
+
+// dedupeDeals keeps the most recently updated document of each deal_id and deletes the others.
+func dedupeDeals(ctx context.Context, collection *mongo.Collection) (int64, error) {
+	cursor, err := collection.Aggregate(ctx, bson.A{
+		bson.M{"$sort": bson.D{{Key: "deal_id", Value: 1}, {Key: "last_updated", Value: -1}}},
+		bson.M{"$group": bson.M{"_id": "$deal_id", "ids": bson.M{"$push": "$_id"}, "count": bson.M{"$sum": 1}}},
+		bson.M{"$match": bson.M{"count": bson.M{"$gt": 1}}},
+		bson.M{"$project": bson.M{"ids": 1}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to find duplicate deals in %s", collection.Name())
+	}
+
+	//nolint:errcheck
+	defer cursor.Close(ctx)
+	var removed int64
+	var ids []interface{}
+	deleteIDs := func() error {
+		if len(ids) == 0 {
+			return nil
+		}
+		result, err := collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+		if err != nil {
+			return errors.Wrapf(err, "failed to delete duplicate deals from %s", collection.Name())
+		}
+		removed += result.DeletedCount
+		ids = ids[:0]
+		return nil
+	}
+
+	for cursor.Next(ctx) {
+		var duplicate duplicateDeal
+		err = cursor.Decode(&duplicate)
+		if err != nil {
+			return removed, errors.Wrap(err, "failed to decode duplicate deal")
+		}
+
+		ids = append(ids, duplicate.IDs[1:]...)
+		if len(ids) >= dedupeBatchSize {
+			if err := deleteIDs(); err != nil {
+				return removed, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return removed, errors.Wrap(err, "failed to read duplicate deals")
+	}
+
+	return removed, deleteIDs()
+}
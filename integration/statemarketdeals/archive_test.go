@@ -0,0 +1,16 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchiveReason(t *testing.T) {
+	const now = 1000
+	assert.Equal(t, "", archiveReason(model.DealState{End: 2000, Slashed: -1}, now))
+	assert.Equal(t, ReasonEnded, archiveReason(model.DealState{End: 1000, Slashed: -1}, now))
+	assert.Equal(t, ReasonSlashed, archiveReason(model.DealState{End: 2000, Slashed: 500}, now))
+	assert.Equal(t, ReasonSlashed, archiveReason(model.DealState{End: 500, Slashed: 400}, now))
+}
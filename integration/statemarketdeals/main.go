@@ -2,16 +2,19 @@ package main
 
 import (
 	"context"
-	"net/http"
+	"io"
+	"os"
 	"strconv"
+	"time"
 
 	"github.com/bcicen/jstream"
 	"github.com/data-preservation-programs/RetrievalBot/pkg/env"
 	"github.com/data-preservation-programs/RetrievalBot/pkg/model"
 	"github.com/data-preservation-programs/RetrievalBot/pkg/model/rpc"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/snapshot"
+	"github.com/google/uuid"
 	logging "github.com/ipfs/go-log/v2"
 	_ "github.com/joho/godotenv/autoload"
-	"github.com/klauspost/compress/zstd"
 	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
 	"go.mongodb.org/mongo-driver/bson"
@@ -21,6 +24,34 @@ import (
 
 var logger = logging.Logger("state-market-deals")
 
+// Progress of the ingestion of a snapshot, so that a crashed run can resume where it stopped
+type Progress struct {
+	Source    string    `bson:"_id"`
+	Version   string    `bson:"version"`
+	RunID     string    `bson:"run_id"`
+	Processed int64     `bson:"processed"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+// Stats of an ingestion run
+type Stats struct {
+	Processed int64
+	Skipped   int64
+	Inserted  int64
+	Updated   int64
+	Inactive  int64
+	Archived  map[string]int64
+	start     time.Time
+}
+
+func (s Stats) Throughput() float64 {
+	elapsed := time.Since(s.start).Seconds()
+	if elapsed == 0 {
+		return 0
+	}
+	return float64(s.Processed-s.Skipped) / elapsed
+}
+
 func main() {
 	ctx := context.Background()
 	err := refresh(ctx)
@@ -38,60 +69,201 @@ func refresh(ctx context.Context) error {
 
 	//nolint:errcheck
 	defer client.Disconnect(ctx)
-	collection := client.Database(env.GetRequiredString(env.StatemarketdealsMongoDatabase)).
-		Collection("state_market_deals")
+	database := client.Database(env.GetRequiredString(env.StatemarketdealsMongoDatabase))
+	collection := database.Collection("state_market_deals")
+	progressCollection := database.Collection("statemarketdeals_progress")
 
-	logger.Info("getting deal ids from mongo")
-	dealIDCursor, err := collection.Find(ctx, bson.D{}, options.Find().
-		SetProjection(bson.M{"deal_id": 1, "_id": 1, "last_updated": 1}))
+	archiveCollection := database.Collection("state_market_deals_archive")
+	err = ensureIndexes(ctx, collection, archiveCollection)
+	if err != nil {
+		return err
+	}
+
+	source := env.GetString(env.StatemarketdealsSource, model.GetNetwork().MarketDealsSource)
+	if len(os.Args) > 1 {
+		source = os.Args[1]
+	}
+	if source == "" {
+		return errors.Errorf("no StateMarketDeals source for network %s, set STATEMARKETDEALS_SOURCE",
+			model.GetNetwork().Name)
+	}
+
+	metaStore := snapshot.NewMetaStore(database.Collection("snapshot_meta"))
+	previousVersion, err := metaStore.Version(ctx, source)
+	if err != nil {
+		return err
+	}
+
+	logger.With("source", source).Info("getting deals from state market deals")
+	marketDeals, err := snapshot.Open(ctx, source, previousVersion)
+	if errors.Is(err, snapshot.ErrUnchanged) {
+		logger.With("source", source, "version", previousVersion).Info("state market deals unchanged, skipping")
+		return nil
+	}
 	if err != nil {
-		return errors.Wrap(err, "failed to get deal ids")
+		return err
 	}
 
-	defer dealIDCursor.Close(ctx)
+	defer marketDeals.Close()
+
+	progress := Progress{Source: source, Version: marketDeals.Version, RunID: uuid.New().String()}
+	var previous Progress
+	err = progressCollection.FindOne(ctx, bson.M{"_id": source}).Decode(&previous)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+	case err != nil:
+		return errors.Wrap(err, "failed to get ingestion progress")
+	case previous.Version != "" && previous.Version == marketDeals.Version:
+		logger.With("run_id", previous.RunID, "processed", previous.Processed).Info("resuming ingestion")
+		progress = previous
+	}
+
+	now := time.Now()
+	nowEpoch := model.TimeToEpoch(now)
+	stats := Stats{Skipped: progress.Processed, Archived: make(map[string]int64), start: now}
+	models := make([]mongo.WriteModel, 0, 2*batchSize)
+	archiveModels := make([]mongo.WriteModel, 0, batchSize)
+	var archiveIDs []int32
+	flush := func() error {
+		if len(archiveModels) == 0 && len(models) == 0 {
+			return nil
+		}
+
+		if len(archiveModels) > 0 {
+			_, err := archiveCollection.BulkWrite(ctx, archiveModels, options.BulkWrite().SetOrdered(false))
+			if err != nil {
+				return errors.Wrap(err, "failed to write deals into archive")
+			}
+
+			_, err = collection.DeleteMany(ctx, bson.M{"deal_id": bson.M{"$in": archiveIDs}})
+			if err != nil {
+				return errors.Wrap(err, "failed to delete archived deals")
+			}
+
+			archiveModels = archiveModels[:0]
+			archiveIDs = archiveIDs[:0]
+		}
+
+		if len(models) > 0 {
+			// The updates of the existing deals are written before the upserts, so that each count comes from
+			// its own bulk write whatever the order of the models within them
+			updates := make([]mongo.WriteModel, 0, len(models)/2)
+			upserts := make([]mongo.WriteModel, 0, len(models)/2)
+			for i := 0; i < len(models); i += 2 {
+				updates = append(updates, models[i])
+				upserts = append(upserts, models[i+1])
+			}
+
+			result, err := collection.BulkWrite(ctx, updates, options.BulkWrite().SetOrdered(false))
+			if err != nil {
+				return errors.Wrap(err, "failed to update deals in mongo")
+			}
+			stats.Updated += result.MatchedCount
+
+			result, err = collection.BulkWrite(ctx, upserts, options.BulkWrite().SetOrdered(false))
+			if err != nil {
+				return errors.Wrap(err, "failed to upsert deals into mongo")
+			}
+			stats.Inserted += result.UpsertedCount
+			models = models[:0]
+		}
 
-	dealIDSet := make(map[int32]model.DealIDLastUpdated)
-	for dealIDCursor.Next(ctx) {
-		var deal model.DealIDLastUpdated
-		err = dealIDCursor.Decode(&deal)
+		progress.Processed = stats.Processed
+		progress.UpdatedAt = time.Now()
+		_, err := progressCollection.ReplaceOne(ctx, bson.M{"_id": source}, progress, options.Replace().SetUpsert(true))
 		if err != nil {
-			return errors.Wrap(err, "failed to decode deal id")
+			return errors.Wrap(err, "failed to save ingestion progress")
 		}
 
-		dealIDSet[deal.DealID] = deal
+		logger.With("processed", stats.Processed, "inserted", stats.Inserted, "updated", stats.Updated,
+			"archived", stats.Archived, "deals_per_second", stats.Throughput()).Info("wrote batch of deals into mongo")
+		return nil
 	}
 
-	logger.Info("getting deals from state market deals")
-	req, err := http.NewRequestWithContext(ctx,
-		http.MethodGet,
-		"https://marketdeals.s3.amazonaws.com/StateMarketDeals.json.zst",
-		nil)
+	err = decodeDeals(marketDeals, func(deal model.DealState) error {
+		stats.Processed++
+		if stats.Processed <= stats.Skipped {
+			return nil
+		}
+
+		if reason := archiveReason(deal, nowEpoch); reason != "" {
+			stats.Archived[reason]++
+			archiveModels = append(archiveModels, archiveWriteModel(deal, reason, now))
+			archiveIDs = append(archiveIDs, deal.DealID)
+		} else {
+			models = append(models, dealWriteModels(deal, progress.RunID)...)
+		}
+
+		if len(models) >= 2*batchSize || len(archiveModels) >= batchSize {
+			return flush()
+		}
+		return nil
+	})
 	if err != nil {
-		return errors.Wrap(err, "failed to create request")
+		return err
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	err = flush()
 	if err != nil {
-		return errors.Wrap(err, "failed to make request")
+		return err
 	}
 
-	defer resp.Body.Close()
+	// Deals that have not been seen in this run are no longer in the snapshot
+	result, err := collection.UpdateMany(ctx,
+		bson.M{"snapshot_run": bson.M{"$ne": progress.RunID}, "inactive": bson.M{"$ne": true}},
+		bson.M{"$set": bson.M{"inactive": true}})
+	if err != nil {
+		return errors.Wrap(err, "failed to mark missing deals as inactive")
+	}
+	stats.Inactive = result.ModifiedCount
 
-	if resp.StatusCode != http.StatusOK {
-		return errors.Errorf("failed to get state market deals: %s", resp.Status)
+	// Move the remaining ended, slashed and missing deals out of the live collection
+	for _, rule := range archiveRules(nowEpoch) {
+		archived, err := archiveDeals(ctx, collection, archiveCollection, rule.match, rule.reason, now)
+		if err != nil {
+			return err
+		}
+		stats.Archived[rule.reason] += archived
 	}
 
-	decompressor, err := zstd.NewReader(resp.Body)
+	logger.With("processed", stats.Processed, "inserted", stats.Inserted, "updated", stats.Updated,
+		"inactive", stats.Inactive, "archived", stats.Archived, "duration", time.Since(stats.start),
+		"deals_per_second", stats.Throughput()).
+		Info("finished ingesting deals into mongo")
+
+	_, err = progressCollection.DeleteOne(ctx, bson.M{"_id": source})
 	if err != nil {
-		return errors.Wrap(err, "failed to create decompressor")
+		return errors.Wrap(err, "failed to clear ingestion progress")
 	}
 
-	defer decompressor.Close()
+	if marketDeals.Version == "" {
+		return nil
+	}
 
-	jsonDecoder := jstream.NewDecoder(decompressor, 1).EmitKV()
-	insertCount := 0
-	updateCount := 0
-	dealBatch := make([]interface{}, 0, batchSize)
+	return metaStore.SetVersion(ctx, source, marketDeals.Version)
+}
+
+// dealWriteModels returns the upserts of a deal. The first one only replaces the deal if it has been updated since,
+// the second one inserts the deal if it does not exist yet and marks it as seen in the run.
+func dealWriteModels(deal model.DealState, runID string) []mongo.WriteModel {
+	return []mongo.WriteModel{
+		mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"deal_id": deal.DealID, "last_updated": bson.M{"$lt": deal.LastUpdated}}).
+			SetUpdate(bson.M{"$set": deal}),
+		mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"deal_id": deal.DealID}).
+			SetUpdate(bson.M{
+				"$setOnInsert": deal,
+				"$set":         bson.M{"snapshot_run": runID},
+				"$unset":       bson.M{"inactive": ""},
+			}).
+			SetUpsert(true),
+	}
+}
+
+// decodeDeals streams the deals of a decompressed StateMarketDeals snapshot to yield.
+func decodeDeals(r io.Reader, yield func(model.DealState) error) error {
+	jsonDecoder := jstream.NewDecoder(r, 1).EmitKV()
 	for stream := range jsonDecoder.Stream() {
 		keyValuePair, ok := stream.Value.(jstream.KV)
 
@@ -100,7 +272,7 @@ func refresh(ctx context.Context) error {
 		}
 
 		var deal rpc.Deal
-		err = mapstructure.Decode(keyValuePair.Value, &deal)
+		err := mapstructure.Decode(keyValuePair.Value, &deal)
 		if err != nil {
 			return errors.Wrap(err, "failed to decode deal")
 		}
@@ -110,7 +282,7 @@ func refresh(ctx context.Context) error {
 			return errors.Wrap(err, "failed to convert deal id to int")
 		}
 
-		newDeal := model.DealState{
+		err = yield(model.DealState{
 			DealID:      int32(dealID),
 			PieceCID:    deal.Proposal.PieceCID.Root,
 			PieceSize:   deal.Proposal.PieceSize,
@@ -123,54 +295,12 @@ func refresh(ctx context.Context) error {
 			SectorStart: deal.State.SectorStartEpoch,
 			Slashed:     deal.State.SlashEpoch,
 			LastUpdated: deal.State.LastUpdatedEpoch,
-		}
-		// If the deal exists but the last_updated has changed, update it
-		existing, ok := dealIDSet[int32(dealID)]
-		if ok {
-			if deal.State.LastUpdatedEpoch > existing.LastUpdated {
-				logger.With("deal_id", dealID).
-					Debugf("updating deal as lastUpdated Changed from %d to %d", existing.LastUpdated, deal.State.LastUpdatedEpoch)
-				updateCount += 1
-				result, err := collection.ReplaceOne(ctx, bson.D{{"_id", existing.ID}}, newDeal)
-				if err != nil {
-					return errors.Wrap(err, "failed to update deal")
-				}
-				if result.MatchedCount == 0 {
-					return errors.Errorf("failed to update deal: %d", dealID)
-				}
-			}
-			continue
-		}
-
-		// Insert into mongo as the deal is not in mongo
-		dealBatch = append(dealBatch, newDeal)
-		logger.With("deal_id", dealID).
-			Debug("inserting deal state into mongo")
-
-		if len(dealBatch) == batchSize {
-			logger.With("last", dealID).
-				Infof("inserting %d deal state into mongo", batchSize)
-			_, err := collection.InsertMany(ctx, dealBatch)
-			if err != nil {
-				return errors.Wrap(err, "failed to insert deal into mongo")
-			}
-
-			insertCount += len(dealBatch)
-			dealBatch = make([]interface{}, 0, batchSize)
-		}
-	}
-
-	if len(dealBatch) > 0 {
-		logger.Infof("inserting %d deal state into mongo", len(dealBatch))
-		_, err := collection.InsertMany(ctx, dealBatch)
+		})
 		if err != nil {
-			return errors.Wrap(err, "failed to insert deal into mongo")
+			return err
 		}
-
-		insertCount += len(dealBatch)
 	}
 
-	logger.With("count", insertCount, "update", updateCount).Info("finished inserting deals into mongo")
 	if jsonDecoder.Err() != nil {
 		logger.With("position", jsonDecoder.Pos()).Warn("prematurely reached end of json stream")
 		return errors.Wrap(jsonDecoder.Err(), "failed to decode json further")
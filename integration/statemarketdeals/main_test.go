@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/model"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/snapshot"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestDecodeDealsFromFixture(t *testing.T) {
+	marketDeals, err := snapshot.Open(context.Background(), "testdata/StateMarketDeals.json", "")
+	assert.NoError(t, err)
+	defer marketDeals.Close()
+
+	var deals []model.DealState
+	err = decodeDeals(marketDeals, func(deal model.DealState) error {
+		deals = append(deals, deal)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []model.DealState{
+		{
+			DealID:      1,
+			PieceCID:    "baga6ea4seaqhvtixhcqowbx2jadbnzvhgqbzyc7zyawhyjeqqtbcrzpbkm2fwma",
+			PieceSize:   34359738368,
+			Label:       "bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi",
+			Verified:    true,
+			Client:      "f01000",
+			Provider:    "f02000",
+			Start:       1000,
+			End:         2000,
+			SectorStart: 1100,
+			Slashed:     -1,
+			LastUpdated: 1200,
+		},
+		{
+			DealID:      2,
+			PieceCID:    "baga6ea4seaqao7s73y24kcutaosvacpdjgfe5pw76ooefnyqw4ynr3d2y6x2mpq",
+			PieceSize:   2048,
+			Client:      "f01001",
+			Provider:    "f02001",
+			Start:       3000,
+			End:         4000,
+			SectorStart: -1,
+			Slashed:     -1,
+			LastUpdated: -1,
+		},
+	}, deals)
+}
+
+func TestDealWriteModels(t *testing.T) {
+	deal := model.DealState{DealID: 1, LastUpdated: 100}
+	models := dealWriteModels(deal, "run")
+	assert.Len(t, models, 2)
+
+	update, ok := models[0].(*mongo.UpdateOneModel)
+	assert.True(t, ok)
+	assert.Equal(t, bson.M{"deal_id": int32(1), "last_updated": bson.M{"$lt": int32(100)}}, update.Filter)
+	assert.Nil(t, update.Upsert)
+
+	upsert, ok := models[1].(*mongo.UpdateOneModel)
+	assert.True(t, ok)
+	assert.Equal(t, bson.M{"deal_id": int32(1)}, upsert.Filter)
+	assert.True(t, *upsert.Upsert)
+	assert.Equal(t, bson.M{"snapshot_run": "run"}, upsert.Update.(bson.M)["$set"])
+}
@@ -0,0 +1,92 @@
+package campaign
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/model"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const claimKeyPrefix = "claim/"
+
+//nolint:gochecknoglobals
+var claimProjection = bson.M{
+	"claim_id":   1,
+	"piece_cid":  1,
+	"piece_size": 1,
+	"client":     1,
+	"provider":   1,
+	"term_start": 1,
+}
+
+// ClaimMatch returns the claims filter of the claims that have not expired and pass the filters.
+// Verified is ignored as every claim is verified.
+func (f Filters) ClaimMatch(now time.Time) bson.M {
+	match := bson.M{
+		"term_start": f.activationMatch(now),
+		"expiration": bson.M{"$gt": model.TimeToEpoch(now)},
+	}
+	f.addParties(match)
+	return match
+}
+
+// ClaimCandidate converts a verified registry claim. Claims only carry the piece CID,
+// so they are only tested by the modules that retrieve pieces.
+func ClaimCandidate(document model.Claim) Candidate {
+	return Candidate{
+		Provider:    document.Provider,
+		Client:      document.Client,
+		ActivatedAt: model.EpochToTime(document.TermStart),
+		PieceCID:    document.PieceCID,
+		PieceSize:   document.PieceSize,
+		Metadata: map[string]string{
+			"claim_id": strconv.FormatUint(document.ClaimID, 10),
+			"client":   document.Client,
+		},
+	}
+}
+
+// ClaimSource yields the active claims in the claims collection that pass the filters, in claim_id order,
+// so that the seed recorded on the tasks picks the same candidates as long as the population does not change.
+type ClaimSource struct {
+	collection *mongo.Collection
+	filters    Filters
+}
+
+func NewClaimSource(collection *mongo.Collection, filters Filters) *ClaimSource {
+	return &ClaimSource{
+		collection: collection,
+		filters:    filters,
+	}
+}
+
+func (s *ClaimSource) Candidates(ctx context.Context, yield func(Candidate) error) error {
+	match := s.filters.ClaimMatch(time.Now())
+	cursor, err := s.collection.Find(ctx, match, options.Find().
+		SetProjection(claimProjection).
+		SetBatchSize(dealBatchSize).
+		SetSort(bson.D{{Key: "claim_id", Value: 1}}))
+	if err != nil {
+		return errors.Wrap(err, "failed to get claims")
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var document model.Claim
+		err = cursor.Decode(&document)
+		if err != nil {
+			return errors.Wrap(err, "failed to decode claim")
+		}
+
+		if err := yield(ClaimCandidate(document)); err != nil {
+			return err
+		}
+	}
+
+	return errors.Wrap(cursor.Err(), "failed to read claims")
+}
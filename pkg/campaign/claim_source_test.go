@@ -0,0 +1,37 @@
+package campaign
+
+import (
+	"testing"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestClaimCandidate(t *testing.T) {
+	candidate := ClaimCandidate(model.Claim{
+		ClaimID:   7,
+		Provider:  "f02000",
+		Client:    "f01000",
+		PieceCID:  "baga6ea4seaqhvtixhcqowbx2jadbnzvhgqbzyc7zyawhyjeqqtbcrzpbkm2fwma",
+		PieceSize: 2048,
+		TermStart: 100,
+	})
+
+	assert.Equal(t, "f02000", candidate.Provider)
+	assert.Equal(t, "", candidate.PayloadCID)
+	assert.Equal(t, model.EpochToTime(100), candidate.ActivatedAt)
+	assert.Equal(t, map[string]string{"claim_id": "7", "client": "f01000"}, candidate.Metadata)
+	assert.Equal(t, "claim/7", candidate.Key())
+}
+
+func TestClaimMatch(t *testing.T) {
+	now := time.Now()
+	match := Filters{Clients: []string{"f01000"}, MinAge: Duration(time.Hour)}.ClaimMatch(now)
+	assert.Equal(t, bson.M{
+		"term_start": bson.M{"$gt": 0, "$lte": model.TimeToEpoch(now.Add(-time.Hour))},
+		"expiration": bson.M{"$gt": model.TimeToEpoch(now)},
+		"client":     bson.M{"$in": []string{"f01000"}},
+	}, match)
+}
@@ -0,0 +1,182 @@
+package campaign
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// CoverageSLA requires each provider to be tested with the module at least once every period.
+type CoverageSLA struct {
+	Module task.ModuleName
+	Every  time.Duration
+}
+
+// ParseCoverageSLAs parses a comma separated list of module=duration, e.g. "http=24h,graphsync=72h".
+func ParseCoverageSLAs(value string) ([]CoverageSLA, error) {
+	var slas []CoverageSLA
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		module, every, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, errors.Errorf("invalid SLA %s, expected module=duration", item)
+		}
+		duration, err := time.ParseDuration(every)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid SLA duration %s", every)
+		}
+		// The coverage pipeline only tests deals with DealModules
+		if !dealModule(task.ModuleName(module)) {
+			return nil, errors.Errorf("unknown module %s in SLA %s", module, item)
+		}
+		slas = append(slas, CoverageSLA{Module: task.ModuleName(module), Every: duration})
+	}
+	return slas, nil
+}
+
+func dealModule(name task.ModuleName) bool {
+	for _, module := range DealModules {
+		if module.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// LastTested maps provider and module to the time of the latest result.
+type LastTested map[string]map[task.ModuleName]time.Time
+
+type lastTestedRow struct {
+	ID struct {
+		Provider string          `bson:"provider"`
+		Module   task.ModuleName `bson:"module"`
+	} `bson:"_id"`
+	LastTested time.Time `bson:"last_tested"`
+}
+
+// untestedErrorCodes are the errors of the providers that could not be tested at all, such as the error results
+// recorded by the pipeline. Those results do not count as tests.
+//
+//nolint:gochecknoglobals
+var untestedErrorCodes = bson.A{task.InvalidPeerID, task.NoValidMultiAddrs}
+
+// GetLastTested reads the latest result of each provider and module in task_result since the given time,
+// whatever the requester.
+func GetLastTested(ctx context.Context, resultCollection *mongo.Collection, since time.Time) (LastTested, error) {
+	return getLatest(ctx, resultCollection, lastTestedMatch(since), "task.")
+}
+
+// lastTestedMatch selects the results since the given time of the providers that could be tested.
+func lastTestedMatch(since time.Time) bson.M {
+	return bson.M{
+		"created_at":        bson.M{"$gte": since},
+		"result.error_code": bson.M{"$nin": untestedErrorCodes},
+	}
+}
+
+// GetPending returns the providers and modules that still have tasks of the requester in the queue.
+func GetPending(ctx context.Context, taskCollection *mongo.Collection, requester string) (LastTested, error) {
+	return getLatest(ctx, taskCollection, bson.M{"requester": requester}, "")
+}
+
+// latestGroup groups the documents by provider and module. The task is at the prefix of the document, "task." in
+// task_result and none in task_queue, while created_at is at the root of both.
+func latestGroup(prefix string) bson.M {
+	return bson.M{
+		"_id":         bson.M{"provider": "$" + prefix + "provider.id", "module": "$" + prefix + "module"},
+		"last_tested": bson.M{"$max": "$created_at"},
+	}
+}
+
+func getLatest(ctx context.Context, collection *mongo.Collection, match bson.M, prefix string) (LastTested, error) {
+	cursor, err := collection.Aggregate(ctx, bson.A{
+		bson.M{"$match": match},
+		bson.M{"$group": latestGroup(prefix)},
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to aggregate %s", collection.Name())
+	}
+
+	var rows []lastTestedRow
+	err = cursor.All(ctx, &rows)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode %s", collection.Name())
+	}
+
+	latest := make(LastTested)
+	for _, row := range rows {
+		if latest[row.ID.Provider] == nil {
+			latest[row.ID.Provider] = make(map[task.ModuleName]time.Time)
+		}
+		latest[row.ID.Provider][row.ID.Module] = row.LastTested
+	}
+	return latest, nil
+}
+
+// Overdue returns the modules whose SLA the provider misses at the given time, skipping modules that are
+// already pending in the queue.
+func (l LastTested) Overdue(provider string, slas []CoverageSLA, pending LastTested, now time.Time) []task.ModuleName {
+	var overdue []task.ModuleName
+	for _, sla := range slas {
+		if _, ok := pending[provider][sla.Module]; ok {
+			continue
+		}
+		last, ok := l[provider][sla.Module]
+		if !ok || now.Sub(last) > sla.Every {
+			overdue = append(overdue, sla.Module)
+		}
+	}
+	return overdue
+}
+
+// GetActiveProviders returns the providers with active deals that pass the filters.
+func GetActiveProviders(ctx context.Context, marketDeals *mongo.Collection, filters Filters) ([]string, error) {
+	values, err := marketDeals.Distinct(ctx, "provider", filters.Match(time.Now()))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get providers with active deals")
+	}
+
+	providers := make([]string, 0, len(values))
+	for _, value := range values {
+		if provider, ok := value.(string); ok {
+			providers = append(providers, provider)
+		}
+	}
+	sort.Strings(providers)
+	return providers, nil
+}
+
+// CoverageCandidate picks the candidate to test the overdue modules with. Payload modules need a candidate
+// with a payload CID, so one is preferred if any payload module is overdue.
+func CoverageCandidate(candidates []Candidate, modules []task.ModuleName) (Candidate, bool) {
+	needsPayload := false
+	for _, module := range modules {
+		if module == task.GraphSync || module == task.Bitswap {
+			needsPayload = true
+		}
+	}
+
+	for _, candidate := range candidates {
+		if !needsPayload || candidate.PayloadCID != "" {
+			candidate.Modules = modules
+			return candidate, true
+		}
+	}
+
+	if len(candidates) == 0 {
+		return Candidate{}, false
+	}
+
+	candidate := candidates[0]
+	candidate.Modules = modules
+	return candidate, true
+}
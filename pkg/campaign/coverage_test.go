@@ -0,0 +1,108 @@
+package campaign
+
+import (
+	"testing"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/testutil/bsonmatch"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseCoverageSLAs(t *testing.T) {
+	slas, err := ParseCoverageSLAs("http=24h, graphsync=72h")
+	assert.NoError(t, err)
+	assert.Equal(t, []CoverageSLA{{Module: task.HTTP, Every: 24 * time.Hour},
+		{Module: task.GraphSync, Every: 72 * time.Hour}}, slas)
+
+	_, err = ParseCoverageSLAs("http")
+	assert.Error(t, err)
+	_, err = ParseCoverageSLAs("http=daily")
+	assert.Error(t, err)
+	_, err = ParseCoverageSLAs("htpp=24h")
+	assert.Error(t, err)
+	_, err = ParseCoverageSLAs("stub=24h")
+	assert.Error(t, err)
+}
+
+func TestLastTestedFields(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	result := func(errorCode task.ErrorCode, createdAt time.Time) task.Result {
+		return task.Result{
+			Task: task.Task{
+				Module:    task.HTTP,
+				Provider:  task.Provider{ID: "f01000"},
+				CreatedAt: createdAt.Add(-time.Minute),
+			},
+			Result:    task.RetrievalResult{Success: errorCode == task.ErrorCodeNone, ErrorCode: errorCode},
+			CreatedAt: createdAt,
+		}
+	}
+	since := now.Add(-time.Hour)
+	for _, tc := range []struct {
+		result  task.Result
+		matched bool
+	}{
+		{result(task.ErrorCodeNone, now), true},
+		{result(task.Timeout, now), true},
+		{result(task.ErrorCodeNone, now.Add(-2*time.Hour)), false},
+		{result(task.InvalidPeerID, now), false},
+		{result(task.NoValidMultiAddrs, now), false},
+	} {
+		matched, err := bsonmatch.Match(tc.result, lastTestedMatch(since))
+		assert.NoError(t, err)
+		assert.Equal(t, tc.matched, matched, tc.result.Result.ErrorCode)
+	}
+
+	assertGroup := func(document interface{}, prefix string) {
+		group := latestGroup(prefix)
+		id := group["_id"].(bson.M)
+		provider, exists, err := bsonmatch.Lookup(document, id["provider"].(string))
+		assert.NoError(t, err)
+		assert.True(t, exists)
+		assert.Equal(t, "f01000", provider.StringValue())
+		module, exists, err := bsonmatch.Lookup(document, id["module"].(string))
+		assert.NoError(t, err)
+		assert.True(t, exists)
+		assert.Equal(t, "http", module.StringValue())
+		createdAt, exists, err := bsonmatch.Lookup(document, group["last_tested"].(bson.M)["$max"].(string))
+		assert.NoError(t, err)
+		assert.True(t, exists)
+		assert.Equal(t, now, createdAt.Time().UTC())
+	}
+	assertGroup(result(task.ErrorCodeNone, now), "task.")
+	pending := result(task.ErrorCodeNone, now).Task
+	pending.CreatedAt = now
+	assertGroup(pending, "")
+}
+
+func TestOverdue(t *testing.T) {
+	now := time.Now()
+	slas := []CoverageSLA{{Module: task.HTTP, Every: 24 * time.Hour}, {Module: task.Bitswap, Every: 72 * time.Hour}}
+	lastTested := LastTested{
+		"f01000": {task.HTTP: now.Add(-time.Hour), task.Bitswap: now.Add(-100 * time.Hour)},
+		"f02000": {task.HTTP: now.Add(-25 * time.Hour)},
+	}
+	pending := LastTested{"f02000": {task.Bitswap: now}}
+
+	assert.Equal(t, []task.ModuleName{task.Bitswap}, lastTested.Overdue("f01000", slas, pending, now))
+	assert.Equal(t, []task.ModuleName{task.HTTP}, lastTested.Overdue("f02000", slas, pending, now))
+	assert.Equal(t, []task.ModuleName{task.HTTP, task.Bitswap}, lastTested.Overdue("f03000", slas, pending, now))
+}
+
+func TestCoverageCandidate(t *testing.T) {
+	deals := []Candidate{{PieceCID: "piece1"}, {PieceCID: "piece2", PayloadCID: "payload2"}}
+
+	candidate, ok := CoverageCandidate(deals, []task.ModuleName{task.HTTP})
+	assert.True(t, ok)
+	assert.Equal(t, "piece1", candidate.PieceCID)
+	assert.Equal(t, []task.ModuleName{task.HTTP}, candidate.Modules)
+
+	candidate, ok = CoverageCandidate(deals, []task.ModuleName{task.HTTP, task.GraphSync})
+	assert.True(t, ok)
+	assert.Equal(t, "payload2", candidate.PayloadCID)
+
+	_, ok = CoverageCandidate(nil, []task.ModuleName{task.HTTP})
+	assert.False(t, ok)
+}
@@ -0,0 +1,197 @@
+package campaign
+
+import (
+	"context"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/model"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const dealBatchSize = 10000
+
+// Only the fields needed to build a candidate are read when streaming the whole population
+//
+//nolint:gochecknoglobals
+var dealProjection = bson.M{
+	"deal_id":      1,
+	"piece_cid":    1,
+	"piece_size":   1,
+	"label":        1,
+	"client":       1,
+	"provider":     1,
+	"sector_start": 1,
+}
+
+type totalPerClient struct {
+	Client string `bson:"_id"`
+	Total  int64  `bson:"total"`
+}
+
+// Match returns the state_market_deals filter of active deals that pass the filters.
+func (f Filters) Match(now time.Time) bson.M {
+	match := bson.M{
+		"sector_start": f.activationMatch(now),
+		"end":          bson.M{"$gt": model.TimeToEpoch(now)},
+		"slashed":      bson.M{"$lt": 0},
+		"inactive":     bson.M{"$ne": true},
+	}
+	if f.Verified != nil {
+		match["verified"] = *f.Verified
+	}
+	f.addParties(match)
+	return match
+}
+
+// activationMatch filters the activation epoch by the age bounds.
+func (f Filters) activationMatch(now time.Time) bson.M {
+	activation := bson.M{"$gt": 0}
+	if f.MinAge > 0 {
+		activation["$lte"] = model.TimeToEpoch(now.Add(-time.Duration(f.MinAge)))
+	}
+	if f.MaxAge > 0 {
+		activation["$gte"] = model.TimeToEpoch(now.Add(-time.Duration(f.MaxAge)))
+	}
+	return activation
+}
+
+func (f Filters) addParties(match bson.M) {
+	if len(f.Clients) > 0 {
+		match["client"] = bson.M{"$in": f.Clients}
+	}
+	if len(f.Providers) > 0 {
+		match["provider"] = bson.M{"$in": f.Providers}
+	}
+}
+
+// GetTotalPerClient returns the total piece size of the deals or claims matching the filter for each client.
+func GetTotalPerClient(ctx context.Context, collection *mongo.Collection, match bson.M) (map[string]int64, error) {
+	var result []totalPerClient
+	agg, err := collection.Aggregate(ctx, []bson.M{
+		{"$match": match},
+		{
+			"$group": bson.M{
+				"_id": "$client",
+				"total": bson.M{
+					"$sum": "$piece_size",
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to aggregate market deals")
+	}
+
+	err = agg.All(ctx, &result)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode market deals")
+	}
+
+	totals := make(map[string]int64)
+	for _, r := range result {
+		totals[r.Client] = r.Total
+	}
+
+	return totals, nil
+}
+
+// MarketDealSource yields the active deals in state_market_deals that pass the filters in deal_id order,
+// so that a seeded sampler picks the same candidates as long as the population does not change,
+// or a random sample of them if sampleSize is set.
+type MarketDealSource struct {
+	collection *mongo.Collection
+	filters    Filters
+	sampleSize int
+}
+
+func NewMarketDealSource(collection *mongo.Collection, filters Filters, sampleSize int) *MarketDealSource {
+	return &MarketDealSource{
+		collection: collection,
+		filters:    filters,
+		sampleSize: sampleSize,
+	}
+}
+
+func (s *MarketDealSource) Candidates(ctx context.Context, yield func(Candidate) error) error {
+	match := s.filters.Match(time.Now())
+	var aggregateResult *mongo.Cursor
+	var err error
+	if s.sampleSize > 0 {
+		aggregateResult, err = s.collection.Aggregate(ctx, bson.A{
+			bson.M{"$match": match},
+			bson.M{"$sample": bson.M{"size": s.sampleSize}},
+			bson.M{"$project": dealProjection},
+		})
+	} else {
+		aggregateResult, err = s.collection.Find(ctx, match, options.Find().
+			SetProjection(dealProjection).
+			SetBatchSize(dealBatchSize).
+			SetSort(bson.D{{Key: "deal_id", Value: 1}}))
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to get documents")
+	}
+	defer aggregateResult.Close(ctx)
+
+	for aggregateResult.Next(ctx) {
+		var document model.DealState
+		err = aggregateResult.Decode(&document)
+		if err != nil {
+			return errors.Wrap(err, "failed to decode document")
+		}
+
+		candidate, ok := DealCandidate(document)
+		if !ok {
+			continue
+		}
+		if err := yield(candidate); err != nil {
+			return err
+		}
+	}
+
+	return errors.Wrap(aggregateResult.Err(), "failed to read documents")
+}
+
+// Fields of task_result holding the deal and claim of a task
+const (
+	resultDealIDField  = "task.metadata.deal_id"
+	resultClaimIDField = "task.metadata.claim_id"
+)
+
+// testedFilter selects the results of the requester in task_result.
+func testedFilter(requester string) bson.M {
+	return bson.M{"task.requester": requester}
+}
+
+// GetTestedDeals returns the keys of the deals and claims that have a result of the requester in task_result.
+func GetTestedDeals(
+	ctx context.Context,
+	resultCollection *mongo.Collection,
+	requester string,
+) (map[string]struct{}, error) {
+	values, err := resultCollection.Distinct(ctx, resultDealIDField, testedFilter(requester))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get tested deals")
+	}
+
+	claimValues, err := resultCollection.Distinct(ctx, resultClaimIDField, testedFilter(requester))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get tested claims")
+	}
+
+	tested := make(map[string]struct{}, len(values)+len(claimValues))
+	for _, value := range values {
+		if dealID, ok := value.(string); ok {
+			tested[dealID] = struct{}{}
+		}
+	}
+	for _, value := range claimValues {
+		if claimID, ok := value.(string); ok {
+			tested[claimKeyPrefix+claimID] = struct{}{}
+		}
+	}
+	return tested, nil
+}
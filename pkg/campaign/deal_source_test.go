@@ -0,0 +1,33 @@
+package campaign
+
+import (
+	"testing"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/testutil/bsonmatch"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTestedDealsFields(t *testing.T) {
+	result := task.Result{Task: task.Task{
+		Requester: "filplus",
+		Module:    task.HTTP,
+		Metadata:  map[string]string{"deal_id": "7", "claim_id": "8"},
+	}}
+
+	matched, err := bsonmatch.Match(result, testedFilter("filplus"))
+	assert.NoError(t, err)
+	assert.True(t, matched)
+	matched, err = bsonmatch.Match(result, testedFilter("other"))
+	assert.NoError(t, err)
+	assert.False(t, matched)
+
+	dealID, exists, err := bsonmatch.Lookup(result, resultDealIDField)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, "7", dealID.StringValue())
+	claimID, exists, err := bsonmatch.Lookup(result, resultClaimIDField)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, "8", claimID.StringValue())
+}
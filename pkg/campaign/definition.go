@@ -0,0 +1,204 @@
+package campaign
+
+import (
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/pkg/errors"
+	"golang.org/x/exp/slices"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	SourceMarketDeals = "market_deals"
+	SourceClaims      = "claims"
+
+	ContentPayload = "payload"
+	ContentPiece   = "piece"
+)
+
+// Duration accepts Go duration strings such as "15s" or "24h" in YAML and JSON.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return errors.Wrap(err, "duration must be a string")
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return errors.Wrapf(err, "invalid duration %s", s)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Config is the content of a campaign file. JSON files are accepted as well, as JSON is valid YAML.
+type Config struct {
+	Campaigns []Definition `yaml:"campaigns"`
+}
+
+// Definition describes a recurring campaign: where candidates come from, how they are sampled,
+// which modules test them and how often.
+type Definition struct {
+	Name      string `yaml:"name"`
+	Requester string `yaml:"requester"`
+	// How often the campaign runs
+	Cadence Duration `yaml:"cadence"`
+	// Skip a run while the requester still has more than this many tasks queued. 0 means no limit.
+	MaxQueued int64              `yaml:"max_queued"`
+	Source    SourceDefinition   `yaml:"source"`
+	Filters   Filters            `yaml:"filters"`
+	Sampling  SamplingDefinition `yaml:"sampling"`
+	// Default timeout of the tasks
+	Timeout  Duration           `yaml:"timeout"`
+	Modules  []ModuleDefinition `yaml:"modules"`
+	Metadata map[string]string  `yaml:"metadata"`
+}
+
+type SourceDefinition struct {
+	Type string `yaml:"type"`
+}
+
+type Filters struct {
+	Verified  *bool    `yaml:"verified"`
+	Clients   []string `yaml:"clients"`
+	Providers []string `yaml:"providers"`
+	// Age of the deal since its sector was activated
+	MinAge Duration `yaml:"min_age"`
+	MaxAge Duration `yaml:"max_age"`
+}
+
+type SamplingDefinition struct {
+	Strategy string `yaml:"strategy"`
+	// Number of candidates picked from the source
+	Size int `yaml:"size"`
+	// Constant c of the c^-age decay used by the weighted and age_decayed strategies
+	AgeDecay float64 `yaml:"age_decay"`
+	// Seed of the random source. If 0, a new seed is drawn for every run. It is recorded on the tasks either way.
+	Seed int64 `yaml:"seed"`
+}
+
+type ModuleDefinition struct {
+	Name     task.ModuleName   `yaml:"name"`
+	Metadata map[string]string `yaml:"metadata"`
+	Timeout  Duration          `yaml:"timeout"`
+	// Which CID is retrieved, either payload or piece. Defaults to piece for http and payload otherwise.
+	Content string `yaml:"content"`
+}
+
+func ParseConfig(data []byte) (Config, error) {
+	var config Config
+	err := yaml.Unmarshal(data, &config)
+	if err != nil {
+		return Config{}, errors.Wrap(err, "failed to parse campaign config")
+	}
+
+	names := make(map[string]struct{})
+	for i := range config.Campaigns {
+		definition := &config.Campaigns[i]
+		definition.setDefaults()
+		if err := definition.Validate(); err != nil {
+			return Config{}, errors.Wrapf(err, "invalid campaign %s", definition.Name)
+		}
+		if _, ok := names[definition.Name]; ok {
+			return Config{}, errors.Errorf("duplicate campaign %s", definition.Name)
+		}
+		names[definition.Name] = struct{}{}
+	}
+
+	return config, nil
+}
+
+func (d *Definition) setDefaults() {
+	if d.Requester == "" {
+		d.Requester = d.Name
+	}
+	if d.Cadence == 0 {
+		d.Cadence = Duration(time.Minute)
+	}
+	if d.Timeout == 0 {
+		d.Timeout = Duration(15 * time.Second)
+	}
+	if d.Source.Type == "" {
+		d.Source.Type = SourceMarketDeals
+	}
+	if d.Sampling.Strategy == "" {
+		d.Sampling.Strategy = SamplingWeighted
+	}
+	if d.Sampling.Size == 0 {
+		d.Sampling.Size = 50
+	}
+	if d.Sampling.AgeDecay == 0 {
+		d.Sampling.AgeDecay = 4
+	}
+	for i := range d.Modules {
+		if d.Modules[i].Content == "" {
+			d.Modules[i].Content = ContentPayload
+			if d.Modules[i].Name == task.HTTP {
+				d.Modules[i].Content = ContentPiece
+			}
+		}
+	}
+}
+
+func (d *Definition) Validate() error {
+	if d.Name == "" {
+		return errors.New("name is required")
+	}
+	if d.Source.Type != SourceMarketDeals && d.Source.Type != SourceClaims {
+		return errors.Errorf("unknown source type %s", d.Source.Type)
+	}
+	if d.Cadence <= 0 {
+		return errors.Errorf("cadence %s must be positive", time.Duration(d.Cadence))
+	}
+	if !slices.Contains(SamplingStrategies, d.Sampling.Strategy) {
+		return errors.Errorf("unknown sampling strategy %s", d.Sampling.Strategy)
+	}
+	if d.Sampling.Size <= 0 {
+		return errors.Errorf("sampling size %d must be positive", d.Sampling.Size)
+	}
+	if d.Sampling.AgeDecay <= 0 {
+		return errors.Errorf("age decay %f must be positive", d.Sampling.AgeDecay)
+	}
+	for _, module := range d.Modules {
+		if !knownModule(module.Name) {
+			return errors.Errorf("unknown module %s", module.Name)
+		}
+		if module.Content != ContentPayload && module.Content != ContentPiece {
+			return errors.Errorf("unknown content %s of module %s", module.Content, module.Name)
+		}
+	}
+	return nil
+}
+
+func knownModule(name task.ModuleName) bool {
+	switch name {
+	case task.GraphSync, task.Bitswap, task.HTTP, task.Stub:
+		return true
+	default:
+		return false
+	}
+}
+
+// PipelineModules converts the module definitions, falling back to DealModules if none is set.
+func (d *Definition) PipelineModules() []Module {
+	if len(d.Modules) == 0 {
+		return DealModules
+	}
+
+	modules := make([]Module, len(d.Modules))
+	for i, definition := range d.Modules {
+		content := PayloadContent
+		if definition.Content == ContentPiece {
+			content = PieceContent
+		}
+		modules[i] = Module{
+			Name:     definition.Name,
+			Metadata: definition.Metadata,
+			Timeout:  time.Duration(definition.Timeout),
+			Content:  content,
+		}
+	}
+	return modules
+}
@@ -0,0 +1,75 @@
+package campaign
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConfigExample(t *testing.T) {
+	data, err := os.ReadFile("../../campaigns.example.yaml")
+	assert.NoError(t, err)
+
+	config, err := ParseConfig(data)
+	assert.NoError(t, err)
+	assert.Len(t, config.Campaigns, 2)
+
+	filplus := config.Campaigns[0]
+	assert.Equal(t, Duration(time.Minute), filplus.Cadence)
+	assert.True(t, *filplus.Filters.Verified)
+	modules := filplus.PipelineModules()
+	assert.Len(t, modules, 3)
+	assert.Equal(t, 30*time.Second, modules[2].Timeout)
+	assert.Equal(t, "piece", modules[2].Content(Candidate{PieceCID: "piece", PayloadCID: "payload"}))
+	assert.Equal(t, "payload", modules[0].Content(Candidate{PieceCID: "piece", PayloadCID: "payload"}))
+
+	recent := config.Campaigns[1]
+	assert.Equal(t, "recent-http", recent.Requester)
+	assert.Equal(t, SourceMarketDeals, recent.Source.Type)
+	assert.Equal(t, Duration(15*time.Second), recent.Timeout)
+	assert.Equal(t, Duration(720*time.Hour), recent.Filters.MaxAge)
+}
+
+func TestParseConfigJSON(t *testing.T) {
+	config, err := ParseConfig([]byte(`{"campaigns": [{"name": "a", "cadence": "5m",
+		"modules": [{"name": "http"}]}]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, Duration(5*time.Minute), config.Campaigns[0].Cadence)
+	assert.Equal(t, task.HTTP, config.Campaigns[0].Modules[0].Name)
+	assert.Equal(t, ContentPiece, config.Campaigns[0].Modules[0].Content)
+}
+
+func TestParseConfigInvalid(t *testing.T) {
+	for _, data := range []string{
+		`campaigns: [{name: a, cadence: soon}]`,
+		`campaigns: [{name: a, source: {type: unknown}}]`,
+		`campaigns: [{name: a, sampling: {strategy: unknown}}]`,
+		`campaigns: [{name: a, modules: [{name: ftp}]}]`,
+		`campaigns: [{name: a}, {name: a}]`,
+		`campaigns: [{requester: a}]`,
+		`campaigns: [{name: a, cadence: -1m}]`,
+		`campaigns: [{name: a, sampling: {size: -10}}]`,
+		`campaigns: [{name: a, sampling: {age_decay: -2}}]`,
+	} {
+		_, err := ParseConfig([]byte(data))
+		assert.Error(t, err, data)
+	}
+
+	// Zero values are only valid once the defaults are set
+	definition := Definition{Name: "a"}
+	assert.Error(t, definition.Validate())
+	definition.setDefaults()
+	assert.NoError(t, definition.Validate())
+	for _, invalidate := range []func(d *Definition){
+		func(d *Definition) { d.Cadence = 0 },
+		func(d *Definition) { d.Sampling.Size = 0 },
+		func(d *Definition) { d.Sampling.AgeDecay = 0 },
+	} {
+		invalid := definition
+		invalidate(&invalid)
+		assert.Error(t, invalid.Validate())
+	}
+}
@@ -0,0 +1,77 @@
+package campaign
+
+import (
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+)
+
+// Module describes how a candidate is turned into a task of a retrieval module.
+type Module struct {
+	Name     task.ModuleName
+	Metadata map[string]string
+	// Overrides the timeout of the pipeline if set
+	Timeout time.Duration
+	// Content returns the CID to retrieve. Candidates without one are not tested with this module.
+	Content func(Candidate) string
+}
+
+func PayloadContent(candidate Candidate) string {
+	return candidate.PayloadCID
+}
+
+func PieceContent(candidate Candidate) string {
+	return candidate.PieceCID
+}
+
+// DealModules retrieve the root block of the payload with GraphSync and Bitswap and the first 1MiB of the piece
+// with HTTP.
+//
+//nolint:gochecknoglobals
+var DealModules = []Module{
+	{
+		Name: task.GraphSync,
+		Metadata: map[string]string{
+			"assume_label":  "true",
+			"retrieve_type": "root_block",
+		},
+		Content: PayloadContent,
+	},
+	{
+		Name: task.Bitswap,
+		Metadata: map[string]string{
+			"assume_label":  "true",
+			"retrieve_type": "root_block",
+		},
+		Content: PayloadContent,
+	},
+	{
+		Name: task.HTTP,
+		Metadata: map[string]string{
+			"retrieve_type": "piece",
+			"retrieve_size": "1048576",
+		},
+		Content: PieceContent,
+	},
+}
+
+// RootModules retrieve the root block of a payload CID that is known to be the DAG root, e.g. read from the CAR
+// header of the piece, with GraphSync and Bitswap.
+//
+//nolint:gochecknoglobals
+var RootModules = []Module{
+	{
+		Name: task.GraphSync,
+		Metadata: map[string]string{
+			"retrieve_type": "root_block",
+		},
+		Content: PayloadContent,
+	},
+	{
+		Name: task.Bitswap,
+		Metadata: map[string]string{
+			"retrieve_type": "root_block",
+		},
+		Content: PayloadContent,
+	},
+}
@@ -0,0 +1,387 @@
+package campaign
+
+import (
+	"context"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/convert"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/env"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/requesterror"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/resolver"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/filecoin-project/go-state-types/abi"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/pkg/errors"
+)
+
+var logger = logging.Logger("campaign")
+
+const defaultBatchSize = 1000
+
+type ProviderResolver interface {
+	ResolveProvider(ctx context.Context, provider string) (resolver.MinerInfo, error)
+}
+
+type LocationResolver interface {
+	ResolveAllMultiaddrsBytes(ctx context.Context, addrs []abi.Multiaddrs) ([]resolver.IPInfo, error)
+}
+
+// Pipeline turns the candidates of a Source into tasks: it resolves the provider and its locations,
+// validates the peer ID, fans out to the modules and enqueues tasks, or error results for
+// providers that cannot be tested.
+type Pipeline struct {
+	Requester string
+	Modules   []Module
+	// Added to the metadata of every task and error result, overridden by the candidate metadata
+	Metadata map[string]string
+	Timeout  time.Duration
+	// Number of tasks or results to buffer before they are written to the queue
+	BatchSize int
+
+	providerResolver ProviderResolver
+	locationResolver LocationResolver
+	queue            Queue
+	retriever        task.Retriever
+}
+
+type Stats struct {
+	Candidates   int
+	Tasks        int
+	Results      int
+	Skipped      int
+	PerCountry   map[string]int
+	PerContinent map[string]int
+	PerModule    map[task.ModuleName]int
+	PerProvider  map[string]int
+	// Why no task could be created, by provider
+	Untestable map[string]string
+}
+
+func NewPipeline(
+	requester string,
+	providerResolver ProviderResolver,
+	locationResolver LocationResolver,
+	queue Queue,
+	retriever task.Retriever,
+) *Pipeline {
+	return &Pipeline{
+		Requester:        requester,
+		Modules:          DealModules,
+		Timeout:          15 * time.Second,
+		BatchSize:        defaultBatchSize,
+		providerResolver: providerResolver,
+		locationResolver: locationResolver,
+		queue:            queue,
+		retriever:        retriever,
+	}
+}
+
+// Resolvers holds the resolvers set up from the environment, so integrations can share them.
+type Resolvers struct {
+	Provider *resolver.ProviderResolver
+	Location *resolver.LocationResolver
+}
+
+// NewResolversFromEnv creates the provider and location resolvers with the persistent cache and
+// provider history enabled when configured.
+func NewResolversFromEnv(ctx context.Context) (Resolvers, error) {
+	locationCacheTTL := env.GetDuration(env.LocationCacheTTL, 24*time.Hour)
+	locationResolver := resolver.NewLocationResolver(env.GetRequiredString(env.IPInfoToken), locationCacheTTL)
+	providerResolver, err := resolver.NewProviderResolverFromEnv()
+	if err != nil {
+		return Resolvers{}, errors.Wrap(err, "failed to create provider resolver")
+	}
+
+	err = resolver.EnablePersistentCacheFromEnv(ctx, providerResolver, &locationResolver)
+	if err != nil {
+		return Resolvers{}, errors.Wrap(err, "failed to enable persistent cache")
+	}
+
+	err = resolver.EnableProviderHistoryFromEnv(ctx, providerResolver)
+	if err != nil {
+		return Resolvers{}, errors.Wrap(err, "failed to enable provider history")
+	}
+
+	return Resolvers{Provider: providerResolver, Location: &locationResolver}, nil
+}
+
+// NewRetrieverFromEnv looks up the public IP of this host, which is recorded as the retriever of error results.
+func NewRetrieverFromEnv(ctx context.Context) (task.Retriever, error) {
+	ipInfo, err := resolver.GetPublicIPInfo(ctx, "", "")
+	if err != nil {
+		return task.Retriever{}, errors.Wrap(err, "failed to get public IP info")
+	}
+
+	logger.With("ipinfo", ipInfo).Infof("Public IP info retrieved")
+	return RetrieverFromIPInfo(ipInfo), nil
+}
+
+func RetrieverFromIPInfo(ipInfo resolver.IPInfo) task.Retriever {
+	return task.Retriever{
+		PublicIP:  ipInfo.IP,
+		City:      ipInfo.City,
+		Region:    ipInfo.Region,
+		Country:   ipInfo.Country,
+		Continent: ipInfo.Continent,
+		ASN:       ipInfo.ASN,
+		ISP:       ipInfo.ISP,
+		Latitude:  ipInfo.Latitude,
+		Longitude: ipInfo.Longitude,
+	}
+}
+
+// NewPipelineFromEnv wires the resolvers and the public IP lookup from the environment.
+func NewPipelineFromEnv(ctx context.Context, requester string, queue Queue) (*Pipeline, Resolvers, error) {
+	resolvers, err := NewResolversFromEnv(ctx)
+	if err != nil {
+		return nil, Resolvers{}, err
+	}
+
+	retriever, err := NewRetrieverFromEnv(ctx)
+	if err != nil {
+		return nil, Resolvers{}, err
+	}
+
+	pipeline := NewPipeline(requester, resolvers.Provider, resolvers.Location, queue, retriever)
+	pipeline.Timeout = env.GetDuration(env.FilplusIntegrationTaskTimeout, 15*time.Second)
+	return pipeline, resolvers, nil
+}
+
+func (p *Pipeline) modulesOf(candidate Candidate) []Module {
+	if len(candidate.Modules) == 0 {
+		return p.Modules
+	}
+
+	var modules []Module
+	for _, module := range p.Modules {
+		for _, name := range candidate.Modules {
+			if module.Name == name {
+				modules = append(modules, module)
+			}
+		}
+	}
+	return modules
+}
+
+func (p *Pipeline) timeoutOf(module Module) time.Duration {
+	if module.Timeout > 0 {
+		return module.Timeout
+	}
+	return p.Timeout
+}
+
+func (p *Pipeline) metadataOf(module Module, candidate Candidate) map[string]string {
+	metadata := make(map[string]string)
+	for _, m := range []map[string]string{module.Metadata, p.Metadata, candidate.Metadata} {
+		for k, v := range m {
+			metadata[k] = v
+		}
+	}
+	return metadata
+}
+
+// Build runs all stages for a single candidate. Candidates whose provider cannot be resolved yield neither
+// tasks nor results, as the failure is likely on our side.
+func (p *Pipeline) Build(ctx context.Context, candidate Candidate) ([]task.Task, []task.Result) {
+	tasks, results, _ := p.build(ctx, candidate)
+	return tasks, results
+}
+
+// build also returns why no task could be created for the candidate.
+func (p *Pipeline) build(ctx context.Context, candidate Candidate) ([]task.Task, []task.Result, string) {
+	providerInfo, err := p.providerResolver.ResolveProvider(ctx, candidate.Provider)
+	if err != nil {
+		logger.With("provider", candidate.Provider, "err", err).Error("failed to resolve provider")
+		return nil, nil, "failed to resolve provider: " + err.Error()
+	}
+
+	locations, err := p.locationResolver.ResolveAllMultiaddrsBytes(ctx, providerInfo.Multiaddrs)
+	if err != nil {
+		if errors.As(err, &requesterror.BogonIPError{}) ||
+			errors.As(err, &requesterror.InvalidIPError{}) ||
+			errors.As(err, &requesterror.HostLookupError{}) ||
+			errors.As(err, &requesterror.NoValidMultiAddrError{}) {
+			return nil, p.errorResults(candidate, providerInfo, nil, task.NoValidMultiAddrs, err.Error()),
+				"no valid multiaddrs: " + err.Error()
+		}
+
+		logger.With("provider", candidate.Provider, "err", err).Error("failed to resolve provider location")
+		return nil, nil, "failed to resolve provider location: " + err.Error()
+	}
+
+	_, err = peer.Decode(providerInfo.PeerId)
+	if err != nil {
+		logger.With("provider", candidate.Provider, "peerID", providerInfo.PeerId, "err", err).
+			Info("failed to decode peerID")
+		return nil, p.errorResults(candidate, providerInfo, locations, task.InvalidPeerID, err.Error()),
+			"invalid peer ID: " + err.Error()
+	}
+
+	var tasks []task.Task
+	provider := p.provider(candidate, providerInfo, locations)
+	for _, module := range p.modulesOf(candidate) {
+		content := module.Content(candidate)
+		if content == "" {
+			continue
+		}
+
+		tasks = append(tasks, task.Task{
+			Requester: p.Requester,
+			Module:    module.Name,
+			Metadata:  p.metadataOf(module, candidate),
+			Provider:  provider,
+			Content: task.Content{
+				CID: content,
+			},
+			CreatedAt: time.Now().UTC(),
+			Timeout:   p.timeoutOf(module),
+		})
+	}
+
+	if len(tasks) == 0 {
+		return nil, nil, "no content to retrieve with the requested modules"
+	}
+
+	return tasks, nil, ""
+}
+
+func (p *Pipeline) provider(
+	candidate Candidate,
+	providerInfo resolver.MinerInfo,
+	locations []resolver.IPInfo,
+) task.Provider {
+	location := resolver.PrimaryLocation(locations)
+	return task.Provider{
+		ID:         candidate.Provider,
+		PeerID:     providerInfo.PeerId,
+		Multiaddrs: convert.MultiaddrsBytesToStringArraySkippingError(providerInfo.Multiaddrs),
+		City:       location.City,
+		Region:     location.Region,
+		Country:    location.Country,
+		Continent:  location.Continent,
+		SnapshotID: providerInfo.SnapshotID,
+		Locations:  resolver.TaskLocations(locations),
+	}
+}
+
+// errorResults records a failed result for each module the candidate would have been tested with.
+func (p *Pipeline) errorResults(
+	candidate Candidate,
+	providerInfo resolver.MinerInfo,
+	locations []resolver.IPInfo,
+	errorCode task.ErrorCode,
+	errorMessage string,
+) []task.Result {
+	var results []task.Result
+	provider := p.provider(candidate, providerInfo, locations)
+	for _, module := range p.modulesOf(candidate) {
+		content := module.Content(candidate)
+		if content == "" {
+			continue
+		}
+
+		results = append(results, task.Result{
+			Task: task.Task{
+				Requester: p.Requester,
+				Module:    module.Name,
+				Metadata:  p.metadataOf(module, candidate),
+				Provider:  provider,
+				Content: task.Content{
+					CID: content,
+				},
+				CreatedAt: time.Now().UTC(),
+				Timeout:   p.timeoutOf(module),
+			},
+			Retriever: p.retriever,
+			Result: task.RetrievalResult{
+				Success:      false,
+				ErrorCode:    errorCode,
+				ErrorMessage: errorMessage,
+			},
+			CreatedAt: time.Now().UTC(),
+		})
+	}
+	return results
+}
+
+// Run builds the tasks of every candidate of the source and writes them to the queue in batches.
+func (p *Pipeline) Run(ctx context.Context, source Source) (Stats, error) {
+	stats := Stats{
+		PerCountry:   make(map[string]int),
+		PerContinent: make(map[string]int),
+		PerModule:    make(map[task.ModuleName]int),
+		PerProvider:  make(map[string]int),
+		Untestable:   make(map[string]string),
+	}
+	batchSize := p.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	var tasks []task.Task
+	var results []task.Result
+	flush := func() error {
+		if err := p.queue.AddTasks(ctx, tasks); err != nil {
+			return errors.Wrap(err, "failed to enqueue tasks")
+		}
+		if err := p.queue.AddResults(ctx, results); err != nil {
+			return errors.Wrap(err, "failed to save error results")
+		}
+		tasks = tasks[:0]
+		results = results[:0]
+		return nil
+	}
+
+	err := source.Candidates(ctx, func(candidate Candidate) error {
+		stats.Candidates++
+		newTasks, newResults, reason := p.build(ctx, candidate)
+		if len(newTasks) == 0 && len(newResults) == 0 {
+			stats.Skipped++
+		}
+		if reason != "" {
+			stats.Untestable[candidate.Provider] = reason
+		}
+
+		for _, t := range newTasks {
+			stats.PerCountry[t.Provider.Country]++
+			stats.PerContinent[t.Provider.Continent]++
+			stats.PerModule[t.Module]++
+			stats.PerProvider[t.Provider.ID]++
+		}
+
+		stats.Tasks += len(newTasks)
+		stats.Results += len(newResults)
+		tasks = append(tasks, newTasks...)
+		results = append(results, newResults...)
+		if len(tasks) >= batchSize || len(results) >= batchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, errors.Wrap(err, "failed to read candidates")
+	}
+
+	if err := flush(); err != nil {
+		return stats, err
+	}
+
+	logger.With("requester", p.Requester, "candidates", stats.Candidates, "tasks", stats.Tasks,
+		"results", stats.Results, "skipped", stats.Skipped).Info("finished generating tasks")
+	return stats, nil
+}
+
+func (s Stats) Log() {
+	for country, count := range s.PerCountry {
+		logger.With("country", country, "count", count).Info("tasks per country")
+	}
+
+	for continent, count := range s.PerContinent {
+		logger.With("continent", continent, "count", count).Info("tasks per continent")
+	}
+
+	for module, count := range s.PerModule {
+		logger.With("module", module, "count", count).Info("tasks per module")
+	}
+}
@@ -0,0 +1,154 @@
+package campaign
+
+import (
+	"context"
+	"testing"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/convert"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/model"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/requesterror"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/resolver"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testPeerID     = "12D3KooWSQ5LJeH7e9sZxsHcFXTqCu9sbQYZwhHaZbVGBBHCU6vS"
+	testPayloadCID = "bafkreiem4twkqzsq2aj4shbycd4yvoj2cx72vezicletlhi7dijjciqpui"
+	testPieceCID   = "baga6ea4seaqao7s73y24kcutaosvacpdjgfe5pw76ooefnyqw4ynr3d2y6x2mpq"
+)
+
+type fakeProviderResolver map[string]resolver.MinerInfo
+
+func (f fakeProviderResolver) ResolveProvider(_ context.Context, provider string) (resolver.MinerInfo, error) {
+	info, ok := f[provider]
+	if !ok {
+		return resolver.MinerInfo{}, errors.New("actor not found")
+	}
+	return info, nil
+}
+
+type fakeLocationResolver map[string][]resolver.IPInfo
+
+func (f fakeLocationResolver) ResolveAllMultiaddrsBytes(
+	_ context.Context,
+	addrs []abi.Multiaddrs,
+) ([]resolver.IPInfo, error) {
+	var locations []resolver.IPInfo
+	for _, addr := range convert.AbiToMultiaddrsSkippingError(addrs) {
+		locations = append(locations, f[addr.String()]...)
+	}
+	if len(locations) == 0 {
+		return nil, requesterror.NoValidMultiAddrError{}
+	}
+	return locations, nil
+}
+
+func minerInfo(peerID string, addrs ...string) resolver.MinerInfo {
+	var multiaddrs []abi.Multiaddrs
+	for _, addr := range addrs {
+		multiaddrs = append(multiaddrs, convert.MultiaddrToAbi(multiaddr.StringCast(addr)))
+	}
+	return resolver.MinerInfo{PeerId: peerID, Multiaddrs: multiaddrs}
+}
+
+func newTestPipeline(queue Queue) *Pipeline {
+	providers := fakeProviderResolver{
+		"f01000": minerInfo(testPeerID, "/ip4/1.1.1.1/tcp/1234", "/ip4/2.2.2.2/tcp/1234"),
+		"f02000": minerInfo(testPeerID),
+		"f03000": minerInfo("invalid", "/ip4/1.1.1.1/tcp/1234"),
+	}
+	locations := fakeLocationResolver{
+		"/ip4/1.1.1.1/tcp/1234": {{IP: "1.1.1.1", Country: "US", Continent: "NA"}},
+		"/ip4/2.2.2.2/tcp/1234": {{IP: "2.2.2.2", Country: "DE", Continent: "EU"}},
+	}
+	pipeline := NewPipeline("test", providers, locations, queue, task.Retriever{PublicIP: "9.9.9.9"})
+	pipeline.Metadata = map[string]string{"campaign_id": "c1"}
+	return pipeline
+}
+
+func TestDealCandidate(t *testing.T) {
+	candidate, ok := DealCandidate(model.DealState{DealID: 1, Provider: "f01000", Client: "f0100",
+		Label: testPayloadCID, PieceCID: testPieceCID})
+	assert.True(t, ok)
+	assert.Equal(t, testPayloadCID, candidate.PayloadCID)
+	assert.Equal(t, "1", candidate.Metadata["deal_id"])
+
+	candidate, ok = DealCandidate(model.DealState{Label: testPieceCID, PieceCID: testPieceCID})
+	assert.True(t, ok)
+	assert.Empty(t, candidate.PayloadCID)
+
+	_, ok = DealCandidate(model.DealState{Label: "not a cid"})
+	assert.False(t, ok)
+}
+
+func TestPipelineBuild(t *testing.T) {
+	pipeline := newTestPipeline(&MemoryQueue{})
+	ctx := context.Background()
+
+	tasks, results := pipeline.Build(ctx, Candidate{Provider: "f01000", PayloadCID: testPayloadCID,
+		PieceCID: testPieceCID, Metadata: map[string]string{"deal_id": "1"}})
+	assert.Len(t, tasks, 3)
+	assert.Empty(t, results)
+	for _, tsk := range tasks {
+		assert.Equal(t, "US", tsk.Provider.Country)
+		assert.Len(t, tsk.Provider.Locations, 2)
+		assert.Equal(t, "c1", tsk.Metadata["campaign_id"])
+		assert.Equal(t, "1", tsk.Metadata["deal_id"])
+		if tsk.Module == task.HTTP {
+			assert.Equal(t, testPieceCID, tsk.Content.CID)
+			assert.Equal(t, "piece", tsk.Metadata["retrieve_type"])
+		} else {
+			assert.Equal(t, testPayloadCID, tsk.Content.CID)
+		}
+	}
+
+	// Without a payload CID only HTTP is tested, and the candidate can restrict the modules further
+	tasks, _ = pipeline.Build(ctx, Candidate{Provider: "f01000", PieceCID: testPieceCID})
+	assert.Len(t, tasks, 1)
+	tasks, _ = pipeline.Build(ctx, Candidate{Provider: "f01000", PayloadCID: testPayloadCID,
+		PieceCID: testPieceCID, Modules: []task.ModuleName{task.Bitswap}})
+	assert.Len(t, tasks, 1)
+	assert.Equal(t, task.Bitswap, tasks[0].Module)
+
+	tasks, results = pipeline.Build(ctx, Candidate{Provider: "f02000", PieceCID: testPieceCID})
+	assert.Empty(t, tasks)
+	assert.Len(t, results, 1)
+	assert.Equal(t, task.NoValidMultiAddrs, results[0].Result.ErrorCode)
+	assert.Equal(t, "9.9.9.9", results[0].Retriever.PublicIP)
+
+	tasks, results = pipeline.Build(ctx, Candidate{Provider: "f03000", PieceCID: testPieceCID})
+	assert.Empty(t, tasks)
+	assert.Len(t, results, 1)
+	assert.Equal(t, task.InvalidPeerID, results[0].Result.ErrorCode)
+	assert.Equal(t, "US", results[0].Provider.Country)
+
+	tasks, results = pipeline.Build(ctx, Candidate{Provider: "f09999", PieceCID: testPieceCID})
+	assert.Empty(t, tasks)
+	assert.Empty(t, results)
+}
+
+func TestPipelineRun(t *testing.T) {
+	queue := &MemoryQueue{}
+	pipeline := newTestPipeline(queue)
+	pipeline.BatchSize = 1
+
+	stats, err := pipeline.Run(context.Background(), SliceSource{
+		{Provider: "f01000", PayloadCID: testPayloadCID, PieceCID: testPieceCID},
+		{Provider: "f02000", PieceCID: testPieceCID},
+		{Provider: "f09999", PieceCID: testPieceCID},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, stats.Candidates)
+	assert.Equal(t, 1, stats.Skipped)
+	assert.Equal(t, 3, stats.Tasks)
+	assert.Equal(t, 3, stats.PerCountry["US"])
+	assert.Len(t, queue.Tasks, 3)
+	assert.Len(t, queue.Results, 1)
+	assert.Contains(t, stats.Untestable["f02000"], "no valid multiaddrs")
+	assert.Contains(t, stats.Untestable["f09999"], "failed to resolve provider")
+	assert.NotContains(t, stats.Untestable, "f01000")
+}
@@ -0,0 +1,162 @@
+package campaign
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/env"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Queue receives the tasks and the error results produced by a pipeline.
+type Queue interface {
+	AddTasks(ctx context.Context, tasks []task.Task) error
+	AddResults(ctx context.Context, results []task.Result) error
+}
+
+type MongoQueue struct {
+	taskCollection   *mongo.Collection
+	resultCollection *mongo.Collection
+}
+
+func NewMongoQueue(taskCollection *mongo.Collection, resultCollection *mongo.Collection) *MongoQueue {
+	return &MongoQueue{taskCollection: taskCollection, resultCollection: resultCollection}
+}
+
+// NewMongoQueueFromEnv connects to the task_queue and task_result collections.
+func NewMongoQueueFromEnv(ctx context.Context) (*MongoQueue, error) {
+	taskClient, err := mongo.
+		Connect(ctx, options.Client().ApplyURI(env.GetRequiredString(env.QueueMongoURI)))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to mongo queueDB")
+	}
+	taskCollection := taskClient.
+		Database(env.GetRequiredString(env.QueueMongoDatabase)).Collection("task_queue")
+
+	resultClient, err := mongo.Connect(ctx, options.Client().ApplyURI(env.GetRequiredString(env.ResultMongoURI)))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to mongo resultDB")
+	}
+	resultCollection := resultClient.
+		Database(env.GetRequiredString(env.ResultMongoDatabase)).
+		Collection("task_result")
+
+	return NewMongoQueue(taskCollection, resultCollection), nil
+}
+
+func (q *MongoQueue) TaskCollection() *mongo.Collection {
+	return q.taskCollection
+}
+
+func (q *MongoQueue) ResultCollection() *mongo.Collection {
+	return q.resultCollection
+}
+
+// CampaignResultFilter selects the results in task_result of the tasks of the requester tagged with the campaign ID.
+func CampaignResultFilter(requester string, campaignID string) bson.M {
+	return bson.M{"task.requester": requester, "task.metadata.campaign_id": campaignID}
+}
+
+// WaitForResults polls task_result every interval until the expected number of results matching the filter
+// has arrived or the timeout expires, and returns the results that have arrived by then.
+func (q *MongoQueue) WaitForResults(
+	ctx context.Context,
+	filter bson.M,
+	expected int,
+	timeout time.Duration,
+	interval time.Duration,
+) ([]task.Result, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		count, err := q.resultCollection.CountDocuments(ctx, filter)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to count results")
+		}
+
+		logger.Infow("Waiting for results", "received", count, "expected", expected)
+		if count >= int64(expected) {
+			break
+		}
+		if time.Now().After(deadline) {
+			logger.Warnw("Timed out waiting for results", "received", count, "expected", expected)
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+
+	cursor, err := q.resultCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query results")
+	}
+	var results []task.Result
+	err = cursor.All(ctx, &results)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode results")
+	}
+	return results, nil
+}
+
+func (q *MongoQueue) AddTasks(ctx context.Context, tasks []task.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	documents := make([]interface{}, len(tasks))
+	for i, t := range tasks {
+		documents[i] = t
+	}
+
+	_, err := q.taskCollection.InsertMany(ctx, documents)
+	if err != nil {
+		return errors.Wrap(err, "failed to insert tasks")
+	}
+	return nil
+}
+
+func (q *MongoQueue) AddResults(ctx context.Context, results []task.Result) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	documents := make([]interface{}, len(results))
+	for i, r := range results {
+		documents[i] = r
+	}
+
+	_, err := q.resultCollection.InsertMany(ctx, documents)
+	if err != nil {
+		return errors.Wrap(err, "failed to insert results")
+	}
+	return nil
+}
+
+// MemoryQueue keeps the tasks and results in memory, e.g. to run them in process or in tests.
+type MemoryQueue struct {
+	mu      sync.Mutex
+	Tasks   []task.Task
+	Results []task.Result
+}
+
+func (q *MemoryQueue) AddTasks(_ context.Context, tasks []task.Task) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.Tasks = append(q.Tasks, tasks...)
+	return nil
+}
+
+func (q *MemoryQueue) AddResults(_ context.Context, results []task.Result) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.Results = append(q.Results, results...)
+	return nil
+}
@@ -0,0 +1,27 @@
+package campaign
+
+import (
+	"testing"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/testutil/bsonmatch"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCampaignResultFilter(t *testing.T) {
+	result := task.Result{Task: task.Task{
+		Requester: "cidlist",
+		Metadata:  map[string]string{"campaign_id": "c1", "row": "2"},
+	}}
+
+	matched, err := bsonmatch.Match(result, CampaignResultFilter("cidlist", "c1"))
+	assert.NoError(t, err)
+	assert.True(t, matched)
+
+	matched, err = bsonmatch.Match(result, CampaignResultFilter("cidlist", "c2"))
+	assert.NoError(t, err)
+	assert.False(t, matched)
+	matched, err = bsonmatch.Match(result, CampaignResultFilter("other", "c1"))
+	assert.NoError(t, err)
+	assert.False(t, matched)
+}
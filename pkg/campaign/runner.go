@@ -0,0 +1,176 @@
+package campaign
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/env"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Deps are the connections shared by all campaigns of a process.
+type Deps struct {
+	Resolvers   Resolvers
+	Retriever   task.Retriever
+	Queue       *MongoQueue
+	MarketDeals *mongo.Collection
+	Claims      *mongo.Collection
+}
+
+func NewDepsFromEnv(ctx context.Context) (Deps, error) {
+	resolvers, err := NewResolversFromEnv(ctx)
+	if err != nil {
+		return Deps{}, err
+	}
+
+	retriever, err := NewRetrieverFromEnv(ctx)
+	if err != nil {
+		return Deps{}, err
+	}
+
+	queue, err := NewMongoQueueFromEnv(ctx)
+	if err != nil {
+		return Deps{}, err
+	}
+
+	stateMarketDealsClient, err := mongo.
+		Connect(ctx, options.Client().ApplyURI(env.GetRequiredString(env.StatemarketdealsMongoURI)))
+	if err != nil {
+		return Deps{}, errors.Wrap(err, "failed to connect to mongo statemarketdealsDB")
+	}
+	stateMarketDealsDB := stateMarketDealsClient.Database(env.GetRequiredString(env.StatemarketdealsMongoDatabase))
+
+	return Deps{
+		Resolvers:   resolvers,
+		Retriever:   retriever,
+		Queue:       queue,
+		MarketDeals: stateMarketDealsDB.Collection("state_market_deals"),
+		Claims:      stateMarketDealsDB.Collection("claims"),
+	}, nil
+}
+
+// Runner runs a campaign definition against its source.
+type Runner struct {
+	Definition Definition
+	pipeline   *Pipeline
+	queue      *MongoQueue
+	source     Source
+	// The collection of the source and its filter, used to weight the clients
+	population *mongo.Collection
+	match      func(now time.Time) bson.M
+}
+
+func NewRunner(definition Definition, deps Deps) (*Runner, error) {
+	var source Source
+	var population *mongo.Collection
+	var match func(now time.Time) bson.M
+	// Every run records its seed, so the whole population is read in a stable order for the seed to reproduce it
+	switch definition.Source.Type {
+	case SourceMarketDeals:
+		source, population, match = NewMarketDealSource(deps.MarketDeals, definition.Filters, 0),
+			deps.MarketDeals, definition.Filters.Match
+	case SourceClaims:
+		source, population, match = NewClaimSource(deps.Claims, definition.Filters),
+			deps.Claims, definition.Filters.ClaimMatch
+	default:
+		return nil, errors.Errorf("unknown source type %s", definition.Source.Type)
+	}
+
+	pipeline := NewPipeline(definition.Requester, deps.Resolvers.Provider, deps.Resolvers.Location, deps.Queue,
+		deps.Retriever)
+	pipeline.Modules = definition.PipelineModules()
+	pipeline.Timeout = time.Duration(definition.Timeout)
+
+	return &Runner{
+		Definition: definition,
+		pipeline:   pipeline,
+		queue:      deps.Queue,
+		source:     source,
+		population: population,
+		match:      match,
+	}, nil
+}
+
+// RunOnce generates the tasks of a single run, unless the queue still holds more than MaxQueued tasks
+// of the requester.
+func (r *Runner) RunOnce(ctx context.Context) (Stats, error) {
+	logger := logger.With("campaign", r.Definition.Name)
+	if r.Definition.MaxQueued > 0 {
+		count, err := r.queue.TaskCollection().CountDocuments(ctx, bson.M{"requester": r.Definition.Requester})
+		if err != nil {
+			return Stats{}, errors.Wrap(err, "failed to count tasks")
+		}
+
+		logger.With("count", count).Info("Current number of tasks in the queue")
+		if count > r.Definition.MaxQueued {
+			logger.Infof("task queue still have %d tasks, do nothing", count)
+			return Stats{}, nil
+		}
+	}
+
+	seed := r.Definition.Sampling.Seed
+	if seed == 0 {
+		seed = NewSeed()
+	}
+
+	sampler, err := r.newSampler(ctx, seed)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	metadata := SamplingMetadata(r.Definition.Sampling.Strategy, seed)
+	for k, v := range r.Definition.Metadata {
+		metadata[k] = v
+	}
+	r.pipeline.Metadata = metadata
+
+	logger.With("strategy", r.Definition.Sampling.Strategy, "seed", seed).Info("sampling candidates")
+	return r.pipeline.Run(ctx, SampledSource(r.source, sampler))
+}
+
+func (r *Runner) newSampler(ctx context.Context, seed int64) (Sampler, error) {
+	sampling := r.Definition.Sampling
+	options := SamplerOptions{AgeDecay: sampling.AgeDecay}
+	var err error
+	switch sampling.Strategy {
+	case SamplingWeighted:
+		options.TotalPerClient, err = GetTotalPerClient(ctx, r.population, r.match(time.Now()))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get total per client")
+		}
+	case SamplingCoverageFirst:
+		options.Tested, err = GetTestedDeals(ctx, r.queue.ResultCollection(), r.Definition.Requester)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	//nolint:gosec
+	return NewSampler(sampling.Strategy, sampling.Size, rand.New(rand.NewSource(seed)), options)
+}
+
+// Run calls RunOnce at the cadence of the campaign until the context is done.
+func (r *Runner) Run(ctx context.Context) {
+	logger := logger.With("campaign", r.Definition.Name)
+	ticker := time.NewTicker(time.Duration(r.Definition.Cadence))
+	defer ticker.Stop()
+	for {
+		stats, err := r.RunOnce(ctx)
+		if err != nil {
+			logger.Error(err)
+		} else {
+			stats.Log()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package campaign
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	SamplingWeighted           = "weighted"
+	SamplingUniform            = "uniform"
+	SamplingAgeDecayed         = "age_decayed"
+	SamplingSizeWeighted       = "size_weighted"
+	SamplingStratifiedProvider = "stratified_provider"
+	SamplingStratifiedClient   = "stratified_client"
+	SamplingCoverageFirst      = "coverage_first"
+)
+
+//nolint:gochecknoglobals
+var SamplingStrategies = []string{
+	SamplingWeighted, SamplingUniform, SamplingAgeDecayed, SamplingSizeWeighted,
+	SamplingStratifiedProvider, SamplingStratifiedClient, SamplingCoverageFirst,
+}
+
+// Sampler picks up to a fixed number of candidates from a stream in a single pass.
+// All randomness comes from the *rand.Rand it was created with, so a sample can be reproduced from its seed.
+type Sampler interface {
+	Add(candidate Candidate)
+	Result() []Candidate
+}
+
+// SamplerOptions holds what some strategies need besides the size and the random source.
+type SamplerOptions struct {
+	// Constant c of the c^-age decay
+	AgeDecay float64
+	// Total piece size per client, used by the weighted strategy
+	TotalPerClient map[string]int64
+	// Keys (see Candidate.Key) of the candidates that have been tested before, used by coverage_first
+	Tested map[string]struct{}
+}
+
+// NewSampler creates the sampler of the named strategy.
+func NewSampler(strategy string, size int, rng *rand.Rand, options SamplerOptions) (Sampler, error) {
+	switch strategy {
+	case SamplingUniform:
+		return NewUniformSampler(size, rng), nil
+	case SamplingWeighted:
+		return NewWeightedSampler(size, rng, FilplusWeight(options.AgeDecay, options.TotalPerClient)), nil
+	case SamplingAgeDecayed:
+		return NewWeightedSampler(size, rng, func(c Candidate) float64 {
+			return math.Pow(options.AgeDecay, -c.AgeInYears())
+		}), nil
+	case SamplingSizeWeighted:
+		return NewWeightedSampler(size, rng, func(c Candidate) float64 {
+			return float64(c.PieceSize)
+		}), nil
+	case SamplingStratifiedProvider:
+		return NewStratifiedSampler(size, rng, func(c Candidate) string { return c.Provider }), nil
+	case SamplingStratifiedClient:
+		return NewStratifiedSampler(size, rng, func(c Candidate) string { return c.Client }), nil
+	case SamplingCoverageFirst:
+		return NewCoverageFirstSampler(size, rng, options.Tested), nil
+	default:
+		return nil, errors.Errorf("unknown sampling strategy %s", strategy)
+	}
+}
+
+// NewSeed returns a seed for a run that has none configured.
+func NewSeed() int64 {
+	return time.Now().UnixNano()
+}
+
+// SamplingMetadata is recorded on every task, so the sample of a run can be reproduced and audited.
+func SamplingMetadata(strategy string, seed int64) map[string]string {
+	return map[string]string{
+		"sampling_strategy": strategy,
+		"sampling_seed":     strconv.FormatInt(seed, 10),
+	}
+}
+
+// UniformSampler keeps a uniform random sample with reservoir sampling.
+type UniformSampler struct {
+	size   int
+	rng    *rand.Rand
+	seen   int
+	sample []Candidate
+}
+
+func NewUniformSampler(size int, rng *rand.Rand) *UniformSampler {
+	return &UniformSampler{size: size, rng: rng}
+}
+
+func (s *UniformSampler) Add(candidate Candidate) {
+	s.seen++
+	if len(s.sample) < s.size {
+		s.sample = append(s.sample, candidate)
+		return
+	}
+	if i := s.rng.Intn(s.seen); i < s.size {
+		s.sample[i] = candidate
+	}
+}
+
+func (s *UniformSampler) Result() []Candidate {
+	return s.sample
+}
+
+type keyedCandidate struct {
+	key       float64
+	candidate Candidate
+}
+
+// keyHeap is a min-heap on the key, so the smallest key of the reservoir is evicted first.
+type keyHeap []keyedCandidate
+
+func (h keyHeap) Len() int            { return len(h) }
+func (h keyHeap) Less(i, j int) bool  { return h[i].key < h[j].key }
+func (h keyHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *keyHeap) Push(x interface{}) { *h = append(*h, x.(keyedCandidate)) }
+func (h *keyHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// WeightedSampler samples without replacement with probability proportional to the weight,
+// using the A-ES weighted reservoir (Efraimidis & Spirakis): each candidate gets the key u^(1/w)
+// and the candidates with the largest keys are kept.
+type WeightedSampler struct {
+	size   int
+	rng    *rand.Rand
+	weight func(Candidate) float64
+	heap   keyHeap
+}
+
+func NewWeightedSampler(size int, rng *rand.Rand, weight func(Candidate) float64) *WeightedSampler {
+	return &WeightedSampler{size: size, rng: rng, weight: weight}
+}
+
+func (s *WeightedSampler) Add(candidate Candidate) {
+	if s.size <= 0 {
+		return
+	}
+	w := s.weight(candidate)
+	if w <= 0 || math.IsNaN(w) || math.IsInf(w, 0) {
+		return
+	}
+	// Compare log(u)/w instead of u^(1/w) to avoid underflow with small weights
+	key := math.Log(s.rng.Float64()) / w
+	if len(s.heap) < s.size {
+		heap.Push(&s.heap, keyedCandidate{key: key, candidate: candidate})
+		return
+	}
+	if key > s.heap[0].key {
+		s.heap[0] = keyedCandidate{key: key, candidate: candidate}
+		heap.Fix(&s.heap, 0)
+	}
+}
+
+// Result returns the sample ordered by decreasing key, i.e. in the order of a sequential weighted draw.
+func (s *WeightedSampler) Result() []Candidate {
+	sorted := make(keyHeap, len(s.heap))
+	copy(sorted, s.heap)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].key > sorted[j].key })
+	result := make([]Candidate, len(sorted))
+	for i, item := range sorted {
+		result[i] = item.candidate
+	}
+	return result
+}
+
+// StratifiedSampler keeps a uniform reservoir per stratum and splits the sample evenly between strata,
+// so large providers or clients cannot crowd out small ones.
+type StratifiedSampler struct {
+	size    int
+	rng     *rand.Rand
+	stratum func(Candidate) string
+	strata  map[string]*UniformSampler
+	order   []string
+}
+
+func NewStratifiedSampler(size int, rng *rand.Rand, stratum func(Candidate) string) *StratifiedSampler {
+	return &StratifiedSampler{size: size, rng: rng, stratum: stratum, strata: make(map[string]*UniformSampler)}
+}
+
+func (s *StratifiedSampler) Add(candidate Candidate) {
+	key := s.stratum(candidate)
+	sampler, ok := s.strata[key]
+	if !ok {
+		sampler = NewUniformSampler(s.size, s.rng)
+		s.strata[key] = sampler
+		s.order = append(s.order, key)
+	}
+	sampler.Add(candidate)
+}
+
+// Result takes one candidate from each stratum in turn, in a random order of strata, until the sample is full.
+func (s *StratifiedSampler) Result() []Candidate {
+	order := make([]string, len(s.order))
+	copy(order, s.order)
+	s.rng.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+
+	var result []Candidate
+	for round := 0; len(result) < s.size; round++ {
+		added := false
+		for _, key := range order {
+			sample := s.strata[key].Result()
+			if round < len(sample) && len(result) < s.size {
+				result = append(result, sample[round])
+				added = true
+			}
+		}
+		if !added {
+			break
+		}
+	}
+	return result
+}
+
+// CoverageFirstSampler prefers candidates that have never been tested, and fills the rest of the sample
+// uniformly from the tested ones.
+type CoverageFirstSampler struct {
+	size     int
+	tested   map[string]struct{}
+	untested *UniformSampler
+	others   *UniformSampler
+}
+
+func NewCoverageFirstSampler(size int, rng *rand.Rand, tested map[string]struct{}) *CoverageFirstSampler {
+	return &CoverageFirstSampler{
+		size:     size,
+		tested:   tested,
+		untested: NewUniformSampler(size, rng),
+		others:   NewUniformSampler(size, rng),
+	}
+}
+
+func (s *CoverageFirstSampler) Add(candidate Candidate) {
+	if _, ok := s.tested[candidate.Key()]; ok {
+		s.others.Add(candidate)
+		return
+	}
+	s.untested.Add(candidate)
+}
+
+func (s *CoverageFirstSampler) Result() []Candidate {
+	result := append([]Candidate(nil), s.untested.Result()...)
+	for _, candidate := range s.others.Result() {
+		if len(result) >= s.size {
+			break
+		}
+		result = append(result, candidate)
+	}
+	return result
+}
@@ -0,0 +1,102 @@
+package campaign
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testCandidates() []Candidate {
+	var candidates []Candidate
+	for i := 0; i < 100; i++ {
+		candidates = append(candidates, Candidate{
+			Provider:    "f0" + strconv.Itoa(1000+i%10),
+			Client:      "f0" + strconv.Itoa(100+i%4),
+			PieceSize:   uint64(1+i%3) << 30,
+			ActivatedAt: time.Now().Add(-time.Duration(i) * 24 * time.Hour),
+			Metadata:    map[string]string{"deal_id": strconv.Itoa(i)},
+		})
+	}
+	return candidates
+}
+
+func sampleKeys(t *testing.T, strategy string, seed int64, options SamplerOptions) []string {
+	//nolint:gosec
+	sampler, err := NewSampler(strategy, 10, rand.New(rand.NewSource(seed)), options)
+	assert.NoError(t, err)
+	for _, candidate := range testCandidates() {
+		sampler.Add(candidate)
+	}
+	var keys []string
+	for _, candidate := range sampler.Result() {
+		keys = append(keys, candidate.Key())
+	}
+	return keys
+}
+
+func TestSamplersAreReproducible(t *testing.T) {
+	options := SamplerOptions{
+		AgeDecay:       4,
+		TotalPerClient: map[string]int64{"f0100": 1, "f0101": 2, "f0102": 3, "f0103": 4},
+	}
+	for _, strategy := range SamplingStrategies {
+		first := sampleKeys(t, strategy, 42, options)
+		assert.Len(t, first, 10, strategy)
+		assert.Equal(t, first, sampleKeys(t, strategy, 42, options), strategy)
+
+		distinct := make(map[string]struct{})
+		for _, key := range first {
+			distinct[key] = struct{}{}
+		}
+		assert.Len(t, distinct, 10, strategy)
+	}
+
+	_, err := NewSampler("unknown", 10, rand.New(rand.NewSource(1)), SamplerOptions{})
+	assert.Error(t, err)
+}
+
+func TestStratifiedSamplerCoversAllProviders(t *testing.T) {
+	//nolint:gosec
+	sampler := NewStratifiedSampler(10, rand.New(rand.NewSource(1)), func(c Candidate) string { return c.Provider })
+	for _, candidate := range testCandidates() {
+		sampler.Add(candidate)
+	}
+
+	providers := make(map[string]int)
+	for _, candidate := range sampler.Result() {
+		providers[candidate.Provider]++
+	}
+	assert.Len(t, providers, 10)
+}
+
+func TestCoverageFirstSampler(t *testing.T) {
+	tested := make(map[string]struct{})
+	for i := 0; i < 95; i++ {
+		tested[strconv.Itoa(i)] = struct{}{}
+	}
+
+	keys := sampleKeys(t, SamplingCoverageFirst, 1, SamplerOptions{Tested: tested})
+	assert.ElementsMatch(t, []string{"95", "96", "97", "98", "99"}, keys[:5])
+}
+
+func TestWeightedSamplerSkipsZeroWeight(t *testing.T) {
+	//nolint:gosec
+	sampler := NewWeightedSampler(10, rand.New(rand.NewSource(1)), func(c Candidate) float64 {
+		if c.Provider == "f01000" {
+			return 1
+		}
+		return 0
+	})
+	for _, candidate := range testCandidates() {
+		sampler.Add(candidate)
+	}
+
+	result := sampler.Result()
+	assert.Len(t, result, 10)
+	for _, candidate := range result {
+		assert.Equal(t, "f01000", candidate.Provider)
+	}
+}
@@ -0,0 +1,143 @@
+package campaign
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/model"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/exp/slices"
+)
+
+// Candidate is a piece of content stored by a provider that may be tested.
+type Candidate struct {
+	Provider string
+	Client   string
+	// When the content was activated on chain, i.e. the sector start of a deal. Zero if unknown.
+	ActivatedAt time.Time
+	// CID of the DAG root, used by Bitswap and GraphSync. Empty if unknown.
+	PayloadCID string
+	PieceCID   string
+	PieceSize  uint64
+	// Modules to test the candidate with. If empty, the modules of the pipeline are used.
+	Modules []task.ModuleName
+	// Added to the metadata of every task and error result of the candidate
+	Metadata map[string]string
+}
+
+func (c Candidate) AgeInYears() float64 {
+	if c.ActivatedAt.IsZero() {
+		return 0
+	}
+	return time.Since(c.ActivatedAt).Hours() / 24 / 365
+}
+
+// Key identifies the candidate across runs: the deal ID for deals, "claim/" and the claim ID for claims,
+// otherwise the provider and piece CID.
+func (c Candidate) Key() string {
+	if dealID, ok := c.Metadata["deal_id"]; ok {
+		return dealID
+	}
+	if claimID, ok := c.Metadata["claim_id"]; ok {
+		return claimKeyPrefix + claimID
+	}
+	return c.Provider + "/" + c.PieceCID
+}
+
+// Source yields the candidates of a campaign, e.g. deals, replicas or a CID list.
+// Candidates must call yield for each candidate and stop if it returns an error.
+type Source interface {
+	Candidates(ctx context.Context, yield func(Candidate) error) error
+}
+
+type SourceFunc func(ctx context.Context, yield func(Candidate) error) error
+
+func (f SourceFunc) Candidates(ctx context.Context, yield func(Candidate) error) error {
+	return f(ctx, yield)
+}
+
+type SliceSource []Candidate
+
+func (s SliceSource) Candidates(ctx context.Context, yield func(Candidate) error) error {
+	for _, candidate := range s {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := yield(candidate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DealCandidate converts a market deal. The label is used as the payload CID if it is a CID with a DAG codec.
+// Deals whose label is not a CID at all are rejected.
+func DealCandidate(document model.DealState) (Candidate, bool) {
+	labelCID, err := cid.Decode(document.Label)
+	if err != nil {
+		logging.Logger("campaign").With("label", document.Label, "deal_id", document.DealID).
+			Debug("failed to decode label as CID")
+		return Candidate{}, false
+	}
+
+	candidate := Candidate{
+		Provider:    document.Provider,
+		Client:      document.Client,
+		ActivatedAt: model.EpochToTime(document.SectorStart),
+		PieceCID:    document.PieceCID,
+		PieceSize:   document.PieceSize,
+		Metadata: map[string]string{
+			"deal_id": strconv.Itoa(int(document.DealID)),
+			"client":  document.Client,
+		},
+	}
+
+	// Skip graphsync and bitswap if the cid is not decodable, i.e. it is a pieceCID
+	if slices.Contains([]uint64{cid.Raw, cid.DagCBOR, cid.DagProtobuf, cid.DagJSON, cid.DagJOSE},
+		labelCID.Prefix().Codec) {
+		candidate.PayloadCID = document.Label
+	} else {
+		logging.Logger("campaign").With("provider", document.Provider, "deal_id", document.DealID,
+			"label", document.Label, "codec", labelCID.Prefix().Codec).
+			Debug("Skip Bitswap and Graphsync because the Label is likely not a payload CID")
+	}
+
+	return candidate, true
+}
+
+// DealSource yields a candidate for each deal that DealCandidate accepts.
+func DealSource(documents []model.DealState) Source {
+	return SourceFunc(func(ctx context.Context, yield func(Candidate) error) error {
+		for _, document := range documents {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			candidate, ok := DealCandidate(document)
+			if !ok {
+				continue
+			}
+			if err := yield(candidate); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SampledSource passes every candidate of the source through the sampler and yields the sample.
+func SampledSource(source Source, sampler Sampler) Source {
+	return SourceFunc(func(ctx context.Context, yield func(Candidate) error) error {
+		err := source.Candidates(ctx, func(candidate Candidate) error {
+			sampler.Add(candidate)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return SliceSource(sampler.Result()).Candidates(ctx, yield)
+	})
+}
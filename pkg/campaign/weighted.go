@@ -0,0 +1,26 @@
+package campaign
+
+import (
+	"math"
+)
+
+// FilplusWeight returns the weight c^-age × piece size / sqrt(client total) described in filplus.md, 0 for the
+// clients without a total. The per-client factor 1/sqrt(total) and ln(c) are computed once, so weighting a
+// candidate costs one exp and one map lookup.
+func FilplusWeight(c float64, totalPerClient map[string]int64) func(Candidate) float64 {
+	clientFactor := make(map[string]float64, len(totalPerClient))
+	for client, total := range totalPerClient {
+		if total > 0 {
+			clientFactor[client] = 1 / math.Sqrt(float64(total))
+		}
+	}
+	logC := math.Log(c)
+
+	return func(candidate Candidate) float64 {
+		factor, ok := clientFactor[candidate.Client]
+		if !ok {
+			return 0
+		}
+		return math.Exp(-logC*candidate.AgeInYears()) * float64(candidate.PieceSize) * factor
+	}
+}
@@ -0,0 +1,155 @@
+package campaign
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilplusWeight(t *testing.T) {
+	now := time.Now()
+	year := 24 * 365 * time.Hour
+	weight := FilplusWeight(2, map[string]int64{"a": 16, "b": 1600, "c": 160000, "empty": 0})
+	for _, tc := range []struct {
+		candidate Candidate
+		expected  float64
+	}{
+		// 2^-0 × 100 / sqrt(16)
+		{Candidate{Client: "a", PieceSize: 100, ActivatedAt: now}, 25},
+		{Candidate{Client: "a", PieceSize: 200, ActivatedAt: now}, 50},
+		// 2^-1 × 100 / sqrt(16)
+		{Candidate{Client: "a", PieceSize: 100, ActivatedAt: now.Add(-year)}, 12.5},
+		// 2^-3 × 100 / sqrt(1600)
+		{Candidate{Client: "b", PieceSize: 100, ActivatedAt: now.Add(-3 * year)}, 0.3125},
+		{Candidate{Client: "c", PieceSize: 100, ActivatedAt: now}, 0.25},
+		// No activation means no age
+		{Candidate{Client: "b", PieceSize: 100}, 2.5},
+	} {
+		assert.InEpsilon(t, tc.expected, weight(tc.candidate), 1e-6, tc.candidate)
+	}
+
+	assert.Zero(t, weight(Candidate{Client: "unknown", PieceSize: 100, ActivatedAt: now}))
+	assert.Zero(t, weight(Candidate{Client: "empty", PieceSize: 100, ActivatedAt: now}))
+}
+
+func TestWeightedSamplerPicksDistinctDeals(t *testing.T) {
+	// Create a list of MyObject.
+	objects := []model.DealState{
+		{DealID: 1, SectorStart: model.TimeToEpoch(time.Now()), PieceSize: 1, Client: "a"},
+		{DealID: 2, SectorStart: model.TimeToEpoch(time.Now()), PieceSize: 1, Client: "a"},
+		{DealID: 3, SectorStart: model.TimeToEpoch(time.Now()), PieceSize: 1, Client: "a"},
+		{DealID: 4, SectorStart: model.TimeToEpoch(time.Now()), PieceSize: 1, Client: "a"},
+		{DealID: 5, SectorStart: model.TimeToEpoch(time.Now()), PieceSize: 1, Client: "a"},
+		{DealID: 6, SectorStart: model.TimeToEpoch(time.Now()), PieceSize: 1, Client: "a"},
+		{DealID: 7, SectorStart: model.TimeToEpoch(time.Now()), PieceSize: 1, Client: "a"},
+		{DealID: 8, SectorStart: model.TimeToEpoch(time.Now()), PieceSize: 1, Client: "a"},
+		{DealID: 9, SectorStart: model.TimeToEpoch(time.Now()), PieceSize: 1, Client: "a"},
+		{DealID: 10, SectorStart: model.TimeToEpoch(time.Now()), PieceSize: 1, Client: "a"},
+		{DealID: 11, SectorStart: model.TimeToEpoch(time.Now().Add(-24 * 365 * time.Hour)), PieceSize: 1, Client: "a"},
+		{DealID: 12, SectorStart: model.TimeToEpoch(time.Now().Add(-24 * 365 * time.Hour)), PieceSize: 1, Client: "a"},
+		{DealID: 13, SectorStart: model.TimeToEpoch(time.Now().Add(-24 * 365 * time.Hour)), PieceSize: 1, Client: "a"},
+		{DealID: 14, SectorStart: model.TimeToEpoch(time.Now().Add(-24 * 365 * time.Hour)), PieceSize: 1, Client: "a"},
+		{DealID: 15, SectorStart: model.TimeToEpoch(time.Now().Add(-24 * 365 * time.Hour)), PieceSize: 1, Client: "a"},
+		{DealID: 16, SectorStart: model.TimeToEpoch(time.Now().Add(-24 * 365 * time.Hour)), PieceSize: 1, Client: "a"},
+		{DealID: 17, SectorStart: model.TimeToEpoch(time.Now().Add(-24 * 365 * time.Hour)), PieceSize: 1, Client: "a"},
+		{DealID: 18, SectorStart: model.TimeToEpoch(time.Now().Add(-24 * 365 * time.Hour)), PieceSize: 1, Client: "a"},
+		{DealID: 19, SectorStart: model.TimeToEpoch(time.Now().Add(-24 * 365 * time.Hour)), PieceSize: 1, Client: "a"},
+		{DealID: 20, SectorStart: model.TimeToEpoch(time.Now().Add(-24 * 365 * time.Hour)), PieceSize: 1, Client: "a"},
+		{DealID: 21, SectorStart: model.TimeToEpoch(time.Now().Add(-2 * 24 * 365 * time.Hour)), PieceSize: 1, Client: "a"},
+		{DealID: 22, SectorStart: model.TimeToEpoch(time.Now().Add(-2 * 24 * 365 * time.Hour)), PieceSize: 1, Client: "a"},
+		{DealID: 23, SectorStart: model.TimeToEpoch(time.Now().Add(-2 * 24 * 365 * time.Hour)), PieceSize: 1, Client: "a"},
+		{DealID: 24, SectorStart: model.TimeToEpoch(time.Now().Add(-2 * 24 * 365 * time.Hour)), PieceSize: 1, Client: "a"},
+		{DealID: 25, SectorStart: model.TimeToEpoch(time.Now().Add(-2 * 24 * 365 * time.Hour)), PieceSize: 1, Client: "a"},
+		{DealID: 26, SectorStart: model.TimeToEpoch(time.Now().Add(-2 * 24 * 365 * time.Hour)), PieceSize: 1, Client: "a"},
+		{DealID: 27, SectorStart: model.TimeToEpoch(time.Now().Add(-2 * 24 * 365 * time.Hour)), PieceSize: 1, Client: "a"},
+		{DealID: 28, SectorStart: model.TimeToEpoch(time.Now().Add(-2 * 24 * 365 * time.Hour)), PieceSize: 1, Client: "a"},
+		{DealID: 29, SectorStart: model.TimeToEpoch(time.Now().Add(-2 * 24 * 365 * time.Hour)), PieceSize: 1, Client: "a"},
+		{DealID: 30, SectorStart: model.TimeToEpoch(time.Now().Add(-2 * 24 * 365 * time.Hour)), PieceSize: 1, Client: "a"},
+	}
+
+	// Select 5 random objects with C = 2.
+	candidates := make([]Candidate, len(objects))
+	for i, obj := range objects {
+		candidates[i] = Candidate{
+			Client:      obj.Client,
+			PieceSize:   obj.PieceSize,
+			ActivatedAt: model.EpochToTime(obj.SectorStart),
+			Metadata:    map[string]string{"deal_id": strconv.Itoa(int(obj.DealID))},
+		}
+	}
+	sampler, err := NewSampler(SamplingWeighted, 15, rand.New(rand.NewSource(1)), SamplerOptions{
+		AgeDecay:       2.0,
+		TotalPerClient: map[string]int64{"a": 1},
+	})
+	assert.NoError(t, err)
+	for _, candidate := range candidates {
+		sampler.Add(candidate)
+	}
+	selected := sampler.Result()
+	assert.Len(t, selected, 15)
+
+	// Check that the selected objects are distinct.
+	selectedMap := make(map[string]bool)
+	for _, obj := range selected {
+		if selectedMap[obj.Key()] {
+			t.Errorf("Selected duplicate object with deal id %s", obj.Key())
+		}
+		selectedMap[obj.Key()] = true
+	}
+
+	// Print the objects
+	for _, obj := range selected {
+		t.Logf("Selected object with deal id %s", obj.Key())
+	}
+}
+
+// The first pick of the weighted sampler, i.e. a sample of size 1, must follow the documented probability
+// weight / sum of weights. A chi-square test with a fixed seed keeps the test deterministic.
+func TestWeightedSamplerFollowsDocumentedProbabilities(t *testing.T) {
+	now := time.Now()
+	year := 24 * 365 * time.Hour
+	candidates := []Candidate{
+		{Client: "a", PieceSize: 1, ActivatedAt: now},
+		{Client: "a", PieceSize: 2, ActivatedAt: now},
+		{Client: "a", PieceSize: 1, ActivatedAt: now.Add(-year)},
+		{Client: "a", PieceSize: 1, ActivatedAt: now.Add(-2 * year)},
+		{Client: "b", PieceSize: 4, ActivatedAt: now},
+		{Client: "b", PieceSize: 4, ActivatedAt: now.Add(-year)},
+		{Client: "c", PieceSize: 8, ActivatedAt: now},
+	}
+	for i := range candidates {
+		candidates[i].Metadata = map[string]string{"deal_id": strconv.Itoa(i)}
+	}
+	totals := map[string]int64{"a": 5, "b": 8, "c": 64}
+	weight := FilplusWeight(4, totals)
+
+	var sum float64
+	for _, candidate := range candidates {
+		sum += weight(candidate)
+	}
+
+	const trials = 50000
+	counts := make([]int, len(candidates))
+	rng := rand.New(rand.NewSource(7))
+	for trial := 0; trial < trials; trial++ {
+		sampler := NewWeightedSampler(1, rng, weight)
+		for _, candidate := range candidates {
+			sampler.Add(candidate)
+		}
+		index, err := strconv.Atoi(sampler.Result()[0].Key())
+		assert.NoError(t, err)
+		counts[index]++
+	}
+
+	var chiSquare float64
+	for i, candidate := range candidates {
+		expected := trials * weight(candidate) / sum
+		chiSquare += (float64(counts[i]) - expected) * (float64(counts[i]) - expected) / expected
+	}
+	// 99.9th percentile of the chi-square distribution with 6 degrees of freedom
+	assert.Less(t, chiSquare, 22.46)
+}
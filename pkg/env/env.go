@@ -13,11 +13,18 @@ type Key string
 //nolint:gosec
 const (
 	ProcessModules                Key = "PROCESS_MODULES"
+	Network                       Key = "NETWORK"
+	NetworkGenesisTimestamp       Key = "NETWORK_GENESIS_TIMESTAMP"
+	NetworkBlockTime              Key = "NETWORK_BLOCK_TIME"
+	NetworkAddressPrefix          Key = "NETWORK_ADDRESS_PREFIX"
 	ProcessErrorInterval          Key = "PROCESS_ERROR_INTERVAL"
 	TaskWorkerPollInterval        Key = "TASK_WORKER_POLL_INTERVAL"
 	TaskWorkerTimeoutBuffer       Key = "TASK_WORKER_TIMEOUT_BUFFER"
 	LotusAPIUrl                   Key = "LOTUS_API_URL"
 	LotusAPIToken                 Key = "LOTUS_API_TOKEN"
+	LotusAPITimeout               Key = "LOTUS_API_TIMEOUT"
+	LotusAPICrossCheck            Key = "LOTUS_API_CROSS_CHECK"
+	LotusAPIHealthCheckInterval   Key = "LOTUS_API_HEALTH_CHECK_INTERVAL"
 	QueueMongoURI                 Key = "QUEUE_MONGO_URI"
 	QueueMongoDatabase            Key = "QUEUE_MONGO_DATABASE"
 	ResultMongoURI                Key = "RESULT_MONGO_URI"
@@ -29,6 +36,17 @@ const (
 	StatemarketdealsMongoDatabase Key = "STATEMARKETDEALS_MONGO_DATABASE"
 	StatemarketdealsBatchSize     Key = "STATEMARKETDEALS_BATCH_SIZE"
 	StatemarketdealsInterval      Key = "STATEMARKETDEALS_INTERVAL"
+	StatemarketdealsSource        Key = "STATEMARKETDEALS_SOURCE"
+	ClaimsSource                  Key = "CLAIMS_SOURCE"
+	ClaimsBatchSize               Key = "CLAIMS_BATCH_SIZE"
+	ProviderHistoryInterval       Key = "PROVIDER_HISTORY_INTERVAL"
+	CampaignConfig                Key = "CAMPAIGN_CONFIG"
+	CoverageSLA                   Key = "COVERAGE_SLA"
+	CoverageInterval              Key = "COVERAGE_INTERVAL"
+	CoverageRequester             Key = "COVERAGE_REQUESTER"
+	CampaignConfigReloadInterval  Key = "CAMPAIGN_CONFIG_RELOAD_INTERVAL"
+	StubWorkerConfig              Key = "STUB_WORKER_CONFIG"
+	StubWorkerSeed                Key = "STUB_WORKER_SEED"
 	PublicIP                      Key = "_PUBLIC_IP"
 	City                          Key = "_CITY"
 	Region                        Key = "_REGION"
@@ -40,6 +58,10 @@ const (
 	Longitude                     Key = "_LONGITUDE"
 	ProviderCacheTTL              Key = "PROVIDER_CACHE_TTL"
 	LocationCacheTTL              Key = "LOCATION_CACHE_TTL"
+	ProviderNegativeCacheTTL      Key = "PROVIDER_NEGATIVE_CACHE_TTL"
+	LocationNegativeCacheTTL      Key = "LOCATION_NEGATIVE_CACHE_TTL"
+	ResolverCacheMongoURI         Key = "RESOLVER_CACHE_MONGO_URI"
+	ResolverCacheMongoDatabase    Key = "RESOLVER_CACHE_MONGO_DATABASE"
 	AcceptedContinents            Key = "ACCEPTED_CONTINENTS"
 	AcceptedCountries             Key = "ACCEPTED_COUNTRIES"
 	IPInfoToken                   Key = "IPINFO_TOKEN"
@@ -69,6 +91,21 @@ func GetInt(key Key, defaultValue int) int {
 	return intValue
 }
 
+func GetBool(key Key, defaultValue bool) bool {
+	value := os.Getenv(string(key))
+	if value == "" {
+		return defaultValue
+	}
+
+	boolValue, err := strconv.ParseBool(value)
+	if err != nil {
+		logging.Logger("env").Debugf("failed to parse %s as bool", key)
+		return defaultValue
+	}
+
+	return boolValue
+}
+
 func GetRequiredInt(key Key) int {
 	value := os.Getenv(string(key))
 	if value == "" {
@@ -0,0 +1,17 @@
+package model
+
+// Claim is a verified registry claim, e.g. of data onboarded through DDO rather than a market deal.
+// The piece and party fields share the bson names of DealState.
+type Claim struct {
+	ClaimID   uint64 `bson:"claim_id"`
+	Provider  string `bson:"provider"`
+	Client    string `bson:"client"`
+	PieceCID  string `bson:"piece_cid"`
+	PieceSize uint64 `bson:"piece_size"`
+	TermMin   int32  `bson:"term_min"`
+	TermMax   int32  `bson:"term_max"`
+	TermStart int32  `bson:"term_start"`
+	// Epoch at which the claim can be removed, i.e. TermStart + TermMax
+	Expiration int32  `bson:"expiration"`
+	Sector     uint64 `bson:"sector"`
+}
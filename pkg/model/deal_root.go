@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// DealRoot is the payload root read from the CAR header at the beginning of the piece of a deal.
+type DealRoot struct {
+	DealID   int32  `bson:"deal_id"`
+	Provider string `bson:"provider"`
+	PieceCID string `bson:"piece_cid"`
+	Label    string `bson:"label"`
+	Root     string `bson:"root"`
+	// All the roots of the CAR header, the first one being Root
+	Roots []string `bson:"roots"`
+	// Whether the label of the deal is the same CID as the root
+	LabelMatches bool      `bson:"label_matches"`
+	DiscoveredAt time.Time `bson:"discovered_at"`
+}
@@ -1,10 +1,6 @@
 package model
 
-import (
-	"time"
-
-	"go.mongodb.org/mongo-driver/bson/primitive"
-)
+import "time"
 
 type DealState struct {
 	DealID      int32  `bson:"deal_id"`
@@ -19,28 +15,25 @@ type DealState struct {
 	SectorStart int32  `bson:"sector_start"`
 	Slashed     int32  `bson:"slashed"`
 	LastUpdated int32  `bson:"last_updated"`
+	// Inactive is set when the deal is no longer in the StateMarketDeals snapshot
+	Inactive bool `bson:"inactive,omitempty"`
 }
 
-type DealIDLastUpdated struct {
-	ID          primitive.ObjectID `bson:"_id"`
-	DealID      int32              `bson:"deal_id"`
-	LastUpdated int32              `bson:"last_updated"`
+// ArchivedDeal is a deal that has been moved out of state_market_deals, with when and why
+type ArchivedDeal struct {
+	DealState     `bson:",inline"`
+	ArchiveReason string    `bson:"archive_reason"`
+	ArchivedAt    time.Time `bson:"archived_at"`
 }
 
+// EpochToTime converts an epoch of the network chosen by NETWORK.
 func EpochToTime(epoch int32) time.Time {
-	if epoch < 0 {
-		return time.Time{}
-	}
-	//nolint:gomnd
-	return time.Unix(int64(epoch*30+1598306400), 0).UTC()
+	return GetNetwork().EpochToTime(epoch)
 }
 
+// TimeToEpoch converts a time to an epoch of the network chosen by NETWORK.
 func TimeToEpoch(t time.Time) int32 {
-	if t.IsZero() {
-		return -1
-	}
-	//nolint:gomnd
-	return int32(t.Unix()-1598306400) / 30
+	return GetNetwork().TimeToEpoch(t)
 }
 
 func (s DealState) AgeInYears() float64 {
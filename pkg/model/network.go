@@ -0,0 +1,112 @@
+package model
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/env"
+	"github.com/filecoin-project/go-address"
+	logging "github.com/ipfs/go-log/v2"
+)
+
+// Network is the profile of a Filecoin network, used to convert epochs and format addresses.
+type Network struct {
+	Name string
+	// Unix timestamp of the genesis block
+	GenesisTimestamp int64
+	BlockTime        time.Duration
+	// Network of the address prefix, i.e. f for mainnet and t for the others
+	AddressNetwork address.Network
+	// Defaults of LOTUS_API_URL and STATEMARKETDEALS_SOURCE
+	LotusAPIUrl       string
+	MarketDealsSource string
+}
+
+//nolint:gochecknoglobals
+var (
+	Mainnet = Network{
+		Name:              "mainnet",
+		GenesisTimestamp:  1598306400,
+		BlockTime:         30 * time.Second,
+		AddressNetwork:    address.Mainnet,
+		LotusAPIUrl:       "https://api.node.glif.io/rpc/v0",
+		MarketDealsSource: "https://marketdeals.s3.amazonaws.com/StateMarketDeals.json.zst",
+	}
+	Calibnet = Network{
+		Name:             "calibnet",
+		GenesisTimestamp: 1667326380,
+		BlockTime:        30 * time.Second,
+		AddressNetwork:   address.Testnet,
+		LotusAPIUrl:      "https://api.calibration.node.glif.io/rpc/v0",
+	}
+)
+
+//nolint:gochecknoglobals
+var (
+	network     Network
+	networkOnce sync.Once
+)
+
+// NetworkFromEnv returns the profile named by NETWORK (mainnet, calibnet or custom, default mainnet).
+// NETWORK_GENESIS_TIMESTAMP, NETWORK_BLOCK_TIME and NETWORK_ADDRESS_PREFIX override the fields of the profile,
+// e.g. for a local devnet.
+func NetworkFromEnv() Network {
+	var n Network
+	switch name := env.GetString(env.Network, Mainnet.Name); name {
+	case Mainnet.Name:
+		n = Mainnet
+	case Calibnet.Name, "calibrationnet":
+		n = Calibnet
+	default:
+		n = Network{Name: name, BlockTime: 30 * time.Second, AddressNetwork: address.Testnet}
+	}
+
+	n.GenesisTimestamp = int64(env.GetInt(env.NetworkGenesisTimestamp, int(n.GenesisTimestamp)))
+	n.BlockTime = env.GetDuration(env.NetworkBlockTime, n.BlockTime)
+	switch strings.ToLower(env.GetString(env.NetworkAddressPrefix, "")) {
+	case address.MainnetPrefix:
+		n.AddressNetwork = address.Mainnet
+	case address.TestnetPrefix:
+		n.AddressNetwork = address.Testnet
+	}
+
+	if n.GenesisTimestamp == 0 {
+		logging.Logger("network").With("network", n.Name).Warn("genesis timestamp of the network is not set")
+	}
+	return n
+}
+
+// GetNetwork returns the network profile of the process, read from the environment on first use,
+// and formats addresses with its prefix from then on.
+func GetNetwork() Network {
+	networkOnce.Do(func() {
+		useNetwork(NetworkFromEnv())
+	})
+	return network
+}
+
+// SetNetwork replaces the network profile of the process.
+func SetNetwork(n Network) {
+	networkOnce.Do(func() {})
+	useNetwork(n)
+}
+
+func useNetwork(n Network) {
+	network = n
+	address.CurrentNetwork = n.AddressNetwork
+}
+
+func (n Network) EpochToTime(epoch int32) time.Time {
+	if epoch < 0 {
+		return time.Time{}
+	}
+	return time.Unix(n.GenesisTimestamp, 0).Add(time.Duration(epoch) * n.BlockTime).UTC()
+}
+
+func (n Network) TimeToEpoch(t time.Time) int32 {
+	if t.IsZero() {
+		return -1
+	}
+	return int32(t.Sub(time.Unix(n.GenesisTimestamp, 0)) / n.BlockTime)
+}
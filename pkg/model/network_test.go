@@ -0,0 +1,38 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNetworkEpochs(t *testing.T) {
+	assert.Equal(t, time.Date(2020, 8, 24, 22, 0, 0, 0, time.UTC), Mainnet.EpochToTime(0))
+	assert.Equal(t, time.Date(2020, 8, 24, 23, 0, 0, 0, time.UTC), Mainnet.EpochToTime(120))
+	assert.Equal(t, int32(120), Mainnet.TimeToEpoch(time.Date(2020, 8, 24, 23, 0, 15, 0, time.UTC)))
+	assert.Equal(t, time.Time{}, Mainnet.EpochToTime(-1))
+	assert.Equal(t, int32(-1), Mainnet.TimeToEpoch(time.Time{}))
+
+	devnet := Network{GenesisTimestamp: 1700000000, BlockTime: 4 * time.Second}
+	assert.Equal(t, time.Unix(1700000040, 0).UTC(), devnet.EpochToTime(10))
+	assert.Equal(t, int32(10), devnet.TimeToEpoch(time.Unix(1700000040, 0)))
+
+	calibnetEpoch := Calibnet.TimeToEpoch(Mainnet.EpochToTime(3000000))
+	assert.NotEqual(t, int32(3000000), calibnetEpoch)
+}
+
+func TestNetworkFromEnv(t *testing.T) {
+	t.Setenv("NETWORK", "calibnet")
+	assert.Equal(t, Calibnet, NetworkFromEnv())
+
+	t.Setenv("NETWORK", "devnet")
+	t.Setenv("NETWORK_GENESIS_TIMESTAMP", "1700000000")
+	t.Setenv("NETWORK_BLOCK_TIME", "4s")
+	t.Setenv("NETWORK_ADDRESS_PREFIX", "t")
+	n := NetworkFromEnv()
+	assert.Equal(t, "devnet", n.Name)
+	assert.Equal(t, int64(1700000000), n.GenesisTimestamp)
+	assert.Equal(t, 4*time.Second, n.BlockTime)
+	assert.Equal(t, Calibnet.AddressNetwork, n.AddressNetwork)
+}
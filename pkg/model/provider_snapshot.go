@@ -0,0 +1,32 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ProviderSnapshot is the on-chain endpoint of a storage provider from the epoch it was first observed
+// until the next snapshot of the same provider.
+type ProviderSnapshot struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	Provider   string             `bson:"provider"`
+	PeerID     string             `bson:"peer_id"`
+	Multiaddrs []string           `bson:"multiaddrs"`
+	Epoch      int32              `bson:"epoch"`
+	CreatedAt  time.Time          `bson:"created_at"`
+}
+
+func (s ProviderSnapshot) SameEndpoint(other ProviderSnapshot) bool {
+	if s.PeerID != other.PeerID || len(s.Multiaddrs) != len(other.Multiaddrs) {
+		return false
+	}
+
+	for i := range s.Multiaddrs {
+		if s.Multiaddrs[i] != other.Multiaddrs[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -25,3 +25,14 @@ type DealState struct {
 	LastUpdatedEpoch int32
 	SlashEpoch       int32
 }
+
+type Claim struct {
+	Provider  uint64
+	Client    uint64
+	Data      Cid
+	Size      uint64
+	TermMin   int32
+	TermMax   int32
+	TermStart int32
+	Sector    uint64
+}
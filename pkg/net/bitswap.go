@@ -1,7 +1,12 @@
 package net
 
 import (
+	"bytes"
 	"context"
+	"math/rand"
+	"sync"
+	"time"
+
 	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
@@ -11,12 +16,17 @@ import (
 	bsnet "github.com/ipfs/go-libipfs/bitswap/network"
 	"github.com/ipfs/go-libipfs/blocks"
 	logging "github.com/ipfs/go-log/v2"
+	_ "github.com/ipld/go-codec-dagpb"
+	_ "github.com/ipld/go-ipld-prime/codec/dagcbor"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/multicodec"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/traversal"
 	"github.com/libp2p/go-libp2p/core/host"
+	libp2pnetwork "github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/routing"
 	"github.com/pkg/errors"
-	"golang.org/x/exp/slices"
-	"time"
 )
 
 type SingleContentRouter struct {
@@ -101,17 +111,37 @@ func (c BitswapClient) Retrieve(
 	parent context.Context,
 	target peer.AddrInfo,
 	cid cid.Cid) (*task.RetrievalResult, error) {
-	logger := logging.Logger("bitswap_client").With("cid", cid).With("target", target)
+	return c.RetrieveLayers(parent, target, cid, 0, 0, nil)
+}
+
+// RetrieveLayers retrieves the root block, then up to perLayer blocks drawn with rng from the links
+// of the blocks of the previous layer, for the given number of layers below the root.
+// All the blocks have to be retrieved for the retrieval to succeed.
+func (c BitswapClient) RetrieveLayers(
+	parent context.Context,
+	target peer.AddrInfo,
+	root cid.Cid,
+	layers int,
+	perLayer int,
+	rng *rand.Rand) (*task.RetrievalResult, error) {
+	logger := logging.Logger("bitswap_client").With("cid", root).With("target", target)
 	network := bsnet.NewFromIpfsHost(c.host, SingleContentRouter{
 		AddrInfo: target,
 	})
 	bswap := bsclient.New(parent, network, blockstore.NewBlockstore(datastore.NewMapDatastore()))
+	var wanted sync.Map
 	notFound := make(chan struct{})
+	var notFoundOnce sync.Once
 	network.Start(MessageReceiver{BSClient: bswap, MessageHandler: func(
 		ctx context.Context, sender peer.ID, incoming bsmsg.BitSwapMessage) {
-		if sender == target.ID && slices.Contains(incoming.DontHaves(), cid) {
-			logger.Info("Block not found")
-			close(notFound)
+		if sender != target.ID {
+			return
+		}
+		for _, dontHave := range incoming.DontHaves() {
+			if _, ok := wanted.Load(dontHave); ok {
+				logger.With("block", dontHave).Info("Block not found")
+				notFoundOnce.Do(func() { close(notFound) })
+			}
 		}
 	}})
 	defer bswap.Close()
@@ -119,20 +149,64 @@ func (c BitswapClient) Retrieve(
 	connectContext, cancel := context.WithTimeout(parent, c.timeout)
 	defer cancel()
 	logger.Info("Connecting to target peer...")
+	alreadyConnected := c.host.Network().Connectedness(target.ID) == libp2pnetwork.Connected
 	err := c.host.Connect(connectContext, target)
 	if err != nil {
 		logger.With("err", err).Info("Failed to connect to target peer")
 		return task.NewErrorRetrievalResultWithErrorResolution(task.CannotConnect, err), nil
 	}
 
+	// The bitswap network is only notified of new connections, e.g. not of the one opened to query the protocols
+	if alreadyConnected {
+		bswap.PeerConnected(target.ID)
+	}
+
 	startTime := time.Now()
-	resultChan := make(chan blocks.Block)
-	errChan := make(chan error)
+	var ttfb time.Duration
+	var size int64
+	layer := []cid.Cid{root}
+	for depth := 0; depth <= layers && len(layer) > 0; depth++ {
+		var links []cid.Cid
+		for _, c := range layer {
+			wanted.Store(c, struct{}{})
+			blk, result := getBlock(connectContext, bswap, c, notFound)
+			if result != nil {
+				return result, nil
+			}
+
+			if ttfb == 0 {
+				ttfb = time.Since(startTime)
+			}
+			size += int64(len(blk.RawData()))
+			if depth < layers {
+				blockLinks, err := BlockLinks(blk)
+				if err != nil {
+					logger.With("block", c, "err", err).Info("Cannot decode the links of the block")
+					continue
+				}
+				links = append(links, blockLinks...)
+			}
+		}
+		logger.With("depth", depth, "blocks", len(layer)).Info("Retrieved layer")
+		layer = SampleLinks(links, perLayer, rng)
+	}
+
+	elapsed := time.Since(startTime)
+	logger.With("size", size).With("elapsed", elapsed).Info("Retrieved blocks")
+	return task.NewSuccessfulRetrievalResult(ttfb, size, elapsed), nil
+}
+
+func getBlock(
+	ctx context.Context,
+	bswap *bsclient.Client,
+	c cid.Cid,
+	notFound <-chan struct{}) (blocks.Block, *task.RetrievalResult) {
+	resultChan := make(chan blocks.Block, 1)
+	errChan := make(chan error, 1)
 	go func() {
-		logger.Info("Retrieving block...")
-		blk, err := bswap.GetBlock(connectContext, cid)
+		logging.Logger("bitswap_client").With("cid", c).Info("Retrieving block...")
+		blk, err := bswap.GetBlock(ctx, c)
 		if err != nil {
-			logger.Info(err)
 			errChan <- err
 		} else {
 			resultChan <- blk
@@ -140,14 +214,58 @@ func (c BitswapClient) Retrieve(
 	}()
 	select {
 	case <-notFound:
-		return task.NewErrorRetrievalResult(
-			task.NotFound, errors.New("DONT_HAVE received from the target peer")), nil
+		return nil, task.NewErrorRetrievalResult(
+			task.NotFound, errors.New("DONT_HAVE received from the target peer"))
 	case blk := <-resultChan:
-		elapsed := time.Since(startTime)
-		var size = int64(len(blk.RawData()))
-		logger.With("size", size).With("elapsed", elapsed).Info("Retrieved block")
-		return task.NewSuccessfulRetrievalResult(elapsed, size, elapsed), nil
+		return blk, nil
 	case err := <-errChan:
-		return task.NewErrorRetrievalResultWithErrorResolution(task.RetrievalFailure, err), nil
+		return nil, task.NewErrorRetrievalResultWithErrorResolution(task.RetrievalFailure, err)
+	}
+}
+
+// BlockLinks returns the CIDs linked from a block, if its codec is known, e.g. dag-pb or dag-cbor.
+func BlockLinks(blk blocks.Block) ([]cid.Cid, error) {
+	if blk.Cid().Prefix().Codec == cid.Raw {
+		return nil, nil
+	}
+
+	decoder, err := multicodec.LookupDecoder(blk.Cid().Prefix().Codec)
+	if err != nil {
+		return nil, errors.Wrap(err, "unknown codec")
+	}
+
+	builder := basicnode.Prototype.Any.NewBuilder()
+	err = decoder(builder, bytes.NewReader(blk.RawData()))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode block")
+	}
+
+	links, err := traversal.SelectLinks(builder.Build())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to select links")
+	}
+
+	cids := make([]cid.Cid, 0, len(links))
+	for _, link := range links {
+		if cidLink, ok := link.(cidlink.Link); ok {
+			cids = append(cids, cidLink.Cid)
+		}
+	}
+	return cids, nil
+}
+
+// SampleLinks draws up to n distinct links with rng, or returns the first n if rng is nil.
+func SampleLinks(links []cid.Cid, n int, rng *rand.Rand) []cid.Cid {
+	if n >= len(links) {
+		return links
+	}
+	if rng == nil {
+		return links[:n]
+	}
+
+	sampled := make([]cid.Cid, 0, n)
+	for _, i := range rng.Perm(len(links))[:n] {
+		sampled = append(sampled, links[i])
 	}
+	return sampled
 }
@@ -0,0 +1,64 @@
+package net
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-libipfs/blocks"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/assert"
+)
+
+func rawCID(t *testing.T, data string) cid.Cid {
+	hash, err := multihash.Sum([]byte(data), multihash.SHA2_256, -1)
+	assert.NoError(t, err)
+	return cid.NewCidV1(cid.Raw, hash)
+}
+
+func TestBlockLinks(t *testing.T) {
+	child1 := rawCID(t, "child1")
+	child2 := rawCID(t, "child2")
+	node, err := qp.BuildMap(basicnode.Prototype.Any, 2, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "name", qp.String("root"))
+		qp.MapEntry(ma, "children", qp.List(2, func(la datamodel.ListAssembler) {
+			qp.ListEntry(la, qp.Link(cidlink.Link{Cid: child1}))
+			qp.ListEntry(la, qp.Link(cidlink.Link{Cid: child2}))
+		}))
+	})
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	assert.NoError(t, dagcbor.Encode(node, &buf))
+	hash, err := multihash.Sum(buf.Bytes(), multihash.SHA2_256, -1)
+	assert.NoError(t, err)
+	blk, err := blocks.NewBlockWithCid(buf.Bytes(), cid.NewCidV1(cid.DagCBOR, hash))
+	assert.NoError(t, err)
+
+	links, err := BlockLinks(blk)
+	assert.NoError(t, err)
+	assert.Equal(t, []cid.Cid{child1, child2}, links)
+
+	raw, err := blocks.NewBlockWithCid([]byte("child1"), child1)
+	assert.NoError(t, err)
+	links, err = BlockLinks(raw)
+	assert.NoError(t, err)
+	assert.Empty(t, links)
+}
+
+func TestSampleLinks(t *testing.T) {
+	links := []cid.Cid{rawCID(t, "a"), rawCID(t, "b"), rawCID(t, "c"), rawCID(t, "d")}
+	assert.Equal(t, links, SampleLinks(links, 5, nil))
+	assert.Equal(t, links[:2], SampleLinks(links, 2, nil))
+
+	sampled := SampleLinks(links, 2, rand.New(rand.NewSource(1)))
+	assert.Len(t, sampled, 2)
+	assert.NotEqual(t, sampled[0], sampled[1])
+	assert.Subset(t, links, sampled)
+	assert.Equal(t, sampled, SampleLinks(links, 2, rand.New(rand.NewSource(1))))
+}
@@ -0,0 +1,115 @@
+package net
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/pkg/errors"
+)
+
+// CARHeaderPrefix is how many bytes of a piece are kept to look for the CAR header.
+const CARHeaderPrefix = 64 * 1024
+
+const (
+	carV2HeaderSize = 40
+	maxCARHeaderLen = 32 * 1024
+)
+
+//nolint:gochecknoglobals
+var carV2Pragma = []byte{0x0a, 0xa1, 0x67, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x02}
+
+// CARRoots returns the root CIDs of the CARv1 or CARv2 that the reader starts with, e.g. the beginning of a piece.
+func CARRoots(r io.Reader) ([]cid.Cid, error) {
+	reader := bufio.NewReader(r)
+	pragma, err := reader.Peek(len(carV2Pragma))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read CAR pragma")
+	}
+
+	if bytes.Equal(pragma, carV2Pragma) {
+		header := make([]byte, len(carV2Pragma)+carV2HeaderSize)
+		_, err = io.ReadFull(reader, header)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read CARv2 header")
+		}
+
+		// The characteristics take 16 bytes, then comes the offset of the inner CARv1
+		dataOffset := binary.LittleEndian.Uint64(header[len(carV2Pragma)+16:])
+		if dataOffset < uint64(len(header)) {
+			return nil, errors.Errorf("invalid CARv2 data offset %d", dataOffset)
+		}
+		_, err = reader.Discard(int(dataOffset) - len(header))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to skip to CARv1 data")
+		}
+	}
+
+	return carV1Roots(reader)
+}
+
+func carV1Roots(reader *bufio.Reader) ([]cid.Cid, error) {
+	length, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read CAR header length")
+	}
+	if length == 0 || length > maxCARHeaderLen {
+		return nil, errors.Errorf("invalid CAR header length %d", length)
+	}
+
+	header := make([]byte, length)
+	_, err = io.ReadFull(reader, header)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read CAR header")
+	}
+
+	builder := basicnode.Prototype.Map.NewBuilder()
+	err = dagcbor.Decode(builder, bytes.NewReader(header))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode CAR header")
+	}
+	node := builder.Build()
+
+	versionNode, err := node.LookupByString("version")
+	if err != nil {
+		return nil, errors.Wrap(err, "CAR header has no version")
+	}
+	version, err := versionNode.AsInt()
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid CAR version")
+	}
+	if version != 1 {
+		return nil, errors.Errorf("unsupported CAR version %d", version)
+	}
+
+	rootsNode, err := node.LookupByString("roots")
+	if err != nil {
+		return nil, errors.Wrap(err, "CAR header has no roots")
+	}
+	roots := make([]cid.Cid, 0, rootsNode.Length())
+	iterator := rootsNode.ListIterator()
+	for iterator != nil && !iterator.Done() {
+		_, rootNode, err := iterator.Next()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to iterate CAR roots")
+		}
+		link, err := rootNode.AsLink()
+		if err != nil {
+			return nil, errors.Wrap(err, "CAR root is not a link")
+		}
+		cidLink, ok := link.(cidlink.Link)
+		if !ok {
+			return nil, errors.New("CAR root is not a CID")
+		}
+		roots = append(roots, cidLink.Cid)
+	}
+	if len(roots) == 0 {
+		return nil, errors.New("CAR header has no roots")
+	}
+	return roots, nil
+}
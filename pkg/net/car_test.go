@@ -0,0 +1,54 @@
+package net
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/stretchr/testify/assert"
+)
+
+func carV1Header(t *testing.T, roots ...cid.Cid) []byte {
+	node, err := qp.BuildMap(basicnode.Prototype.Any, 2, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "roots", qp.List(int64(len(roots)), func(la datamodel.ListAssembler) {
+			for _, root := range roots {
+				qp.ListEntry(la, qp.Link(cidlink.Link{Cid: root}))
+			}
+		}))
+		qp.MapEntry(ma, "version", qp.Int(1))
+	})
+	assert.NoError(t, err)
+	var header bytes.Buffer
+	assert.NoError(t, dagcbor.Encode(node, &header))
+	return append(binary.AppendUvarint(nil, uint64(header.Len())), header.Bytes()...)
+}
+
+func TestCARRoots(t *testing.T) {
+	root1 := rawCID(t, "root1")
+	root2 := rawCID(t, "root2")
+
+	v1 := append(carV1Header(t, root1, root2), []byte("blocks")...)
+	roots, err := CARRoots(bytes.NewReader(v1))
+	assert.NoError(t, err)
+	assert.Equal(t, []cid.Cid{root1, root2}, roots)
+
+	v2 := append([]byte{}, carV2Pragma...)
+	header := make([]byte, carV2HeaderSize)
+	dataOffset := uint64(len(carV2Pragma) + carV2HeaderSize + 8)
+	binary.LittleEndian.PutUint64(header[16:], dataOffset)
+	v2 = append(v2, header...)
+	v2 = append(v2, make([]byte, 8)...)
+	v2 = append(v2, carV1Header(t, root1)...)
+	roots, err = CARRoots(bytes.NewReader(v2))
+	assert.NoError(t, err)
+	assert.Equal(t, []cid.Cid{root1}, roots)
+
+	_, err = CARRoots(bytes.NewReader([]byte("not a car file at all")))
+	assert.Error(t, err)
+}
@@ -1,6 +1,7 @@
 package net
 
 import (
+	"bytes"
 	"context"
 	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
 	"github.com/ipfs/go-cid"
@@ -67,17 +68,50 @@ func (c HTTPClient) RetrievePiece(
 			task.NotFound, errors.Errorf("status code: %d", resp.StatusCode)), nil
 	}
 
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return task.NewErrorRetrievalResult(
+			task.Throttled, errors.Errorf("status code: %d", resp.StatusCode)), nil
+	}
+
 	if resp.StatusCode > 299 {
 		return task.NewErrorRetrievalResultWithErrorResolution(
 			task.RetrievalFailure, errors.Errorf("status code: %d", resp.StatusCode)), nil
 	}
 
-	downloaded, err := io.CopyN(io.Discard, resp.Body, length)
+	// Keep the beginning of the piece to read the roots from its CAR header
+	prefix := &prefixWriter{limit: CARHeaderPrefix}
+	downloaded, err := io.CopyN(prefix, resp.Body, length)
 	if err != nil {
 		logger.Info(err)
 		return task.NewErrorRetrievalResultWithErrorResolution(task.RetrievalFailure, err), nil
 	}
 
 	elapsed := time.Since(startTime)
-	return task.NewSuccessfulRetrievalResult(fbTime, downloaded, elapsed), nil
+	result := task.NewSuccessfulRetrievalResult(fbTime, downloaded, elapsed)
+	roots, err := CARRoots(bytes.NewReader(prefix.buf.Bytes()))
+	if err != nil {
+		logger.With("err", err).Debug("Cannot read the CAR header of the piece")
+		return result, nil
+	}
+
+	for _, root := range roots {
+		result.CARRoots = append(result.CARRoots, root.String())
+	}
+	return result, nil
+}
+
+// prefixWriter keeps the first limit bytes written to it and discards the rest.
+type prefixWriter struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	if remaining := w.limit - w.buf.Len(); remaining > 0 {
+		if len(p) < remaining {
+			remaining = len(p)
+		}
+		w.buf.Write(p[:remaining])
+	}
+	return len(p), nil
 }
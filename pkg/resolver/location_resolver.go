@@ -13,12 +13,12 @@ import (
 	"github.com/data-preservation-programs/RetrievalBot/pkg/convert"
 	"github.com/data-preservation-programs/RetrievalBot/pkg/requesterror"
 	"github.com/data-preservation-programs/RetrievalBot/pkg/resources"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
 	"github.com/filecoin-project/go-state-types/abi"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/jellydator/ttlcache/v3"
 	"github.com/multiformats/go-multiaddr"
 	"github.com/pkg/errors"
-	"golang.org/x/exp/slices"
 )
 
 //nolint:gochecknoglobals
@@ -117,8 +117,9 @@ func GetPublicIPInfo(ctx context.Context, ip string, token string) (IPInfo, erro
 }
 
 type LocationResolver struct {
-	cache       *ttlcache.Cache[string, IPInfo]
-	ipInfoToken string
+	cache           *ttlcache.Cache[string, IPInfo]
+	persistentCache *PersistentCache[IPInfo]
+	ipInfoToken     string
 }
 
 func NewLocationResolver(ipInfoToken string, ttl time.Duration) LocationResolver {
@@ -127,23 +128,52 @@ func NewLocationResolver(ipInfoToken string, ttl time.Duration) LocationResolver
 		ttlcache.WithTTL[string, IPInfo](ttl),
 		ttlcache.WithDisableTouchOnHit[string, IPInfo]())
 	return LocationResolver{
-		cache,
-		ipInfoToken,
+		cache:       cache,
+		ipInfoToken: ipInfoToken,
 	}
 }
 
+// SetPersistentCache makes the resolver consult and populate the given cache behind the in-memory one.
+func (l *LocationResolver) SetPersistentCache(cache *PersistentCache[IPInfo]) {
+	l.persistentCache = cache
+}
+
 func (l LocationResolver) ResolveIP(ctx context.Context, ip net.IP) (IPInfo, error) {
 	ipString := ip.String()
 	if ipInfo := l.cache.Get(ipString); ipInfo != nil && !ipInfo.IsExpired() {
 		return ipInfo.Value(), nil
 	}
 
+	logger := logging.Logger("location_resolver")
+	if l.persistentCache != nil {
+		entry, err := l.persistentCache.Get(ctx, ipString)
+		if err != nil {
+			logger.With("ip", ipString, "err", err).Warn("failed to read persistent cache")
+		} else if entry != nil {
+			if entry.Error != nil {
+				return IPInfo{}, errors.Wrap(entry.Error.Err(), "failed to get IP info (cached)")
+			}
+			l.cache.Set(ipString, *entry.Value, time.Until(entry.ExpiresAt))
+			return *entry.Value, nil
+		}
+	}
+
 	ipInfo, err := GetPublicIPInfo(ctx, ipString, l.ipInfoToken)
 	if err != nil {
+		if l.persistentCache != nil && ctx.Err() == nil {
+			if cacheErr := l.persistentCache.PutError(ctx, ipString, err); cacheErr != nil {
+				logger.With("ip", ipString, "err", cacheErr).Warn("failed to write persistent cache")
+			}
+		}
 		return IPInfo{}, errors.Wrap(err, "failed to get IP info")
 	}
 
 	l.cache.Set(ipString, ipInfo, ttlcache.DefaultTTL)
+	if l.persistentCache != nil {
+		if _, err := l.persistentCache.Put(ctx, ipString, ipInfo); err != nil {
+			logger.With("ip", ipString, "err", err).Warn("failed to write persistent cache")
+		}
+	}
 	return ipInfo, nil
 }
 
@@ -156,103 +186,112 @@ func (l LocationResolver) ResolveIPStr(ctx context.Context, ip string) (IPInfo,
 	return l.ResolveIP(ctx, parsed)
 }
 
+// ResolveMultiaddr returns the primary location of all IPs the multiaddr resolves to.
 func (l LocationResolver) ResolveMultiaddr(ctx context.Context, addr multiaddr.Multiaddr) (IPInfo, error) {
-	host, isHostName, _, err := DecodeMultiaddr(addr)
-	if err != nil {
-		return IPInfo{}, errors.Wrap(err, "failed to decode multiaddr")
-	}
+	return l.ResolveMultiaddrs(ctx, []multiaddr.Multiaddr{addr})
+}
 
-	if isHostName {
-		ips, err := net.LookupIP(host)
-		if err != nil {
-			return IPInfo{}, requesterror.HostLookupError{Host: host, Err: err}
-		}
+func (l LocationResolver) ResolveMultiaddrsBytes(ctx context.Context, bytesAddrs []abi.Multiaddrs) (IPInfo, error) {
+	return l.ResolveMultiaddrs(ctx, convert.AbiToMultiaddrsSkippingError(bytesAddrs))
+}
 
-		host = ips[0].String()
+// ResolveMultiaddrs returns the primary location of the provider, as picked by PrimaryLocation.
+func (l LocationResolver) ResolveMultiaddrs(ctx context.Context, addrs []multiaddr.Multiaddr) (IPInfo, error) {
+	locations, err := l.ResolveAllMultiaddrs(ctx, addrs)
+	if err != nil {
+		return IPInfo{}, err
 	}
 
-	return l.ResolveIPStr(ctx, host)
+	return PrimaryLocation(locations), nil
 }
 
-func (l LocationResolver) ResolveMultiaddrsBytes(ctx context.Context, bytesAddrs []abi.Multiaddrs) (IPInfo, error) {
-	return l.ResolveMultiaddrs(ctx, convert.AbiToMultiaddrsSkippingError(bytesAddrs))
+func (l LocationResolver) ResolveAllMultiaddrsBytes(ctx context.Context, bytesAddrs []abi.Multiaddrs) ([]IPInfo, error) {
+	return l.ResolveAllMultiaddrs(ctx, convert.AbiToMultiaddrsSkippingError(bytesAddrs))
 }
 
-func (l LocationResolver) ResolveMultiaddrs(ctx context.Context, addrs []multiaddr.Multiaddr) (IPInfo, error) {
+// ResolveAllMultiaddrs returns the location of every distinct IP the multiaddrs resolve to,
+// in the order the multiaddrs are listed. IPs that cannot be located, i.e. bogons, are skipped,
+// and an error is only returned if none of them can be located.
+func (l LocationResolver) ResolveAllMultiaddrs(ctx context.Context, addrs []multiaddr.Multiaddr) ([]IPInfo, error) {
 	var lastErr error
+	var locations []IPInfo
+	seen := make(map[string]struct{})
 	logger := logging.Logger("location_resolver")
 	for _, addr := range addrs {
-		ipInfo, err := l.ResolveMultiaddr(ctx, addr)
+		ips, err := ResolveMultiaddrIPs(ctx, addr)
 		if err != nil {
 			lastErr = err
 			logger.With("err", err).Debugf("Failed to resolve multiaddr %s", addr)
 			continue
 		}
 
-		return ipInfo, nil
-	}
-
-	if lastErr != nil {
-		return IPInfo{}, lastErr
-	}
-
-	return IPInfo{}, requesterror.NoValidMultiAddrError{}
-}
-
-type IsHostName = bool
-type PortNumber = int
-type IPOrHost = string
+		for _, ip := range ips {
+			if _, ok := seen[ip.String()]; ok {
+				continue
+			}
+			seen[ip.String()] = struct{}{}
 
-func DecodeMultiaddr(addr multiaddr.Multiaddr) (IPOrHost, IsHostName, PortNumber, error) {
-	protocols := addr.Protocols()
-	isHostName := false
-	const expectedProtocolCount = 2
+			ipInfo, err := l.ResolveIP(ctx, ip)
+			if err != nil {
+				lastErr = err
+				logger.With("err", err).Debugf("Failed to locate %s of multiaddr %s", ip, addr)
+				continue
+			}
 
-	if len(protocols) != expectedProtocolCount {
-		return "", false, 0, errors.New("multiaddr does not contain two protocols")
+			locations = append(locations, ipInfo)
+		}
 	}
 
-	if !slices.Contains(
-		[]int{
-			multiaddr.P_IP4, multiaddr.P_IP6,
-			multiaddr.P_DNS4, multiaddr.P_DNS6,
-			multiaddr.P_DNS, multiaddr.P_DNSADDR,
-		}, protocols[0].Code,
-	) {
-		return "", false, 0, errors.New("multiaddr does not contain a valid ip or dns protocol")
+	if len(locations) > 0 {
+		return locations, nil
 	}
 
-	if slices.Contains(
-		[]int{
-			multiaddr.P_DNS, multiaddr.P_DNSADDR,
-			multiaddr.P_DNS4, multiaddr.P_DNS6,
-		}, protocols[0].Code,
-	) {
-		isHostName = true
+	if lastErr != nil {
+		return nil, lastErr
 	}
 
-	if protocols[1].Code != multiaddr.P_TCP {
-		return "", false, 0, errors.New("multiaddr does not contain a valid tcp protocol")
+	return nil, requesterror.NoValidMultiAddrError{}
+}
+
+// PrimaryLocation picks the location used for routing tasks to workers.
+// The country that most IPs are located in wins, and ties are broken by the order of the multiaddrs,
+// so a provider with a single data centre keeps the location of its first address.
+func PrimaryLocation(locations []IPInfo) IPInfo {
+	if len(locations) == 0 {
+		return IPInfo{}
 	}
 
-	splitted := multiaddr.Split(addr)
+	countPerCountry := make(map[string]int)
+	for _, location := range locations {
+		countPerCountry[location.Country]++
+	}
 
-	component0, ok := splitted[0].(*multiaddr.Component)
-	if !ok {
-		return "", false, 0, errors.New("failed to cast component")
+	primary := locations[0]
+	for _, location := range locations[1:] {
+		if countPerCountry[location.Country] > countPerCountry[primary.Country] {
+			primary = location
+		}
 	}
 
-	host := component0.Value()
+	return primary
+}
 
-	component1, ok := splitted[1].(*multiaddr.Component)
-	if !ok {
-		return "", false, 0, errors.New("failed to cast component")
+// TaskLocations converts the locations to be stored in task.Provider.
+func TaskLocations(locations []IPInfo) []task.Location {
+	if len(locations) == 0 {
+		return nil
 	}
 
-	port, err := strconv.Atoi(component1.Value())
-	if err != nil {
-		return "", false, 0, errors.Wrap(err, "failed to parse port")
+	result := make([]task.Location, len(locations))
+	for i, location := range locations {
+		result[i] = task.Location{
+			IP:        location.IP,
+			City:      location.City,
+			Region:    location.Region,
+			Country:   location.Country,
+			Continent: location.Continent,
+			ASN:       location.ASN,
+		}
 	}
-
-	return host, isHostName, port, nil
+	return result
 }
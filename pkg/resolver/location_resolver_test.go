@@ -0,0 +1,19 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrimaryLocation(t *testing.T) {
+	locations := []IPInfo{
+		{IP: "1.1.1.1", Country: "US"},
+		{IP: "2.2.2.2", Country: "DE"},
+		{IP: "3.3.3.3", Country: "DE"},
+	}
+
+	assert.Equal(t, "2.2.2.2", PrimaryLocation(locations).IP)
+	assert.Equal(t, "1.1.1.1", PrimaryLocation(locations[:2]).IP)
+	assert.Equal(t, IPInfo{}, PrimaryLocation(nil))
+}
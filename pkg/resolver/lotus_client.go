@@ -0,0 +1,279 @@
+package resolver
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/env"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/model"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/pkg/errors"
+	"github.com/ybbus/jsonrpc/v3"
+)
+
+// An endpoint is considered unhealthy after this many consecutive failures,
+// until a health check or a later call succeeds.
+const maxConsecutiveErrors = 3
+
+type LotusEndpoint struct {
+	URL   string
+	Token string
+}
+
+// LotusEndpointsFromEnv reads the comma separated LOTUS_API_URL and LOTUS_API_TOKEN.
+// Tokens are matched to URLs by position, and a missing token means no authorization.
+// It defaults to the public endpoint of the network chosen by NETWORK.
+func LotusEndpointsFromEnv() []LotusEndpoint {
+	urls := strings.Split(env.GetString(env.LotusAPIUrl, model.GetNetwork().LotusAPIUrl), ",")
+	tokens := strings.Split(env.GetString(env.LotusAPIToken, ""), ",")
+	endpoints := make([]LotusEndpoint, 0, len(urls))
+	for i, url := range urls {
+		url = strings.TrimSpace(url)
+		if url == "" {
+			continue
+		}
+		token := ""
+		if i < len(tokens) {
+			token = strings.TrimSpace(tokens[i])
+		}
+		endpoints = append(endpoints, LotusEndpoint{URL: url, Token: token})
+	}
+	return endpoints
+}
+
+type EndpointStats struct {
+	URL               string
+	Requests          uint64
+	Errors            uint64
+	Timeouts          uint64
+	Mismatches        uint64
+	ConsecutiveErrors int
+	LastError         string
+	LastErrorAt       time.Time
+	LastLatency       time.Duration
+	Healthy           bool
+}
+
+type lotusEndpoint struct {
+	client jsonrpc.RPCClient
+	index  int
+	stats  EndpointStats
+}
+
+// LotusClient sends JSON-RPC calls to a list of Lotus endpoints, preferring the healthiest one
+// and failing over to the next on transport errors or timeouts.
+type LotusClient struct {
+	mu        sync.Mutex
+	endpoints []*lotusEndpoint
+	timeout   time.Duration
+}
+
+func NewLotusClient(endpoints []LotusEndpoint, timeout time.Duration) (*LotusClient, error) {
+	if len(endpoints) == 0 {
+		return nil, errors.New("no lotus endpoint configured")
+	}
+
+	client := &LotusClient{timeout: timeout}
+	for i, endpoint := range endpoints {
+		var rpcClient jsonrpc.RPCClient
+		if endpoint.Token == "" {
+			rpcClient = jsonrpc.NewClient(endpoint.URL)
+		} else {
+			rpcClient = jsonrpc.NewClientWithOpts(endpoint.URL, &jsonrpc.RPCClientOpts{
+				CustomHeaders: map[string]string{
+					"Authorization": "Bearer " + endpoint.Token,
+				},
+			})
+		}
+		client.endpoints = append(client.endpoints, &lotusEndpoint{
+			client: rpcClient,
+			index:  i,
+			stats:  EndpointStats{URL: endpoint.URL, Healthy: true},
+		})
+	}
+
+	return client, nil
+}
+
+// ranked returns the endpoints ordered by health, then by recent errors, then by configured order.
+func (c *LotusClient) ranked() []*lotusEndpoint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ranked := make([]*lotusEndpoint, len(c.endpoints))
+	copy(ranked, c.endpoints)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i].stats, ranked[j].stats
+		if a.Healthy != b.Healthy {
+			return a.Healthy
+		}
+		if a.ConsecutiveErrors != b.ConsecutiveErrors {
+			return a.ConsecutiveErrors < b.ConsecutiveErrors
+		}
+		return ranked[i].index < ranked[j].index
+	})
+	return ranked
+}
+
+func (c *LotusClient) record(endpoint *lotusEndpoint, latency time.Duration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := &endpoint.stats
+	stats.Requests++
+	stats.LastLatency = latency
+	if err == nil {
+		stats.ConsecutiveErrors = 0
+		stats.Healthy = true
+		return
+	}
+
+	stats.Errors++
+	if errors.Is(err, context.DeadlineExceeded) {
+		stats.Timeouts++
+	}
+	stats.ConsecutiveErrors++
+	stats.LastError = err.Error()
+	stats.LastErrorAt = time.Now().UTC()
+	if stats.ConsecutiveErrors >= maxConsecutiveErrors {
+		stats.Healthy = false
+	}
+}
+
+func (c *LotusClient) callOn(
+	ctx context.Context,
+	endpoint *lotusEndpoint,
+	out interface{},
+	method string,
+	params ...interface{},
+) error {
+	callCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	start := time.Now()
+	err := endpoint.client.CallFor(callCtx, out, method, params...)
+	if err != nil && callCtx.Err() != nil {
+		err = errors.Wrap(callCtx.Err(), err.Error())
+	}
+
+	// A JSON-RPC error is a valid answer from a healthy node, e.g. actor not found
+	var rpcError *jsonrpc.RPCError
+	if errors.As(err, &rpcError) {
+		c.record(endpoint, time.Since(start), nil)
+		return err
+	}
+
+	c.record(endpoint, time.Since(start), err)
+	return err
+}
+
+// CallFor calls the method on the healthiest endpoint and fails over to the others on transport errors.
+func (c *LotusClient) CallFor(ctx context.Context, out interface{}, method string, params ...interface{}) error {
+	logger := logging.Logger("lotus_client")
+	var lastErr error
+	for _, endpoint := range c.ranked() {
+		err := c.callOn(ctx, endpoint, out, method, params...)
+		var rpcError *jsonrpc.RPCError
+		if err == nil || errors.As(err, &rpcError) {
+			//nolint:wrapcheck
+			return err
+		}
+
+		if ctx.Err() != nil {
+			//nolint:wrapcheck
+			return ctx.Err()
+		}
+
+		logger.With("url", endpoint.stats.URL, "method", method, "err", err).Warn("lotus call failed, failing over")
+		lastErr = err
+	}
+
+	return errors.Wrapf(lastErr, "all lotus endpoints failed for %s", method)
+}
+
+// LotusAnswer is the answer of an endpoint to a call made with CallForEach.
+type LotusAnswer struct {
+	URL string
+	Out interface{}
+}
+
+// CallForEach calls the method on up to n endpoints in ranked order and returns the successful answers.
+// It is used to cross-check answers between nodes. newOut must return a fresh pointer for each call.
+func (c *LotusClient) CallForEach(
+	ctx context.Context,
+	n int,
+	newOut func() interface{},
+	method string,
+	params ...interface{},
+) ([]LotusAnswer, error) {
+	var outs []LotusAnswer
+	var lastErr error
+	for _, endpoint := range c.ranked() {
+		if len(outs) == n {
+			break
+		}
+		out := newOut()
+		err := c.callOn(ctx, endpoint, out, method, params...)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		outs = append(outs, LotusAnswer{URL: endpoint.stats.URL, Out: out})
+	}
+
+	if len(outs) == 0 {
+		return nil, errors.Wrapf(lastErr, "all lotus endpoints failed for %s", method)
+	}
+
+	return outs, nil
+}
+
+// RecordMismatch marks that the endpoint with the given URL returned an answer the others disagreed with.
+func (c *LotusClient) RecordMismatch(url string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, endpoint := range c.endpoints {
+		if endpoint.stats.URL == url {
+			endpoint.stats.Mismatches++
+		}
+	}
+}
+
+// HealthCheck calls Filecoin.ChainHead on every endpoint to update its health. A failed probe counts as a
+// failed call, so an endpoint is only marked unhealthy after maxConsecutiveErrors of them.
+func (c *LotusClient) HealthCheck(ctx context.Context) {
+	logger := logging.Logger("lotus_client")
+	for _, endpoint := range c.ranked() {
+		var head map[string]interface{}
+		err := c.callOn(ctx, endpoint, &head, "Filecoin.ChainHead")
+		if err != nil {
+			logger.With("url", endpoint.stats.URL, "err", err).Warn("lotus health check failed")
+		}
+	}
+}
+
+// StartHealthCheck runs HealthCheck periodically until the context is done.
+func (c *LotusClient) StartHealthCheck(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.HealthCheck(ctx)
+			}
+		}
+	}()
+}
+
+func (c *LotusClient) Stats() []EndpointStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := make([]EndpointStats, len(c.endpoints))
+	for i, endpoint := range c.endpoints {
+		stats[i] = endpoint.stats
+	}
+	return stats
+}
@@ -0,0 +1,89 @@
+package resolver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLotusClientFailover(t *testing.T) {
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer broken.Close()
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":0,"result":{"PeerId":"12D3KooW","Multiaddrs":[]}}`))
+	}))
+	defer working.Close()
+
+	client, err := NewLotusClient([]LotusEndpoint{{URL: broken.URL}, {URL: working.URL}}, time.Second)
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		var minerInfo MinerInfo
+		err = client.CallFor(context.Background(), &minerInfo, "Filecoin.StateMinerInfo", "f01000", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "12D3KooW", minerInfo.PeerId)
+	}
+
+	// After the first failure, the broken endpoint is ranked behind the working one
+	stats := client.Stats()
+	assert.Equal(t, uint64(1), stats[0].Requests)
+	assert.Equal(t, uint64(1), stats[0].Errors)
+	assert.Equal(t, uint64(3), stats[1].Requests)
+	assert.Equal(t, uint64(0), stats[1].Errors)
+}
+
+func minerInfoServer(peerID string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":0,"result":{"PeerId":"` + peerID + `","Multiaddrs":[]}}`))
+	}))
+}
+
+func TestCrossCheckRecordsDivergentEndpoint(t *testing.T) {
+	diverging := minerInfoServer("12D3KooX")
+	defer diverging.Close()
+	first := minerInfoServer("12D3KooW")
+	defer first.Close()
+	second := minerInfoServer("12D3KooW")
+	defer second.Close()
+
+	resolver, err := NewProviderResolver([]LotusEndpoint{{URL: diverging.URL}, {URL: first.URL}, {URL: second.URL}},
+		time.Minute)
+	assert.NoError(t, err)
+	resolver.SetCrossCheck(true)
+	minerInfo, err := resolver.FetchMinerInfo(context.Background(), "f01000")
+	assert.NoError(t, err)
+	assert.Equal(t, "12D3KooW", minerInfo.PeerId)
+
+	stats := resolver.LotusClient().Stats()
+	assert.Equal(t, []uint64{1, 0, 0}, []uint64{stats[0].Mismatches, stats[1].Mismatches, stats[2].Mismatches})
+
+	// Without a majority, both endpoints are counted and the lookup fails
+	resolver, err = NewProviderResolver([]LotusEndpoint{{URL: diverging.URL}, {URL: first.URL}}, time.Minute)
+	assert.NoError(t, err)
+	resolver.SetCrossCheck(true)
+	_, err = resolver.FetchMinerInfo(context.Background(), "f01000")
+	assert.Error(t, err)
+	stats = resolver.LotusClient().Stats()
+	assert.Equal(t, []uint64{1, 1}, []uint64{stats[0].Mismatches, stats[1].Mismatches})
+}
+
+func TestHealthCheckThreshold(t *testing.T) {
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer broken.Close()
+
+	client, err := NewLotusClient([]LotusEndpoint{{URL: broken.URL}}, time.Second)
+	assert.NoError(t, err)
+	for i := 1; i < maxConsecutiveErrors; i++ {
+		client.HealthCheck(context.Background())
+		assert.True(t, client.Stats()[0].Healthy)
+	}
+	client.HealthCheck(context.Background())
+	assert.False(t, client.Stats()[0].Healthy)
+}
@@ -0,0 +1,204 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"strconv"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/requesterror"
+	"github.com/multiformats/go-multiaddr"
+	madns "github.com/multiformats/go-multiaddr-dns"
+	"github.com/pkg/errors"
+	"golang.org/x/exp/slices"
+)
+
+type IsHostName = bool
+type PortNumber = int
+type IPOrHost = string
+
+// Maximum depth of nested /dnsaddr records to follow
+const maxDNSAddrDepth = 8
+
+//nolint:gochecknoglobals
+var (
+	hostProtocols = []int{
+		multiaddr.P_IP4, multiaddr.P_IP6,
+		multiaddr.P_DNS4, multiaddr.P_DNS6,
+		multiaddr.P_DNS, multiaddr.P_DNSADDR,
+	}
+	hostNameProtocols = []int{
+		multiaddr.P_DNS, multiaddr.P_DNSADDR,
+		multiaddr.P_DNS4, multiaddr.P_DNS6,
+	}
+	// Protocols that may follow /tcp, i.e. TCP and websocket transports with their security and HTTP layers
+	tcpSuffixProtocols = []int{
+		multiaddr.P_TLS, multiaddr.P_SNI, multiaddr.P_NOISE,
+		multiaddr.P_WS, multiaddr.P_WSS,
+		multiaddr.P_HTTP, multiaddr.P_HTTPS,
+		multiaddr.P_P2P,
+	}
+	// Protocols that may follow /udp, i.e. QUIC and WebTransport
+	udpSuffixProtocols = []int{
+		multiaddr.P_QUIC, multiaddr.P_QUIC_V1,
+		multiaddr.P_WEBTRANSPORT, multiaddr.P_CERTHASH,
+		multiaddr.P_P2P,
+	}
+)
+
+// DecodeMultiaddr extracts the host and port of any multiaddr that the libp2p host or the HTTP client can dial,
+// i.e. [/ip6zone]/{ip4,ip6,dns,dns4,dns6}/{tcp,udp}/... or /dnsaddr/... .
+// A leading /ip6zone is dropped from the returned host. /dnsaddr has no port, so 0 is returned.
+func DecodeMultiaddr(addr multiaddr.Multiaddr) (IPOrHost, IsHostName, PortNumber, error) {
+	components := multiaddr.Split(addr)
+	if len(components) > 0 && components[0].Protocols()[0].Code == multiaddr.P_IP6ZONE {
+		components = components[1:]
+	}
+
+	if len(components) == 0 {
+		return "", false, 0, errors.New("multiaddr is empty")
+	}
+
+	component0, ok := components[0].(*multiaddr.Component)
+	if !ok {
+		return "", false, 0, errors.New("failed to cast component")
+	}
+
+	code := component0.Protocol().Code
+	if !slices.Contains(hostProtocols, code) {
+		return "", false, 0, errors.New("multiaddr does not contain a valid ip or dns protocol")
+	}
+
+	host := component0.Value()
+	isHostName := slices.Contains(hostNameProtocols, code)
+	if code == multiaddr.P_DNSADDR {
+		// The transports are defined by the TXT records, so only the /p2p suffix is allowed here
+		for _, component := range components[1:] {
+			if component.Protocols()[0].Code != multiaddr.P_P2P {
+				return "", false, 0, errors.New("dnsaddr multiaddr can only be followed by p2p")
+			}
+		}
+		return host, true, 0, nil
+	}
+
+	if len(components) < 2 {
+		return "", false, 0, errors.New("multiaddr does not contain a transport protocol")
+	}
+
+	component1, ok := components[1].(*multiaddr.Component)
+	if !ok {
+		return "", false, 0, errors.New("failed to cast component")
+	}
+
+	var allowedSuffix []int
+	switch component1.Protocol().Code {
+	case multiaddr.P_TCP:
+		allowedSuffix = tcpSuffixProtocols
+	case multiaddr.P_UDP:
+		allowedSuffix = udpSuffixProtocols
+		// Plain UDP cannot be dialed by the libp2p host
+		if len(components) == 2 {
+			return "", false, 0, errors.New("multiaddr does not contain a valid udp transport")
+		}
+	default:
+		return "", false, 0, errors.New("multiaddr does not contain a valid tcp or udp protocol")
+	}
+
+	for _, component := range components[2:] {
+		if !slices.Contains(allowedSuffix, component.Protocols()[0].Code) {
+			return "", false, 0, errors.Errorf("unsupported protocol %s after %s",
+				component.Protocols()[0].Name, component1.Protocol().Name)
+		}
+	}
+
+	port, err := strconv.Atoi(component1.Value())
+	if err != nil {
+		return "", false, 0, errors.Wrap(err, "failed to parse port")
+	}
+
+	return host, isHostName, port, nil
+}
+
+// MultiaddrResolver turns multiaddrs into the IPs they point to.
+type MultiaddrResolver struct {
+	resolver *madns.Resolver
+}
+
+func NewMultiaddrResolver(backend madns.BasicResolver) (MultiaddrResolver, error) {
+	resolver, err := madns.NewResolver(madns.WithDefaultResolver(backend))
+	if err != nil {
+		return MultiaddrResolver{}, errors.Wrap(err, "failed to create multiaddr resolver")
+	}
+
+	return MultiaddrResolver{resolver: resolver}, nil
+}
+
+//nolint:gochecknoglobals
+var defaultMultiaddrResolver = MultiaddrResolver{resolver: madns.DefaultResolver}
+
+// ResolveMultiaddrIPs returns all candidate IPs of the multiaddr using the system DNS resolver.
+func ResolveMultiaddrIPs(ctx context.Context, addr multiaddr.Multiaddr) ([]net.IP, error) {
+	return defaultMultiaddrResolver.ResolveIPs(ctx, addr)
+}
+
+// ResolveIPs validates the multiaddr with DecodeMultiaddr and returns all candidate IPs.
+// /dns, /dns4 and /dns6 return every A/AAAA answer of the matching family,
+// and /dnsaddr is resolved recursively through its TXT records.
+func (r MultiaddrResolver) ResolveIPs(ctx context.Context, addr multiaddr.Multiaddr) ([]net.IP, error) {
+	ips, err := r.resolveIPs(ctx, addr, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var unique []net.IP
+	for _, ip := range ips {
+		if !slices.ContainsFunc(unique, ip.Equal) {
+			unique = append(unique, ip)
+		}
+	}
+
+	return unique, nil
+}
+
+func (r MultiaddrResolver) resolveIPs(ctx context.Context, addr multiaddr.Multiaddr, depth int) ([]net.IP, error) {
+	host, isHostName, _, err := DecodeMultiaddr(addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode multiaddr")
+	}
+
+	if !isHostName {
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return nil, requesterror.InvalidIPError{IP: host}
+		}
+		return []net.IP{ip}, nil
+	}
+
+	if depth >= maxDNSAddrDepth {
+		return nil, requesterror.HostLookupError{Host: host, Err: errors.New("too many nested dnsaddr records")}
+	}
+
+	resolved, err := r.resolver.Resolve(ctx, addr)
+	if err != nil {
+		return nil, requesterror.HostLookupError{Host: host, Err: err}
+	}
+
+	var ips []net.IP
+	var lastErr error
+	for _, resolvedAddr := range resolved {
+		resolvedIPs, err := r.resolveIPs(ctx, resolvedAddr, depth+1)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		ips = append(ips, resolvedIPs...)
+	}
+
+	if len(ips) == 0 {
+		if lastErr != nil {
+			return nil, lastErr
+		}
+		return nil, requesterror.HostLookupError{Host: host, Err: errors.New("no records found")}
+	}
+
+	return ips, nil
+}
@@ -0,0 +1,71 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/multiformats/go-multiaddr"
+	madns "github.com/multiformats/go-multiaddr-dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeMultiaddr(t *testing.T) {
+	tests := []struct {
+		addr       string
+		host       string
+		isHostName bool
+		port       int
+		valid      bool
+	}{
+		{"/ip4/1.2.3.4/tcp/1234", "1.2.3.4", false, 1234, true},
+		{"/ip6/2001:db8::1/tcp/1234", "2001:db8::1", false, 1234, true},
+		{"/ip4/1.2.3.4/udp/1234/quic-v1", "1.2.3.4", false, 1234, true},
+		{"/ip4/1.2.3.4/udp/1234/quic-v1/webtransport", "1.2.3.4", false, 1234, true},
+		{"/dns4/sp.example.com/tcp/443/tls/ws", "sp.example.com", true, 443, true},
+		{"/dns/sp.example.com/tcp/443/wss", "sp.example.com", true, 443, true},
+		{"/dns6/sp.example.com/tcp/443/https", "sp.example.com", true, 443, true},
+		{"/ip6zone/eth0/ip6/fe80::1/tcp/1234", "fe80::1", false, 1234, true},
+		{"/dnsaddr/sp.example.com", "sp.example.com", true, 0, true},
+		{"/ip4/1.2.3.4/udp/1234", "", false, 0, false},
+		{"/ip4/1.2.3.4", "", false, 0, false},
+		{"/ip4/1.2.3.4/tcp/1234/udp/1234", "", false, 0, false},
+		{"/dnsaddr/sp.example.com/tcp/1234", "", false, 0, false},
+	}
+	for _, test := range tests {
+		addr := multiaddr.StringCast(test.addr)
+		host, isHostName, port, err := DecodeMultiaddr(addr)
+		if !test.valid {
+			assert.Error(t, err, test.addr)
+			continue
+		}
+		assert.NoError(t, err, test.addr)
+		assert.Equal(t, test.host, host, test.addr)
+		assert.Equal(t, test.isHostName, isHostName, test.addr)
+		assert.Equal(t, test.port, port, test.addr)
+	}
+}
+
+func TestResolveIPsFollowsDNSAddr(t *testing.T) {
+	backend := &madns.MockResolver{
+		IP: map[string][]net.IPAddr{
+			"a.example.com": {{IP: net.ParseIP("1.1.1.1")}, {IP: net.ParseIP("2001:db8::1")}},
+			"b.example.com": {{IP: net.ParseIP("2.2.2.2")}},
+		},
+		TXT: map[string][]string{
+			"_dnsaddr.sp.example.com":     {"dnsaddr=/dns4/a.example.com/tcp/1234", "dnsaddr=/dnsaddr/nested.example.com"},
+			"_dnsaddr.nested.example.com": {"dnsaddr=/dns/b.example.com/udp/1234/quic-v1"},
+		},
+	}
+	resolver, err := NewMultiaddrResolver(backend)
+	assert.NoError(t, err)
+
+	ips, err := resolver.ResolveIPs(context.Background(), multiaddr.StringCast("/dnsaddr/sp.example.com"))
+	assert.NoError(t, err)
+	assert.Len(t, ips, 2)
+	assert.True(t, ips[0].Equal(net.ParseIP("1.1.1.1")))
+	assert.True(t, ips[1].Equal(net.ParseIP("2.2.2.2")))
+
+	_, err = resolver.ResolveIPs(context.Background(), multiaddr.StringCast("/dns4/missing.example.com/tcp/1"))
+	assert.Error(t, err)
+}
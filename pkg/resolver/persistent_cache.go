@@ -0,0 +1,375 @@
+package resolver
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/env"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/requesterror"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	ProviderCacheNamespace = "provider"
+	LocationCacheNamespace = "location"
+)
+
+// CachedError is the persisted form of a failed lookup. The kind is kept so that
+// typed errors such as BogonIPError can be restored when the entry is read back.
+type CachedError struct {
+	Kind    string `bson:"kind"`
+	Subject string `bson:"subject,omitempty"`
+	Message string `bson:"message"`
+}
+
+const (
+	errorKindBogonIP          = "bogon_ip"
+	errorKindInvalidIP        = "invalid_ip"
+	errorKindHostLookup       = "host_lookup"
+	errorKindNoValidMultiAddr = "no_valid_multiaddr"
+	errorKindOther            = "other"
+)
+
+func NewCachedError(err error) *CachedError {
+	var bogon requesterror.BogonIPError
+	var invalid requesterror.InvalidIPError
+	var lookup requesterror.HostLookupError
+	switch {
+	case errors.As(err, &bogon):
+		return &CachedError{Kind: errorKindBogonIP, Subject: bogon.IP, Message: err.Error()}
+	case errors.As(err, &invalid):
+		return &CachedError{Kind: errorKindInvalidIP, Subject: invalid.IP, Message: err.Error()}
+	case errors.As(err, &lookup):
+		return &CachedError{Kind: errorKindHostLookup, Subject: lookup.Host, Message: err.Error()}
+	case errors.As(err, &requesterror.NoValidMultiAddrError{}):
+		return &CachedError{Kind: errorKindNoValidMultiAddr, Message: err.Error()}
+	default:
+		return &CachedError{Kind: errorKindOther, Message: err.Error()}
+	}
+}
+
+// definitiveMessages are returned by Lotus for addresses that are not those of an existing provider.
+//
+//nolint:gochecknoglobals
+var definitiveMessages = []string{
+	"actor not found",
+	"invalid address",
+	"unknown address",
+}
+
+// IsDefinitiveError returns whether a failed lookup would fail the same way if retried right away, e.g. a bogon IP,
+// a provider that does not exist or a host without records, as opposed to a timeout or a network error.
+func IsDefinitiveError(err error) bool {
+	var bogon requesterror.BogonIPError
+	var invalid requesterror.InvalidIPError
+	var lookup requesterror.HostLookupError
+	var corrupt base64.CorruptInputError
+	switch {
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		return false
+	case errors.As(err, &bogon), errors.As(err, &invalid), errors.As(err, &requesterror.NoValidMultiAddrError{}),
+		errors.As(err, &corrupt):
+		return true
+	case errors.As(err, &lookup):
+		var dnsErr *net.DNSError
+		if errors.As(lookup.Err, &dnsErr) {
+			return dnsErr.IsNotFound
+		}
+		return lookup.Err != nil && !isTimeout(lookup.Err)
+	}
+
+	for _, message := range definitiveMessages {
+		if strings.Contains(err.Error(), message) {
+			return true
+		}
+	}
+	return false
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func (c CachedError) Err() error {
+	switch c.Kind {
+	case errorKindBogonIP:
+		return requesterror.BogonIPError{IP: c.Subject}
+	case errorKindInvalidIP:
+		return requesterror.InvalidIPError{IP: c.Subject}
+	case errorKindHostLookup:
+		return requesterror.HostLookupError{Host: c.Subject, Err: errors.New(c.Message)}
+	case errorKindNoValidMultiAddr:
+		return requesterror.NoValidMultiAddrError{}
+	default:
+		return errors.New(c.Message)
+	}
+}
+
+type CacheEntry[T any] struct {
+	ID        string       `bson:"_id"`
+	Namespace string       `bson:"namespace"`
+	Key       string       `bson:"key"`
+	Value     *T           `bson:"value,omitempty"`
+	Error     *CachedError `bson:"error,omitempty"`
+	UpdatedAt time.Time    `bson:"updated_at"`
+	ExpiresAt time.Time    `bson:"expires_at"`
+	// ChangedAt is the last time a successful lookup returned a different value than the previous one
+	ChangedAt time.Time `bson:"changed_at,omitempty"`
+	Previous  *T        `bson:"previous,omitempty"`
+}
+
+func (e CacheEntry[T]) IsExpired() bool {
+	return time.Now().After(e.ExpiresAt)
+}
+
+// PersistentCache is a mongo backed cache shared by all processes that point to the same collection.
+// Successful lookups are kept for ttl while failed lookups are kept for negativeTTL.
+type PersistentCache[T any] struct {
+	collection  *mongo.Collection
+	namespace   string
+	ttl         time.Duration
+	negativeTTL time.Duration
+	equal       func(a, b T) bool
+}
+
+// NewPersistentCache creates a cache for the given namespace. If equal is not nil,
+// it is used to detect when a newly stored value differs from the previous one.
+func NewPersistentCache[T any](
+	collection *mongo.Collection,
+	namespace string,
+	ttl time.Duration,
+	negativeTTL time.Duration,
+	equal func(a, b T) bool,
+) *PersistentCache[T] {
+	return &PersistentCache[T]{
+		collection:  collection,
+		namespace:   namespace,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		equal:       equal,
+	}
+}
+
+func (c *PersistentCache[T]) id(key string) string {
+	return c.namespace + "/" + key
+}
+
+// Peek returns the entry for the key even if it has expired, or nil if it does not exist.
+func (c *PersistentCache[T]) Peek(ctx context.Context, key string) (*CacheEntry[T], error) {
+	entry := new(CacheEntry[T])
+	err := c.collection.FindOne(ctx, bson.M{"_id": c.id(key)}).Decode(entry)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find cache entry")
+	}
+
+	return entry, nil
+}
+
+// Get returns the entry for the key, or nil if it does not exist or has expired.
+func (c *PersistentCache[T]) Get(ctx context.Context, key string) (*CacheEntry[T], error) {
+	entry, err := c.Peek(ctx, key)
+	if err != nil || entry == nil || entry.IsExpired() {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// Put stores a successful lookup and reports whether the value changed compared to the previous one.
+func (c *PersistentCache[T]) Put(ctx context.Context, key string, value T) (bool, error) {
+	previous, err := c.Peek(ctx, key)
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now().UTC()
+	entry := CacheEntry[T]{
+		ID:        c.id(key),
+		Namespace: c.namespace,
+		Key:       key,
+		Value:     &value,
+		UpdatedAt: now,
+		ExpiresAt: now.Add(c.ttl),
+	}
+
+	changed := false
+	if previous != nil {
+		entry.ChangedAt = previous.ChangedAt
+		entry.Previous = previous.Previous
+		if previous.Value != nil && c.equal != nil && !c.equal(*previous.Value, value) {
+			changed = true
+			entry.ChangedAt = now
+			entry.Previous = previous.Value
+		}
+	}
+
+	err = c.replace(ctx, entry)
+	return changed, err
+}
+
+// PutError stores a failed lookup so that it is not retried until negativeTTL has passed.
+// The last successful value is kept for change tracking. Only definitive failures are stored, transient ones
+// such as timeouts are retried on the next lookup.
+func (c *PersistentCache[T]) PutError(ctx context.Context, key string, lookupErr error) error {
+	if !IsDefinitiveError(lookupErr) {
+		return nil
+	}
+
+	previous, err := c.Peek(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	entry := CacheEntry[T]{
+		ID:        c.id(key),
+		Namespace: c.namespace,
+		Key:       key,
+		Error:     NewCachedError(lookupErr),
+		UpdatedAt: now,
+		ExpiresAt: now.Add(c.negativeTTL),
+	}
+	if previous != nil {
+		entry.ChangedAt = previous.ChangedAt
+		entry.Previous = previous.Value
+		if entry.Previous == nil {
+			entry.Previous = previous.Previous
+		}
+	}
+
+	return c.replace(ctx, entry)
+}
+
+func (c *PersistentCache[T]) replace(ctx context.Context, entry CacheEntry[T]) error {
+	_, err := c.collection.ReplaceOne(ctx, bson.M{"_id": entry.ID}, entry, options.Replace().SetUpsert(true))
+	if err != nil {
+		return errors.Wrap(err, "failed to save cache entry")
+	}
+
+	return nil
+}
+
+type CacheListFilter struct {
+	ErrorsOnly  bool
+	ChangedOnly bool
+	ExpiredOnly bool
+}
+
+func (f CacheListFilter) toBson(namespace string) bson.M {
+	filter := bson.M{"namespace": namespace}
+	if f.ErrorsOnly {
+		filter["error"] = bson.M{"$exists": true}
+	}
+	if f.ChangedOnly {
+		filter["changed_at"] = bson.M{"$exists": true}
+	}
+	if f.ExpiredOnly {
+		filter["expires_at"] = bson.M{"$lt": time.Now().UTC()}
+	}
+	return filter
+}
+
+func (c *PersistentCache[T]) List(ctx context.Context, filter CacheListFilter) ([]CacheEntry[T], error) {
+	cursor, err := c.collection.Find(ctx, filter.toBson(c.namespace), options.Find().SetSort(bson.M{"key": 1}))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list cache entries")
+	}
+
+	var entries []CacheEntry[T]
+	err = cursor.All(ctx, &entries)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode cache entries")
+	}
+
+	return entries, nil
+}
+
+// Invalidate removes the given keys from the cache and returns the number of removed entries.
+func (c *PersistentCache[T]) Invalidate(ctx context.Context, keys ...string) (int64, error) {
+	ids := make([]string, len(keys))
+	for i, key := range keys {
+		ids[i] = c.id(key)
+	}
+
+	result, err := c.collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to invalidate cache entries")
+	}
+
+	return result.DeletedCount, nil
+}
+
+// InvalidateMatching removes all entries of the namespace that match the filter.
+func (c *PersistentCache[T]) InvalidateMatching(ctx context.Context, filter CacheListFilter) (int64, error) {
+	result, err := c.collection.DeleteMany(ctx, filter.toBson(c.namespace))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to invalidate cache entries")
+	}
+
+	return result.DeletedCount, nil
+}
+
+// OpenCacheCollection connects to the resolver cache database.
+// It returns nil if RESOLVER_CACHE_MONGO_URI is not set, in which case only the in-memory caches are used.
+func OpenCacheCollection(ctx context.Context) (*mongo.Collection, error) {
+	uri := env.GetString(env.ResolverCacheMongoURI, "")
+	if uri == "" {
+		return nil, nil
+	}
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to mongo resolver cache")
+	}
+
+	collection := client.Database(env.GetRequiredString(env.ResolverCacheMongoDatabase)).
+		Collection("resolver_cache")
+	_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "namespace", Value: 1}, {Key: "key", Value: 1}},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create resolver cache index")
+	}
+
+	return collection, nil
+}
+
+// EnablePersistentCacheFromEnv attaches the persistent cache to both resolvers if it is configured.
+func EnablePersistentCacheFromEnv(
+	ctx context.Context,
+	providerResolver *ProviderResolver,
+	locationResolver *LocationResolver,
+) error {
+	collection, err := OpenCacheCollection(ctx)
+	if err != nil {
+		return err
+	}
+
+	if collection == nil {
+		return nil
+	}
+
+	providerResolver.SetPersistentCache(NewPersistentCache[MinerInfo](
+		collection,
+		ProviderCacheNamespace,
+		env.GetDuration(env.ProviderCacheTTL, 24*time.Hour),
+		env.GetDuration(env.ProviderNegativeCacheTTL, time.Hour),
+		SameEndpoint))
+	locationResolver.SetPersistentCache(NewPersistentCache[IPInfo](
+		collection,
+		LocationCacheNamespace,
+		env.GetDuration(env.LocationCacheTTL, 24*time.Hour),
+		env.GetDuration(env.LocationNegativeCacheTTL, time.Hour),
+		nil))
+	return nil
+}
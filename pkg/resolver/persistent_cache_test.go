@@ -0,0 +1,57 @@
+package resolver
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"testing"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/requesterror"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCachedErrorKeepsErrorType(t *testing.T) {
+	err := errors.Wrap(requesterror.BogonIPError{IP: "10.0.0.1"}, "failed to get IP info")
+	restored := NewCachedError(err).Err()
+	assert.ErrorAs(t, restored, &requesterror.BogonIPError{})
+	assert.Equal(t, "bogon IP: 10.0.0.1", restored.Error())
+
+	restored = NewCachedError(requesterror.HostLookupError{Host: "example.com", Err: errors.New("nxdomain")}).Err()
+	assert.ErrorAs(t, restored, &requesterror.HostLookupError{})
+
+	restored = NewCachedError(errors.New("rpc error")).Err()
+	assert.EqualError(t, restored, "rpc error")
+}
+
+func TestSameEndpoint(t *testing.T) {
+	a := MinerInfo{PeerId: "12D3KooW", Multiaddrs: [][]byte{{1, 2}}}
+	assert.True(t, SameEndpoint(a, MinerInfo{PeerId: "12D3KooW", Multiaddrs: [][]byte{{1, 2}}}))
+	assert.False(t, SameEndpoint(a, MinerInfo{PeerId: "12D3KooX", Multiaddrs: [][]byte{{1, 2}}}))
+	assert.False(t, SameEndpoint(a, MinerInfo{PeerId: "12D3KooW", Multiaddrs: [][]byte{{1, 3}}}))
+}
+
+func TestIsDefinitiveError(t *testing.T) {
+	_, corrupt := base64.StdEncoding.DecodeString("!")
+	for _, err := range []error{
+		errors.Wrap(requesterror.BogonIPError{IP: "10.0.0.1"}, "failed to get IP info"),
+		requesterror.InvalidIPError{IP: "x"},
+		requesterror.NoValidMultiAddrError{},
+		requesterror.HostLookupError{Host: "example.com", Err: &net.DNSError{Err: "no such host", IsNotFound: true}},
+		requesterror.HostLookupError{Host: "example.com", Err: errors.New("no records found")},
+		errors.Wrap(errors.New("resolution lookup failed (f09999): actor not found"), "failed to get miner info"),
+		errors.Wrap(corrupt, "failed to decode multiaddr"),
+	} {
+		assert.True(t, IsDefinitiveError(err), err.Error())
+	}
+
+	for _, err := range []error{
+		errors.Wrap(context.DeadlineExceeded, "failed to get miner info"),
+		context.Canceled,
+		requesterror.HostLookupError{Host: "example.com", Err: &net.DNSError{Err: "i/o timeout", IsTimeout: true}},
+		errors.New("failed to get IP info: 502 Bad Gateway"),
+		errors.Wrap(errors.New("dial tcp: connection refused"), "failed to get miner info"),
+	} {
+		assert.False(t, IsDefinitiveError(err), err.Error())
+	}
+}
@@ -0,0 +1,58 @@
+package resolver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/model"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/net"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/testutil/fakesp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtocolProvider(t *testing.T) {
+	ctx := context.Background()
+	sp, err := fakesp.New(ctx, fakesp.Config{})
+	assert.NoError(t, err)
+	defer sp.Close()
+
+	host, err := net.InitHost(ctx, nil)
+	assert.NoError(t, err)
+	defer host.Close()
+
+	provider := ProtocolResolver(host, 10*time.Second)
+	isBoost, err := provider.IsBoostProvider(ctx, sp.AddrInfo())
+	assert.NoError(t, err)
+	assert.True(t, isBoost)
+
+	protocols, err := provider.GetRetrievalProtocols(ctx, sp.AddrInfo())
+	assert.NoError(t, err)
+	assert.Equal(t, sp.QueryResponse.Protocols, protocols)
+	names := make([]string, 0, len(protocols))
+	for _, protocol := range protocols {
+		names = append(names, protocol.Name)
+	}
+	assert.Equal(t, []string{string(model.Bitswap), string(model.Libp2p), string(model.HTTP)}, names)
+}
+
+func TestProtocolProviderNotBoost(t *testing.T) {
+	ctx := context.Background()
+	sp, err := fakesp.New(ctx, fakesp.Config{DisableTransports: true})
+	assert.NoError(t, err)
+	defer sp.Close()
+
+	host, err := net.InitHost(ctx, nil)
+	assert.NoError(t, err)
+	defer host.Close()
+
+	provider := ProtocolResolver(host, 10*time.Second)
+	isBoost, err := provider.IsBoostProvider(ctx, sp.AddrInfo())
+	assert.NoError(t, err)
+	assert.False(t, isBoost)
+
+	protocols, err := provider.GetRetrievalProtocols(ctx, sp.AddrInfo())
+	assert.NoError(t, err)
+	assert.Len(t, protocols, 1)
+	assert.Equal(t, string(model.Libp2p), protocols[0].Name)
+}
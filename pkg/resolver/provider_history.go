@@ -0,0 +1,110 @@
+package resolver
+
+import (
+	"context"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/env"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/model"
+	"github.com/jellydator/ttlcache/v3"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ProviderHistory stores a snapshot of a provider's peer ID and multiaddrs every time they change.
+type ProviderHistory struct {
+	collection *mongo.Collection
+	// Snapshot ID currently in force per provider, so that task creation does not query mongo for every deal
+	inForce *ttlcache.Cache[string, string]
+}
+
+func NewProviderHistory(collection *mongo.Collection) *ProviderHistory {
+	return &ProviderHistory{
+		collection: collection,
+		inForce: ttlcache.New[string, string](
+			//nolint:gomnd
+			ttlcache.WithTTL[string, string](5*time.Minute),
+			ttlcache.WithDisableTouchOnHit[string, string]()),
+	}
+}
+
+// OpenProviderHistoryFromEnv opens the provider_history collection in the result database.
+// It returns nil if RESULT_MONGO_URI is not set.
+func OpenProviderHistoryFromEnv(ctx context.Context) (*ProviderHistory, error) {
+	uri := env.GetString(env.ResultMongoURI, "")
+	if uri == "" {
+		return nil, nil
+	}
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to mongo resultDB")
+	}
+
+	collection := client.Database(env.GetRequiredString(env.ResultMongoDatabase)).Collection("provider_history")
+	_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "provider", Value: 1}, {Key: "epoch", Value: -1}},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create provider history index")
+	}
+
+	return NewProviderHistory(collection), nil
+}
+
+// Latest returns the most recent snapshot of the provider, or nil if there is none.
+func (h *ProviderHistory) Latest(ctx context.Context, provider string) (*model.ProviderSnapshot, error) {
+	snapshot := new(model.ProviderSnapshot)
+	err := h.collection.FindOne(ctx, bson.M{"provider": provider},
+		options.FindOne().SetSort(bson.D{{Key: "epoch", Value: -1}, {Key: "_id", Value: -1}})).Decode(snapshot)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find provider snapshot")
+	}
+
+	return snapshot, nil
+}
+
+// Record inserts the snapshot only if it differs from the latest one, and reports whether it was inserted.
+func (h *ProviderHistory) Record(ctx context.Context, snapshot model.ProviderSnapshot) (bool, error) {
+	latest, err := h.Latest(ctx, snapshot.Provider)
+	if err != nil {
+		return false, err
+	}
+
+	if latest != nil && latest.SameEndpoint(snapshot) {
+		return false, nil
+	}
+
+	_, err = h.collection.InsertOne(ctx, snapshot)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to insert provider snapshot")
+	}
+
+	h.inForce.Delete(snapshot.Provider)
+	return true, nil
+}
+
+// InForce returns the hex ID of the latest snapshot of the provider, or an empty string if there is none.
+func (h *ProviderHistory) InForce(ctx context.Context, provider string) (string, error) {
+	if item := h.inForce.Get(provider); item != nil && !item.IsExpired() {
+		return item.Value(), nil
+	}
+
+	latest, err := h.Latest(ctx, provider)
+	if err != nil {
+		return "", err
+	}
+
+	id := ""
+	if latest != nil {
+		id = latest.ID.Hex()
+	}
+
+	h.inForce.Set(provider, id, ttlcache.DefaultTTL)
+	return id, nil
+}
@@ -1,44 +1,102 @@
 package resolver
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"time"
 
+	"github.com/data-preservation-programs/RetrievalBot/pkg/env"
 	"github.com/filecoin-project/go-state-types/abi"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/jellydator/ttlcache/v3"
 	"github.com/pkg/errors"
-	"github.com/ybbus/jsonrpc/v3"
 )
 
 type ProviderResolver struct {
-	cache       *ttlcache.Cache[string, MinerInfo]
-	lotusClient jsonrpc.RPCClient
+	cache           *ttlcache.Cache[string, MinerInfo]
+	persistentCache *PersistentCache[MinerInfo]
+	lotusClient     *LotusClient
+	crossCheck      bool
+	history         *ProviderHistory
 }
 
 type MinerInfo struct {
 	//nolint:stylecheck
-	PeerId string
+	PeerId string `bson:"peer_id"`
 	//nolint:tagliatelle
-	MultiaddrsBase64Encoded []string `json:"Multiaddrs"`
-	Multiaddrs              []abi.Multiaddrs
+	MultiaddrsBase64Encoded []string         `json:"Multiaddrs" bson:"multiaddrs_base64"`
+	Multiaddrs              []abi.Multiaddrs `bson:"multiaddrs"`
+	// SnapshotID is the provider_history snapshot in force at resolution time, if history is enabled
+	SnapshotID string `json:"-" bson:"-"`
 }
 
-func NewProviderResolver(url string, token string, ttl time.Duration) (*ProviderResolver, error) {
+// SameEndpoint returns true if both miner infos advertise the same peer ID and multiaddrs.
+func SameEndpoint(a, b MinerInfo) bool {
+	if a.PeerId != b.PeerId || len(a.Multiaddrs) != len(b.Multiaddrs) {
+		return false
+	}
+
+	for i := range a.Multiaddrs {
+		if !bytes.Equal(a.Multiaddrs[i], b.Multiaddrs[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func sameEncodedEndpoint(a, b MinerInfo) bool {
+	if a.PeerId != b.PeerId || len(a.MultiaddrsBase64Encoded) != len(b.MultiaddrsBase64Encoded) {
+		return false
+	}
+
+	for i := range a.MultiaddrsBase64Encoded {
+		if a.MultiaddrsBase64Encoded[i] != b.MultiaddrsBase64Encoded[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// crossCheckEndpoints is the number of endpoints queried by a cross-checked lookup, so that a majority can tell
+// which one diverges.
+const crossCheckEndpoints = 3
+
+// majorityMinerInfo returns the miner info that more than half of the answers agree on, and the URLs of the
+// endpoints whose answer differs from it. Without a majority, all the endpoints are returned as divergent.
+func majorityMinerInfo(answers []LotusAnswer) (*MinerInfo, []string) {
+	for _, candidate := range answers {
+		//nolint:forcetypeassert
+		info := candidate.Out.(*MinerInfo)
+		var divergent []string
+		for _, answer := range answers {
+			//nolint:forcetypeassert
+			if !sameEncodedEndpoint(*info, *answer.Out.(*MinerInfo)) {
+				divergent = append(divergent, answer.URL)
+			}
+		}
+		if 2*(len(answers)-len(divergent)) > len(answers) {
+			return info, divergent
+		}
+	}
+
+	urls := make([]string, len(answers))
+	for i, answer := range answers {
+		urls[i] = answer.URL
+	}
+	return nil, urls
+}
+
+func NewProviderResolver(endpoints []LotusEndpoint, ttl time.Duration) (*ProviderResolver, error) {
 	cache := ttlcache.New[string, MinerInfo](
 		//nolint:gomnd
 		ttlcache.WithTTL[string, MinerInfo](ttl),
 		ttlcache.WithDisableTouchOnHit[string, MinerInfo]())
-	var lotusClient jsonrpc.RPCClient
-	if token == "" {
-		lotusClient = jsonrpc.NewClient(url)
-	} else {
-		lotusClient = jsonrpc.NewClientWithOpts(url, &jsonrpc.RPCClientOpts{
-			CustomHeaders: map[string]string{
-				"Authorization": "Bearer " + token,
-			},
-		})
+	lotusClient, err := NewLotusClient(endpoints, env.GetDuration(env.LotusAPITimeout, 30*time.Second))
+	if err != nil {
+		return nil, err
 	}
 	return &ProviderResolver{
 		cache:       cache,
@@ -46,17 +104,138 @@ func NewProviderResolver(url string, token string, ttl time.Duration) (*Provider
 	}, nil
 }
 
+// NewProviderResolverFromEnv creates a provider resolver with the Lotus endpoints, cache TTL
+// and cross-check setting from the environment.
+func NewProviderResolverFromEnv() (*ProviderResolver, error) {
+	providerResolver, err := NewProviderResolver(
+		LotusEndpointsFromEnv(),
+		env.GetDuration(env.ProviderCacheTTL, 24*time.Hour))
+	if err != nil {
+		return nil, err
+	}
+
+	providerResolver.SetCrossCheck(env.GetBool(env.LotusAPICrossCheck, false))
+	return providerResolver, nil
+}
+
+// SetCrossCheck makes the resolver query up to three Lotus endpoints for each provider and use the answer of the
+// majority. The lookup fails if there is none, e.g. when only two endpoints answered and they disagree on the peer ID
+// or multiaddrs.
+func (p *ProviderResolver) SetCrossCheck(crossCheck bool) {
+	p.crossCheck = crossCheck
+}
+
+// SetHistory makes the resolver attach the provider_history snapshot in force to every resolved MinerInfo.
+func (p *ProviderResolver) SetHistory(history *ProviderHistory) {
+	p.history = history
+}
+
+// EnableProviderHistoryFromEnv attaches the provider history if the result database is configured.
+func EnableProviderHistoryFromEnv(ctx context.Context, providerResolver *ProviderResolver) error {
+	history, err := OpenProviderHistoryFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+
+	if history != nil {
+		providerResolver.SetHistory(history)
+	}
+	return nil
+}
+
+// LotusClient returns the underlying client so that other Lotus calls share the same failover and stats.
+func (p *ProviderResolver) LotusClient() *LotusClient {
+	return p.lotusClient
+}
+
+// SetPersistentCache makes the resolver consult and populate the given cache behind the in-memory one.
+func (p *ProviderResolver) SetPersistentCache(cache *PersistentCache[MinerInfo]) {
+	p.persistentCache = cache
+}
+
 func (p *ProviderResolver) ResolveProvider(ctx context.Context, provider string) (MinerInfo, error) {
+	minerInfo, err := p.resolveProvider(ctx, provider)
+	if err != nil || p.history == nil {
+		return minerInfo, err
+	}
+
+	minerInfo.SnapshotID, err = p.history.InForce(ctx, provider)
+	if err != nil {
+		logging.Logger("location_resolver").With("provider", provider, "err", err).
+			Warn("failed to get provider snapshot")
+	}
+
+	return minerInfo, nil
+}
+
+func (p *ProviderResolver) resolveProvider(ctx context.Context, provider string) (MinerInfo, error) {
 	logger := logging.Logger("location_resolver")
 	if minerInfo := p.cache.Get(provider); minerInfo != nil && !minerInfo.IsExpired() {
 		return minerInfo.Value(), nil
 	}
 
+	if p.persistentCache != nil {
+		entry, err := p.persistentCache.Get(ctx, provider)
+		if err != nil {
+			logger.With("provider", provider, "err", err).Warn("failed to read persistent cache")
+		} else if entry != nil {
+			if entry.Error != nil {
+				return MinerInfo{}, errors.Wrap(entry.Error.Err(), "failed to get miner info (cached)")
+			}
+			p.cache.Set(provider, *entry.Value, time.Until(entry.ExpiresAt))
+			return *entry.Value, nil
+		}
+	}
+
+	minerInfo, err := p.FetchMinerInfo(ctx, provider)
+	if err != nil {
+		if p.persistentCache != nil && ctx.Err() == nil {
+			if cacheErr := p.persistentCache.PutError(ctx, provider, err); cacheErr != nil {
+				logger.With("provider", provider, "err", cacheErr).Warn("failed to write persistent cache")
+			}
+		}
+		return MinerInfo{}, err
+	}
+
+	p.cache.Set(provider, minerInfo, ttlcache.DefaultTTL)
+	if p.persistentCache != nil {
+		changed, err := p.persistentCache.Put(ctx, provider, minerInfo)
+		if err != nil {
+			logger.With("provider", provider, "err", err).Warn("failed to write persistent cache")
+		}
+		if changed {
+			logger.With("provider", provider, "peerID", minerInfo.PeerId).
+				Info("provider peer ID or multiaddrs changed since last lookup")
+		}
+	}
+
+	return minerInfo, nil
+}
+
+// FetchMinerInfo gets the current miner info from Lotus, bypassing all caches.
+func (p *ProviderResolver) FetchMinerInfo(ctx context.Context, provider string) (MinerInfo, error) {
+	logger := logging.Logger("location_resolver")
 	logger.With("provider", provider).Debug("Getting miner info")
 	minerInfo := new(MinerInfo)
-	err := p.lotusClient.CallFor(ctx, minerInfo, "Filecoin.StateMinerInfo", provider, nil)
-	if err != nil {
-		return MinerInfo{}, errors.Wrap(err, "failed to get miner info")
+	if p.crossCheck {
+		answers, err := p.lotusClient.CallForEach(ctx, crossCheckEndpoints,
+			func() interface{} { return new(MinerInfo) }, "Filecoin.StateMinerInfo", provider, nil)
+		if err != nil {
+			return MinerInfo{}, errors.Wrap(err, "failed to get miner info")
+		}
+		agreed, divergent := majorityMinerInfo(answers)
+		for _, url := range divergent {
+			p.lotusClient.RecordMismatch(url)
+		}
+		if agreed == nil {
+			return MinerInfo{}, errors.Errorf("lotus endpoints disagree on miner info for %s", provider)
+		}
+		minerInfo = agreed
+	} else {
+		err := p.lotusClient.CallFor(ctx, minerInfo, "Filecoin.StateMinerInfo", provider, nil)
+		if err != nil {
+			return MinerInfo{}, errors.Wrap(err, "failed to get miner info")
+		}
 	}
 
 	logger.With("provider", provider, "minerinfo", minerInfo).Debug("Got miner info")
@@ -68,7 +247,6 @@ func (p *ProviderResolver) ResolveProvider(ctx context.Context, provider string)
 		}
 		minerInfo.Multiaddrs[i] = decoded
 	}
-	p.cache.Set(provider, *minerInfo, ttlcache.DefaultTTL)
 
 	return *minerInfo, nil
 }
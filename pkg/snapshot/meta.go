@@ -0,0 +1,53 @@
+package snapshot
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Meta records the version of the last snapshot ingested from a source.
+type Meta struct {
+	Source    string    `bson:"_id"`
+	Version   string    `bson:"version"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+type MetaStore struct {
+	collection *mongo.Collection
+}
+
+func NewMetaStore(collection *mongo.Collection) MetaStore {
+	return MetaStore{collection: collection}
+}
+
+// Version returns the version of the last snapshot ingested from the source, or "" if there is none.
+func (m MetaStore) Version(ctx context.Context, source string) (string, error) {
+	var meta Meta
+	err := m.collection.FindOne(ctx, bson.M{"_id": source}).Decode(&meta)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get snapshot meta")
+	}
+
+	return meta.Version, nil
+}
+
+// SetVersion records the version of the snapshot that has been ingested from the source.
+func (m MetaStore) SetVersion(ctx context.Context, source string, version string) error {
+	_, err := m.collection.ReplaceOne(ctx,
+		bson.M{"_id": source},
+		Meta{Source: source, Version: version, UpdatedAt: time.Now()},
+		options.Replace().SetUpsert(true))
+	if err != nil {
+		return errors.Wrap(err, "failed to set snapshot meta")
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+var logger = logging.Logger("snapshot")
+
+// Stdin is the source that reads the snapshot from the standard input.
+const Stdin = "-"
+
+var ErrUnchanged = errors.New("snapshot has not changed")
+
+var (
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	gzipMagic = []byte{0x1f, 0x8b}
+)
+
+// Snapshot is the decompressed content of a source. Version identifies the content of the source,
+// i.e. the ETag or Last-Modified header of a URL or the checksum of a file, and is empty for stdin.
+type Snapshot struct {
+	io.Reader
+	Version string
+	closers []io.Closer
+}
+
+func (s *Snapshot) Close() error {
+	var err error
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		if cerr := s.closers[i].Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Open opens a source, which is either a http(s) URL, a local path or "-" for stdin, and decompresses it.
+// It returns ErrUnchanged if the version of the source is the same as previousVersion.
+func Open(ctx context.Context, source string, previousVersion string) (*Snapshot, error) {
+	var (
+		reader  io.ReadCloser
+		version string
+		err     error
+	)
+	switch {
+	case source == Stdin:
+		reader = io.NopCloser(os.Stdin)
+	case strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://"):
+		reader, version, err = openURL(ctx, source, previousVersion)
+	default:
+		reader, version, err = openFile(source)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if version != "" && version == previousVersion {
+		reader.Close()
+		return nil, ErrUnchanged
+	}
+
+	decompressed, err := Decompress(reader)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+
+	logger.With("source", source, "version", version).Info("opened snapshot")
+	return &Snapshot{
+		Reader:  decompressed,
+		Version: version,
+		closers: []io.Closer{reader, decompressed},
+	}, nil
+}
+
+func openURL(ctx context.Context, url string, previousVersion string) (io.ReadCloser, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to create request")
+	}
+
+	switch {
+	case strings.HasPrefix(previousVersion, "etag:"):
+		req.Header.Set("If-None-Match", strings.TrimPrefix(previousVersion, "etag:"))
+	case strings.HasPrefix(previousVersion, "last-modified:"):
+		req.Header.Set("If-Modified-Since", strings.TrimPrefix(previousVersion, "last-modified:"))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to make request")
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		return nil, "", ErrUnchanged
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, "", errors.Errorf("failed to get snapshot: %s", resp.Status)
+	}
+
+	version := ""
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		version = "etag:" + etag
+	} else if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
+		version = "last-modified:" + lastModified
+	}
+
+	return resp.Body, version, nil
+}
+
+func openFile(path string) (io.ReadCloser, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to open snapshot file")
+	}
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		file.Close()
+		return nil, "", errors.Wrap(err, "failed to compute checksum")
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		file.Close()
+		return nil, "", errors.Wrap(err, "failed to rewind snapshot file")
+	}
+
+	return file, "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Decompress detects zstd or gzip compression from the magic bytes of r and decompresses it.
+// Anything else is returned as is.
+func Decompress(r io.Reader) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(r)
+	magic, err := buffered.Peek(len(zstdMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, errors.Wrap(err, "failed to read snapshot header")
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, zstdMagic):
+		decoder, err := zstd.NewReader(buffered)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create zstd decompressor")
+		}
+		return decoder.IOReadCloser(), nil
+	case bytes.HasPrefix(magic, gzipMagic):
+		decoder, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create gzip decompressor")
+		}
+		return decoder, nil
+	default:
+		return io.NopCloser(buffered), nil
+	}
+}
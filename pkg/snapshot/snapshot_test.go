@@ -0,0 +1,90 @@
+package snapshot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+const content = `{"1":{"Proposal":{},"State":{}}}`
+
+func compressed(t *testing.T) map[string][]byte {
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	_, err := gw.Write([]byte(content))
+	assert.NoError(t, err)
+	assert.NoError(t, gw.Close())
+
+	encoder, err := zstd.NewWriter(nil)
+	assert.NoError(t, err)
+	zst := encoder.EncodeAll([]byte(content), nil)
+
+	return map[string][]byte{
+		"plain": []byte(content),
+		"gzip":  gz.Bytes(),
+		"zstd":  zst,
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	for name, data := range compressed(t) {
+		t.Run(name, func(t *testing.T) {
+			reader, err := Decompress(bytes.NewReader(data))
+			assert.NoError(t, err)
+			defer reader.Close()
+			decoded, err := io.ReadAll(reader)
+			assert.NoError(t, err)
+			assert.Equal(t, content, string(decoded))
+		})
+	}
+}
+
+func TestOpenFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "StateMarketDeals.json.zst")
+	assert.NoError(t, os.WriteFile(path, compressed(t)["zstd"], 0600))
+
+	s, err := Open(ctx, path, "")
+	assert.NoError(t, err)
+	decoded, err := io.ReadAll(s)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Close())
+	assert.Equal(t, content, string(decoded))
+	assert.Contains(t, s.Version, "sha256:")
+
+	_, err = Open(ctx, path, s.Version)
+	assert.ErrorIs(t, err, ErrUnchanged)
+}
+
+func TestOpenURL(t *testing.T) {
+	ctx := context.Background()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write(compressed(t)["gzip"])
+	}))
+	defer server.Close()
+
+	s, err := Open(ctx, server.URL, "")
+	assert.NoError(t, err)
+	decoded, err := io.ReadAll(s)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Close())
+	assert.Equal(t, content, string(decoded))
+	assert.Equal(t, `etag:"v1"`, s.Version)
+
+	_, err = Open(ctx, server.URL, s.Version)
+	assert.ErrorIs(t, err, ErrUnchanged)
+}
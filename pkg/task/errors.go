@@ -82,3 +82,17 @@ func resolveErrorResult(err error) *RetrievalResult {
 
 	return NewErrorRetrievalResult(code, err)
 }
+
+// ResolveWorkResult returns what a worker process records for the outcome of DoWork: the result, or an error
+// result if the error is classified. Other errors are returned as is.
+func ResolveWorkResult(result *RetrievalResult, err error) (*RetrievalResult, error) {
+	if err == nil {
+		return result, nil
+	}
+
+	errResult := resolveErrorResult(err)
+	if errResult == nil {
+		return nil, err
+	}
+	return errResult, nil
+}
@@ -16,6 +16,20 @@ type Provider struct {
 	Region     string   `bson:"region,omitempty"`
 	Country    string   `bson:"country,omitempty"`
 	Continent  string   `bson:"continent,omitempty"`
+	// ID of the provider_history snapshot in force when the task was created
+	SnapshotID string `bson:"snapshot_id,omitempty"`
+	// Location of every IP of the provider. City, Region, Country and Continent above hold the primary one,
+	// which is used to route tasks to workers.
+	Locations []Location `bson:"locations,omitempty"`
+}
+
+type Location struct {
+	IP        string `bson:"ip"`
+	City      string `bson:"city,omitempty"`
+	Region    string `bson:"region,omitempty"`
+	Country   string `bson:"country,omitempty"`
+	Continent string `bson:"continent,omitempty"`
+	ASN       string `bson:"asn,omitempty"`
 }
 
 func (p Provider) GetPeerAddr() (peer.AddrInfo, error) {
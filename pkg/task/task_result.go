@@ -63,6 +63,8 @@ type RetrievalResult struct {
 	Speed        float64       `bson:"speed,omitempty"`
 	Duration     time.Duration `bson:"duration,omitempty"`
 	Downloaded   int64         `bson:"downloaded,omitempty"`
+	// Roots of the CAR header found at the beginning of a retrieved piece
+	CARRoots []string `bson:"car_roots,omitempty"`
 }
 
 type Result struct {
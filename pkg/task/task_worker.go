@@ -28,6 +28,31 @@ type WorkerProcess struct {
 	pollInterval       time.Duration
 	retrieverInfo      Retriever
 	timeoutBuffer      time.Duration
+	observer           func(PollStats)
+}
+
+// WorkerProcessConfig configures a worker process created with NewWorkerProcess.
+type WorkerProcessConfig struct {
+	TaskCollection     *mongo.Collection
+	ResultCollection   *mongo.Collection
+	Retriever          Retriever
+	AcceptedContinents string
+	AcceptedCountries  string
+	PollInterval       time.Duration
+	TimeoutBuffer      time.Duration
+	// Observer is called with the stats of each poll that inserted a result, if set
+	Observer func(PollStats)
+}
+
+// PollStats are the timings of a poll.
+type PollStats struct {
+	// Polls that found no task before the task was claimed
+	EmptyPolls int
+	// Duration of the FindOneAndDelete that claimed the task
+	Claim time.Duration
+	Work  time.Duration
+	// Duration of the InsertOne of the result
+	Insert time.Duration
 }
 
 func (t WorkerProcess) Close() {
@@ -67,25 +92,38 @@ func NewTaskWorkerProcess(
 		Longitude: env.GetRequiredFloat32(env.Longitude),
 	}
 
-	id := uuid.New()
+	return NewWorkerProcess(module, worker, WorkerProcessConfig{
+		TaskCollection:     taskCollection,
+		ResultCollection:   resultCollection,
+		Retriever:          retrieverInfo,
+		AcceptedContinents: env.GetString(env.AcceptedContinents, ""),
+		AcceptedCountries:  env.GetString(env.AcceptedCountries, ""),
+		PollInterval:       env.GetDuration(env.TaskWorkerPollInterval, 10*time.Second),
+		TimeoutBuffer:      env.GetDuration(env.TaskWorkerTimeoutBuffer, 10*time.Second),
+	}), nil
+}
 
+// NewWorkerProcess creates a worker process on existing collections, which Close disconnects.
+func NewWorkerProcess(module ModuleName, worker Worker, config WorkerProcessConfig) *WorkerProcess {
 	return &WorkerProcess{
-		id,
-		taskCollection,
-		resultCollection,
-		worker,
-		module,
-		env.GetString(env.AcceptedContinents, ""),
-		env.GetString(env.AcceptedCountries, ""),
-		env.GetDuration(env.TaskWorkerPollInterval, 10*time.Second),
-		retrieverInfo,
-		env.GetDuration(env.TaskWorkerTimeoutBuffer, 10*time.Second),
-	}, nil
+		id:                 uuid.New(),
+		taskCollection:     config.TaskCollection,
+		resultCollection:   config.ResultCollection,
+		worker:             worker,
+		module:             module,
+		acceptedContinents: config.AcceptedContinents,
+		acceptedCountries:  config.AcceptedCountries,
+		pollInterval:       config.PollInterval,
+		retrieverInfo:      config.Retriever,
+		timeoutBuffer:      config.TimeoutBuffer,
+		observer:           config.Observer,
+	}
 }
 
 func (t WorkerProcess) Poll(ctx context.Context) error {
 	logger := logging.Logger("task-worker").With("protocol", t.module, "workerId", t.id)
 	var singleResult *mongo.SingleResult
+	var stats PollStats
 	for {
 		logger.Debug("polling for task")
 
@@ -115,10 +153,13 @@ func (t WorkerProcess) Poll(ctx context.Context) error {
 		}
 
 		logger.With("filter", match).Debug("FindOneAndDelete")
+		claimStart := time.Now()
 		singleResult = t.taskCollection.FindOneAndDelete(ctx, match,
 			options.FindOneAndDelete().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+		stats.Claim = time.Since(claimStart)
 		if errors.Is(singleResult.Err(), mongo.ErrNoDocuments) {
 			logger.Debug("no task singleResult")
+			stats.EmptyPolls++
 			time.Sleep(t.pollInterval)
 			continue
 		}
@@ -139,16 +180,12 @@ func (t WorkerProcess) Poll(ctx context.Context) error {
 	logger.With("task", found).Info("found new task")
 	resultChan := make(chan RetrievalResult)
 	errChan := make(chan error)
+	workStart := time.Now()
 	go func() {
-		result, err := t.worker.DoWork(*found)
+		result, err := ResolveWorkResult(t.worker.DoWork(*found))
 		if err != nil {
-			errResult := resolveErrorResult(err)
-			if errResult != nil {
-				resultChan <- *errResult
-			} else {
-				logger.With("error", err).Error("failed to do work")
-				errChan <- err
-			}
+			logger.With("error", err).Error("failed to do work")
+			errChan <- err
 		} else {
 			resultChan <- *result
 		}
@@ -167,6 +204,7 @@ func (t WorkerProcess) Poll(ctx context.Context) error {
 		return err
 	}
 
+	stats.Work = time.Since(workStart)
 	taskResult := Result{
 		Task:      *found,
 		Result:    retrievalResult,
@@ -174,11 +212,17 @@ func (t WorkerProcess) Poll(ctx context.Context) error {
 		CreatedAt: time.Now().UTC(),
 	}
 
+	insertStart := time.Now()
 	insertResult, err := t.resultCollection.InsertOne(ctx, taskResult)
 	if err != nil {
 		return errors.Wrap(err, "failed to insert result")
 	}
 
+	stats.Insert = time.Since(insertStart)
+	if t.observer != nil {
+		t.observer(stats)
+	}
+
 	logger.With("result", retrievalResult, "InsertedID", insertResult.InsertedID).Info("inserted result")
 	return nil
 }
@@ -0,0 +1,170 @@
+// Package bsonmatch evaluates the Mongo filters used by the integrations against marshalled documents, so that
+// the field paths of a query can be tested without a database.
+package bsonmatch
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// Lookup returns the value at the dotted path of the document, e.g. a task_result field or a $group expression
+// without its leading $, and whether it exists.
+func Lookup(document interface{}, path string) (bson.RawValue, bool, error) {
+	raw, err := bson.Marshal(document)
+	if err != nil {
+		return bson.RawValue{}, false, errors.Wrap(err, "failed to marshal document")
+	}
+
+	value, err := bson.Raw(raw).LookupErr(strings.Split(strings.TrimPrefix(path, "$"), ".")...)
+	if err != nil {
+		return bson.RawValue{}, false, nil
+	}
+	return value, true, nil
+}
+
+// Match returns whether the document matches the filter. Fields are compared for equality or with the $in, $nin,
+// $exists, $ne, $gt, $gte, $lt and $lte operators.
+func Match(document interface{}, filter bson.M) (bool, error) {
+	for path, condition := range filter {
+		value, exists, err := Lookup(document, path)
+		if err != nil {
+			return false, err
+		}
+
+		operators, ok := condition.(bson.M)
+		if !ok {
+			operators = bson.M{"$eq": condition}
+		}
+		for operator, operand := range operators {
+			matched, err := apply(operator, value, exists, operand)
+			if err != nil {
+				return false, errors.Wrap(err, path)
+			}
+			if !matched {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+func apply(operator string, value bson.RawValue, exists bool, operand interface{}) (bool, error) {
+	switch operator {
+	case "$exists":
+		expected, ok := operand.(bool)
+		if !ok {
+			return false, errors.New("$exists expects a bool")
+		}
+		return exists == expected, nil
+	case "$eq":
+		return exists && compare(value, operand) == 0, nil
+	case "$ne":
+		return !exists || compare(value, operand) != 0, nil
+	case "$in", "$nin":
+		values, err := toSlice(operand)
+		if err != nil {
+			return false, err
+		}
+		found := false
+		for _, v := range values {
+			found = found || (exists && compare(value, v) == 0)
+		}
+		return found == (operator == "$in"), nil
+	case "$gt", "$gte", "$lt", "$lte":
+		if !exists {
+			return false, nil
+		}
+		c := compare(value, operand)
+		if c == incomparable {
+			return false, nil
+		}
+		switch operator {
+		case "$gt":
+			return c > 0, nil
+		case "$gte":
+			return c >= 0, nil
+		case "$lt":
+			return c < 0, nil
+		default:
+			return c <= 0, nil
+		}
+	default:
+		return false, errors.Errorf("unsupported operator %s", operator)
+	}
+}
+
+const incomparable = 2
+
+// compare compares a document value with a Go value: numbers by value, dates by time and the others by their
+// bson encoding, which only tells whether they are equal.
+func compare(value bson.RawValue, operand interface{}) int {
+	t, data, err := bson.MarshalValue(operand)
+	if err != nil {
+		return incomparable
+	}
+	other := bson.RawValue{Type: t, Value: data}
+
+	if number, ok := asFloat64(value); ok {
+		if otherNumber, ok := asFloat64(other); ok {
+			return sign(number - otherNumber)
+		}
+		return incomparable
+	}
+	if value.Type == bsontype.DateTime && other.Type == bsontype.DateTime {
+		a, b := value.Time(), other.Time()
+		switch {
+		case a.Before(b):
+			return -1
+		case a.After(b):
+			return 1
+		}
+		return 0
+	}
+	if value.Type == other.Type && bytes.Equal(value.Value, data) {
+		return 0
+	}
+	return incomparable
+}
+
+func asFloat64(value bson.RawValue) (float64, bool) {
+	switch value.Type {
+	case bsontype.Int32:
+		return float64(value.Int32()), true
+	case bsontype.Int64:
+		return float64(value.Int64()), true
+	case bsontype.Double:
+		return value.Double(), true
+	}
+	return 0, false
+}
+
+func sign(f float64) int {
+	switch {
+	case f < 0:
+		return -1
+	case f > 0:
+		return 1
+	}
+	return 0
+}
+
+func toSlice(operand interface{}) ([]interface{}, error) {
+	switch values := operand.(type) {
+	case bson.A:
+		return values, nil
+	case []interface{}:
+		return values, nil
+	case []string:
+		result := make([]interface{}, len(values))
+		for i, v := range values {
+			result[i] = v
+		}
+		return result, nil
+	default:
+		return nil, errors.Errorf("unsupported list %T", operand)
+	}
+}
@@ -0,0 +1,56 @@
+package bsonmatch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type document struct {
+	Name      string            `bson:"name"`
+	Size      int64             `bson:"size"`
+	Metadata  map[string]string `bson:"metadata"`
+	CreatedAt time.Time         `bson:"created_at"`
+}
+
+func TestMatch(t *testing.T) {
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	doc := document{Name: "a", Size: 10, Metadata: map[string]string{"deal_id": "7"}, CreatedAt: now}
+
+	for _, filter := range []bson.M{
+		{"name": "a"},
+		{"name": bson.M{"$in": []string{"b", "a"}}},
+		{"name": bson.M{"$nin": bson.A{"b"}}},
+		{"name": bson.M{"$ne": "b"}},
+		{"size": bson.M{"$gte": 10, "$lt": 11.5}},
+		{"metadata.deal_id": bson.M{"$exists": true}},
+		{"metadata.claim_id": bson.M{"$exists": false}},
+		{"created_at": bson.M{"$gte": now, "$lt": now.Add(time.Second)}},
+	} {
+		matched, err := Match(doc, filter)
+		assert.NoError(t, err)
+		assert.True(t, matched, filter)
+	}
+
+	for _, filter := range []bson.M{
+		{"name": "b"},
+		{"size": "10"},
+		{"size": bson.M{"$gt": 10}},
+		{"deal_id": bson.M{"$exists": true}},
+		{"created_at": bson.M{"$lt": now}},
+	} {
+		matched, err := Match(doc, filter)
+		assert.NoError(t, err)
+		assert.False(t, matched, filter)
+	}
+
+	_, err := Match(doc, bson.M{"name": bson.M{"$regex": "a"}})
+	assert.Error(t, err)
+
+	value, exists, err := Lookup(doc, "$metadata.deal_id")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, "7", value.StringValue())
+}
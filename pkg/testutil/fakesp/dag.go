@@ -0,0 +1,167 @@
+package fakesp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/rand"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-libipfs/blocks"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/multiformats/go-multihash"
+	"github.com/pkg/errors"
+)
+
+// DAG is a generated tree of dag-cbor nodes whose leaves are raw blocks, in depth-first order from the root.
+type DAG struct {
+	Root   cid.Cid
+	Blocks []blocks.Block
+	links  map[cid.Cid][]cid.Cid
+	blocks map[cid.Cid]blocks.Block
+}
+
+// GenerateDAG builds a DAG of the given number of random leaves, linked fanout at a time by intermediate nodes
+// up to a single root.
+func GenerateDAG(rng *rand.Rand, leaves int, leafSize int, fanout int) (DAG, error) {
+	if leaves < 1 || fanout < 2 {
+		return DAG{}, errors.New("a DAG needs at least one leaf and a fanout of at least 2")
+	}
+
+	children := make(map[cid.Cid][]cid.Cid)
+	all := make(map[cid.Cid]blocks.Block)
+	layer := make([]cid.Cid, 0, leaves)
+	for i := 0; i < leaves; i++ {
+		data := make([]byte, leafSize)
+		rng.Read(data)
+		blk, err := newBlock(cid.Raw, data)
+		if err != nil {
+			return DAG{}, err
+		}
+		all[blk.Cid()] = blk
+		layer = append(layer, blk.Cid())
+	}
+
+	depth := 0
+	for len(layer) > 1 || depth == 0 {
+		var next []cid.Cid
+		for start := 0; start < len(layer); start += fanout {
+			end := start + fanout
+			if end > len(layer) {
+				end = len(layer)
+			}
+			blk, err := linkNode(depth, layer[start:end])
+			if err != nil {
+				return DAG{}, err
+			}
+			all[blk.Cid()] = blk
+			children[blk.Cid()] = layer[start:end]
+			next = append(next, blk.Cid())
+		}
+		layer = next
+		depth++
+	}
+
+	dag := DAG{Root: layer[0], links: children, blocks: all}
+	dag.Blocks = dag.walk(dag.Root)
+	return dag, nil
+}
+
+// walk returns the blocks of the DAG below c, c included, in depth-first order.
+func (d DAG) walk(c cid.Cid) []blocks.Block {
+	walked := []blocks.Block{d.blocks[c]}
+	for _, child := range d.links[c] {
+		walked = append(walked, d.walk(child)...)
+	}
+	return walked
+}
+
+// Block returns the block of the DAG with the given CID.
+func (d DAG) Block(c cid.Cid) (blocks.Block, bool) {
+	blk, ok := d.blocks[c]
+	return blk, ok
+}
+
+func linkNode(depth int, links []cid.Cid) (blocks.Block, error) {
+	node, err := qp.BuildMap(basicnode.Prototype.Any, 2, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "depth", qp.Int(int64(depth)))
+		qp.MapEntry(ma, "links", qp.List(int64(len(links)), func(la datamodel.ListAssembler) {
+			for _, link := range links {
+				qp.ListEntry(la, qp.Link(cidlink.Link{Cid: link}))
+			}
+		}))
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build node")
+	}
+
+	var buf bytes.Buffer
+	err = dagcbor.Encode(node, &buf)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode node")
+	}
+	return newBlock(cid.DagCBOR, buf.Bytes())
+}
+
+func newBlock(codec uint64, data []byte) (blocks.Block, error) {
+	hash, err := multihash.Sum(data, multihash.SHA2_256, -1)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to hash block")
+	}
+	//nolint:wrapcheck
+	return blocks.NewBlockWithCid(data, cid.NewCidV1(codec, hash))
+}
+
+// CAR encodes the DAG as a CARv1 with the DAG root as its only root.
+func (d DAG) CAR() ([]byte, error) {
+	return d.SubCAR(d.Root)
+}
+
+// SubCAR encodes the part of the DAG below root as a CARv1.
+func (d DAG) SubCAR(root cid.Cid) ([]byte, error) {
+	if _, ok := d.blocks[root]; !ok {
+		return nil, errors.Errorf("%s is not in the DAG", root)
+	}
+
+	header, err := qp.BuildMap(basicnode.Prototype.Any, 2, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "roots", qp.List(1, func(la datamodel.ListAssembler) {
+			qp.ListEntry(la, qp.Link(cidlink.Link{Cid: root}))
+		}))
+		qp.MapEntry(ma, "version", qp.Int(1))
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build CAR header")
+	}
+
+	var encoded bytes.Buffer
+	err = dagcbor.Encode(header, &encoded)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode CAR header")
+	}
+
+	car := binary.AppendUvarint(nil, uint64(encoded.Len()))
+	car = append(car, encoded.Bytes()...)
+	for _, blk := range d.walk(root) {
+		car = binary.AppendUvarint(car, uint64(blk.Cid().ByteLen()+len(blk.RawData())))
+		car = append(car, blk.Cid().Bytes()...)
+		car = append(car, blk.RawData()...)
+	}
+	return car, nil
+}
+
+// PieceCID returns a piece CID derived from the hash of the CAR. It has the codec and multihash of a real
+// piece CID but is not a commP.
+func PieceCID(car []byte) (cid.Cid, error) {
+	digest := sha256.Sum256(car)
+	// Fr32 padding leaves the top two bits of the last byte unset
+	digest[len(digest)-1] &= 0x3f
+	hash, err := multihash.Encode(digest[:], multihash.SHA2_256_TRUNC254_PADDED)
+	if err != nil {
+		return cid.Undef, errors.Wrap(err, "failed to encode piece multihash")
+	}
+	return cid.NewCidV1(cid.FilCommitmentUnsealed, hash), nil
+}
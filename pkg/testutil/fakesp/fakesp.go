@@ -0,0 +1,415 @@
+// Package fakesp runs a storage provider in process, serving a generated DAG over Bitswap, GraphSync and HTTP,
+// so that the retrieval workers can be tested end to end without the network.
+package fakesp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/model"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/net"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	cborutil "github.com/filecoin-project/go-cbor-util"
+	datatransfer "github.com/filecoin-project/go-data-transfer/v2"
+	dtimpl "github.com/filecoin-project/go-data-transfer/v2/impl"
+	dtnet "github.com/filecoin-project/go-data-transfer/v2/network"
+	gstransport "github.com/filecoin-project/go-data-transfer/v2/transport/graphsync"
+	retrievaltypes "github.com/filecoin-project/go-retrieval-types"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	gsimpl "github.com/ipfs/go-graphsync/impl"
+	gsnet "github.com/ipfs/go-graphsync/network"
+	"github.com/ipfs/go-graphsync/storeutil"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	bsnet "github.com/ipfs/go-libipfs/bitswap/network"
+	bsserver "github.com/ipfs/go-libipfs/bitswap/server"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	routinghelpers "github.com/libp2p/go-libp2p-routing-helpers"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/pkg/errors"
+)
+
+// RetrievalProtocolName is the libp2p protocol that boost providers answer with their retrieval transports.
+const RetrievalProtocolName = "/fil/retrieval/transports/1.0.0"
+
+// Config of a fake storage provider. The zero value serves a DAG of 16 leaves of 1KiB over every protocol.
+type Config struct {
+	// Seed of the generated DAG
+	Seed     int64
+	Leaves   int
+	LeafSize int
+	Fanout   int
+	// ProviderID is the miner ID of the provider in its tasks, f01000 by default
+	ProviderID string
+	// The disabled servers are not advertised either
+	DisableBitswap   bool
+	DisableGraphSync bool
+	DisableHTTP      bool
+	// DisableTransports does not serve the retrieval transports protocol, as a provider not running boost
+	DisableTransports bool
+	// QueryResponse replaces the transports advertised for the enabled servers
+	QueryResponse *model.QueryResponse
+	Faults        Faults
+}
+
+// SP is a running fake storage provider.
+type SP struct {
+	Host       host.Host
+	ProviderID string
+	DAG        DAG
+	CAR        []byte
+	PieceCID   cid.Cid
+	// URL of the HTTP server, empty if it is disabled
+	HTTPURL       string
+	QueryResponse model.QueryResponse
+	Faults        Faults
+
+	// Addresses of the provider, that may differ from the ones of the host
+	addrs   []multiaddr.Multiaddr
+	cancel  context.CancelFunc
+	closers []func() error
+}
+
+// New starts a fake storage provider listening on the loopback interface. It must be closed.
+func New(ctx context.Context, config Config) (*SP, error) {
+	if config.Leaves == 0 {
+		config.Leaves = 16
+	}
+	if config.LeafSize == 0 {
+		config.LeafSize = 1024
+	}
+	if config.Fanout == 0 {
+		config.Fanout = 4
+	}
+	if config.ProviderID == "" {
+		config.ProviderID = "f01000"
+	}
+
+	//nolint:gosec
+	dag, err := GenerateDAG(rand.New(rand.NewSource(config.Seed)), config.Leaves, config.LeafSize, config.Fanout)
+	if err != nil {
+		return nil, err
+	}
+	car, err := dag.CAR()
+	if err != nil {
+		return nil, err
+	}
+	pieceCID, err := PieceCID(car)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := net.InitHost(ctx, nil, multiaddr.StringCast("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to init host")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	sp := &SP{
+		Host:       h,
+		ProviderID: config.ProviderID,
+		DAG:        dag,
+		CAR:        car,
+		PieceCID:   pieceCID,
+		Faults:     config.Faults,
+		addrs:      h.Addrs(),
+		cancel:     cancel,
+		closers:    []func() error{h.Close},
+	}
+
+	err = sp.start(ctx, config)
+	if err != nil {
+		_ = sp.Close()
+		return nil, err
+	}
+	return sp, nil
+}
+
+func (s *SP) start(ctx context.Context, config Config) error {
+	served, err := s.Faults.served(s.DAG)
+	if err != nil {
+		return err
+	}
+	bstore := blockstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	err = bstore.PutMany(ctx, served)
+	if err != nil {
+		return errors.Wrap(err, "failed to store DAG")
+	}
+
+	if s.Faults.WrongMultiaddrs {
+		addr, err := closedAddr()
+		if err != nil {
+			return err
+		}
+		s.addrs = []multiaddr.Multiaddr{addr}
+	}
+
+	var protocols []model.Protocol
+	if !config.DisableBitswap && !s.Faults.refuses(model.Bitswap) {
+		network := bsnet.NewFromIpfsHost(s.Host, routinghelpers.Null{})
+		server := bsserver.New(ctx, network, bstore)
+		network.Start(server)
+		s.closers = append(s.closers, func() error {
+			network.Stop()
+			return server.Close()
+		})
+	}
+	if !config.DisableBitswap {
+		protocols = append(protocols, model.Protocol{Name: string(model.Bitswap), Addresses: s.p2pAddrs()})
+	}
+
+	if !config.DisableGraphSync && !s.Faults.refuses(model.Libp2p) {
+		err = s.startGraphSync(ctx, bstore)
+		if err != nil {
+			return err
+		}
+	}
+	if !config.DisableGraphSync {
+		protocols = append(protocols, model.Protocol{Name: string(model.Libp2p), Addresses: s.p2pAddrs()})
+	}
+
+	if !config.DisableHTTP {
+		server := httptest.NewServer(s.httpHandler())
+		s.closers = append(s.closers, func() error {
+			server.Close()
+			return nil
+		})
+		if s.Faults.refuses(model.HTTP) {
+			server.Close()
+		}
+		s.HTTPURL = server.URL
+		serverURL, err := url.Parse(server.URL)
+		if err != nil {
+			return errors.Wrap(err, "failed to parse HTTP server URL")
+		}
+		addr, err := multiaddr.NewMultiaddr(fmt.Sprintf("/ip4/%s/tcp/%s/http", serverURL.Hostname(), serverURL.Port()))
+		if err != nil {
+			return errors.Wrap(err, "failed to build HTTP multiaddr")
+		}
+		protocols = append(protocols, model.Protocol{Name: string(model.HTTP), Addresses: []abi.Multiaddrs{addr.Bytes()}})
+	}
+
+	s.QueryResponse = model.QueryResponse{Protocols: protocols}
+	if config.QueryResponse != nil {
+		s.QueryResponse = *config.QueryResponse
+	}
+	if !config.DisableTransports {
+		s.Host.SetStreamHandler(RetrievalProtocolName, s.handleTransports)
+	}
+	return nil
+}
+
+func (s *SP) startGraphSync(ctx context.Context, bstore blockstore.Blockstore) error {
+	graphsync := gsimpl.New(ctx, gsnet.NewFromLibp2pHost(s.Host), storeutil.LinkSystemForBlockstore(bstore))
+	transport := gstransport.NewTransport(s.Host.ID(), graphsync)
+	// The data transfer state has its own datastore, it would otherwise try to decode the blocks
+	dataTransfer, err := dtimpl.NewDataTransfer(dssync.MutexWrap(datastore.NewMapDatastore()),
+		dtnet.NewFromLibp2pHost(s.Host, dtnet.RetryParameters(0, 0, 0, 0)), transport)
+	if err != nil {
+		return errors.Wrap(err, "failed to create data transfer")
+	}
+
+	validator := dealValidator{dag: s.DAG, reject: s.Faults.RejectDeals}
+	err = dataTransfer.RegisterVoucherType(retrievaltypes.DealProposalType, validator)
+	if err != nil {
+		return errors.Wrap(err, "failed to register deal proposal")
+	}
+
+	ready := make(chan error, 1)
+	dataTransfer.OnReady(func(err error) {
+		ready <- err
+	})
+	err = dataTransfer.Start(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to start data transfer")
+	}
+	s.closers = append(s.closers, func() error {
+		return dataTransfer.Stop(context.Background())
+	})
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-ready:
+		return errors.Wrap(err, "data transfer failed to get ready")
+	}
+}
+
+func (s *SP) handleTransports(stream network.Stream) {
+	if s.Faults.ResetStreams {
+		_ = stream.Reset()
+		return
+	}
+
+	//nolint:errcheck
+	defer stream.Close()
+	_ = stream.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_ = cborutil.WriteCborRPC(stream, &s.QueryResponse)
+}
+
+// httpHandler serves the CAR at /piece/<piece CID> and the blocks of the DAG at /ipfs/<CID>, as a CAR of the DAG
+// below the CID or as a raw block with ?format=raw.
+func (s *SP) httpHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/piece/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.TrimPrefix(r.URL.Path, "/piece/") != s.PieceCID.String() {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/piece")
+		if s.Faults.StallAfter > 0 {
+			stall(w, r, s.CAR, s.Faults.StallAfter)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(s.CAR))
+	})
+	mux.HandleFunc("/ipfs/", func(w http.ResponseWriter, r *http.Request) {
+		c, err := cid.Decode(strings.TrimPrefix(r.URL.Path, "/ipfs/"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		blk, ok := s.DAG.Block(c)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Query().Get("format") == "raw" || r.Header.Get("Accept") == "application/vnd.ipld.raw" {
+			w.Header().Set("Content-Type", "application/vnd.ipld.raw")
+			_, _ = w.Write(blk.RawData())
+			return
+		}
+		car, err := s.DAG.SubCAR(c)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.ipld.car")
+		_, _ = w.Write(car)
+	})
+	if s.Faults.HTTPStatus == 0 {
+		return mux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, http.StatusText(s.Faults.HTTPStatus), s.Faults.HTTPStatus)
+	})
+}
+
+// stall writes the first n bytes of content and waits for the client to give up.
+func stall(w http.ResponseWriter, r *http.Request, content []byte, n int64) {
+	if n > int64(len(content)) {
+		n = int64(len(content))
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	_, _ = w.Write(content[:n])
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	<-r.Context().Done()
+}
+
+// p2pAddrs returns the addresses of the provider, ending with its peer ID.
+func (s *SP) p2pAddrs() []abi.Multiaddrs {
+	p2p := multiaddr.StringCast("/p2p/" + s.Host.ID().String())
+	addrs := make([]abi.Multiaddrs, 0, len(s.addrs))
+	for _, addr := range s.addrs {
+		addrs = append(addrs, addr.Encapsulate(p2p).Bytes())
+	}
+	return addrs
+}
+
+func (s *SP) AddrInfo() peer.AddrInfo {
+	return peer.AddrInfo{ID: s.Host.ID(), Addrs: s.addrs}
+}
+
+// Provider returns the provider of the tasks retrieving from the fake storage provider.
+func (s *SP) Provider() task.Provider {
+	multiaddrs := make([]string, 0, len(s.addrs))
+	for _, addr := range s.addrs {
+		multiaddrs = append(multiaddrs, addr.String())
+	}
+	return task.Provider{
+		ID:         s.ProviderID,
+		PeerID:     s.Host.ID().String(),
+		Multiaddrs: multiaddrs,
+	}
+}
+
+// Close stops all the servers and the host.
+func (s *SP) Close() error {
+	s.cancel()
+	var err error
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		if closeErr := s.closers[i](); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// dealValidator accepts the retrieval of any CID of the DAG for free, unless it rejects every deal with a message.
+type dealValidator struct {
+	dag    DAG
+	reject string
+}
+
+func (v dealValidator) ValidatePush(
+	datatransfer.ChannelID, peer.ID, datamodel.Node, cid.Cid, datamodel.Node) (datatransfer.ValidationResult, error) {
+	return datatransfer.ValidationResult{Accepted: false}, errors.New("push is not supported")
+}
+
+func (v dealValidator) ValidatePull(
+	_ datatransfer.ChannelID,
+	_ peer.ID,
+	voucher datamodel.Node,
+	baseCid cid.Cid,
+	_ datamodel.Node) (datatransfer.ValidationResult, error) {
+	proposal, err := retrievaltypes.DealProposalFromNode(voucher)
+	if err != nil {
+		return datatransfer.ValidationResult{Accepted: false}, nil
+	}
+
+	respond := func(status retrievaltypes.DealStatus, message string) datatransfer.ValidationResult {
+		response := retrievaltypes.DealResponse{
+			Status:      status,
+			ID:          proposal.ID,
+			PaymentOwed: big.Zero(),
+			Message:     message,
+		}
+		voucher := response.AsVoucher()
+		return datatransfer.ValidationResult{
+			Accepted:      status == retrievaltypes.DealStatusAccepted,
+			VoucherResult: &voucher,
+		}
+	}
+
+	switch {
+	case v.reject != "":
+		return respond(retrievaltypes.DealStatusRejected, v.reject), nil
+	case !proposal.PayloadCID.Equals(baseCid):
+		return respond(retrievaltypes.DealStatusRejected, "payload CID does not match the base CID"), nil
+	}
+	if _, ok := v.dag.Block(baseCid); !ok {
+		return respond(retrievaltypes.DealStatusRejected, "there is no unsealed piece containing payload cid"), nil
+	}
+	return respond(retrievaltypes.DealStatusAccepted, ""), nil
+}
+
+func (v dealValidator) ValidateRestart(
+	datatransfer.ChannelID, datatransfer.ChannelState) (datatransfer.ValidationResult, error) {
+	return datatransfer.ValidationResult{Accepted: false}, errors.New("restart is not supported")
+}
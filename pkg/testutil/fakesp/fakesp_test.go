@@ -0,0 +1,69 @@
+package fakesp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"testing"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/net"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateDAG(t *testing.T) {
+	dag, err := GenerateDAG(rand.New(rand.NewSource(1)), 10, 100, 3)
+	assert.NoError(t, err)
+	// 10 leaves, 4 nodes linking them, 2 nodes linking those and the root
+	assert.Len(t, dag.Blocks, 17)
+	assert.Equal(t, dag.Root, dag.Blocks[0].Cid())
+
+	links, err := net.BlockLinks(dag.Blocks[0])
+	assert.NoError(t, err)
+	assert.Len(t, links, 2)
+
+	again, err := GenerateDAG(rand.New(rand.NewSource(1)), 10, 100, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, dag.Root, again.Root)
+
+	car, err := dag.CAR()
+	assert.NoError(t, err)
+	roots, err := net.CARRoots(bytes.NewReader(car))
+	assert.NoError(t, err)
+	assert.Equal(t, []cid.Cid{dag.Root}, roots)
+
+	pieceCID, err := PieceCID(car)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(cid.FilCommitmentUnsealed), pieceCID.Prefix().Codec)
+}
+
+func TestHTTP(t *testing.T) {
+	ctx := context.Background()
+	sp, err := New(ctx, Config{DisableBitswap: true, DisableGraphSync: true})
+	assert.NoError(t, err)
+	defer sp.Close()
+
+	assert.Len(t, sp.QueryResponse.Protocols, 1)
+
+	get := func(path string) (int, []byte) {
+		resp, err := http.Get(sp.HTTPURL + path)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		return resp.StatusCode, body
+	}
+
+	status, body := get("/piece/" + sp.PieceCID.String())
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, sp.CAR, body)
+
+	status, body = get("/ipfs/" + sp.DAG.Root.String() + "?format=raw")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, sp.DAG.Blocks[0].RawData(), body)
+
+	status, _ = get("/piece/" + sp.DAG.Root.String())
+	assert.Equal(t, http.StatusNotFound, status)
+}
@@ -0,0 +1,74 @@
+package fakesp
+
+import (
+	"fmt"
+	stdnet "net"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/model"
+	"github.com/ipfs/go-libipfs/blocks"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/pkg/errors"
+	"golang.org/x/exp/slices"
+)
+
+// Faults make a fake storage provider misbehave on purpose, to reproduce the failures that the workers classify.
+// The zero value injects no fault.
+type Faults struct {
+	// RejectDeals rejects the GraphSync retrievals with this message, e.g. one of the boost rejection messages
+	RejectDeals string
+	// DontHave answers DONT_HAVE to the Bitswap wants and serves no block over GraphSync
+	DontHave bool
+	// StallAfter stops the HTTP responses after that many bytes until the client gives up, if positive
+	StallAfter int64
+	// ResetStreams resets the streams of the retrieval transports protocol
+	ResetStreams bool
+	// HTTPStatus is returned by the HTTP server instead of the content, e.g. 404, 429 or 500
+	HTTPStatus int
+	// RefuseTransports are advertised but their server is not running
+	RefuseTransports []model.ProtocolName
+	// WrongMultiaddrs gives the provider addresses that nothing listens on
+	WrongMultiaddrs bool
+	// CorruptBlocks serves blocks whose data does not match their CID
+	CorruptBlocks bool
+}
+
+func (f Faults) refuses(name model.ProtocolName) bool {
+	return slices.Contains(f.RefuseTransports, name)
+}
+
+// served returns the blocks served by Bitswap and GraphSync.
+func (f Faults) served(dag DAG) ([]blocks.Block, error) {
+	if f.DontHave {
+		return nil, nil
+	}
+	if !f.CorruptBlocks {
+		return dag.Blocks, nil
+	}
+
+	corrupted := make([]blocks.Block, 0, len(dag.Blocks))
+	for _, blk := range dag.Blocks {
+		data := append([]byte{}, blk.RawData()...)
+		data[0] ^= 0xff
+		corrupt, err := blocks.NewBlockWithCid(data, blk.Cid())
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to corrupt block")
+		}
+		corrupted = append(corrupted, corrupt)
+	}
+	return corrupted, nil
+}
+
+// closedAddr returns a loopback TCP address that nothing listens on.
+func closedAddr() (multiaddr.Multiaddr, error) {
+	listener, err := stdnet.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to listen")
+	}
+	port := listener.Addr().(*stdnet.TCPAddr).Port
+	err = listener.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to close listener")
+	}
+	//nolint:wrapcheck
+	return multiaddr.NewMultiaddr(fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", port))
+}
@@ -0,0 +1,51 @@
+package bitswap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/model"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/testutil/fakesp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFaults(t *testing.T) {
+	tests := []struct {
+		name   string
+		config fakesp.Config
+		code   task.ErrorCode
+	}{
+		{"dont have", fakesp.Config{Faults: fakesp.Faults{DontHave: true}}, task.NotFound},
+		{"reset streams", fakesp.Config{Faults: fakesp.Faults{ResetStreams: true}}, task.RetrievalFailure},
+		{"not boost", fakesp.Config{DisableTransports: true}, task.ProtocolNotSupported},
+		{"not advertised", fakesp.Config{DisableBitswap: true}, task.ProtocolNotSupported},
+		{"refused", fakesp.Config{Faults: fakesp.Faults{RefuseTransports: []model.ProtocolName{model.Bitswap}}},
+			task.Timeout},
+		{"wrong multiaddrs", fakesp.Config{Faults: fakesp.Faults{WrongMultiaddrs: true}}, task.CannotConnect},
+		{"corrupt blocks", fakesp.Config{Faults: fakesp.Faults{CorruptBlocks: true}}, task.Timeout},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			sp, err := fakesp.New(context.Background(), test.config)
+			assert.NoError(t, err)
+			defer sp.Close()
+
+			result, err := task.ResolveWorkResult(Worker{}.DoWork(task.Task{
+				Module:   task.Bitswap,
+				Provider: sp.Provider(),
+				Content:  task.Content{CID: sp.DAG.Root.String()},
+				Timeout:  2 * time.Second,
+			}))
+			assert.NoError(t, err)
+			if assert.NotNil(t, result) {
+				assert.False(t, result.Success)
+				assert.Equal(t, test.code, result.ErrorCode, result.ErrorMessage)
+			}
+		})
+	}
+}
@@ -2,6 +2,10 @@ package bitswap
 
 import (
 	"context"
+	"math/rand"
+	"strconv"
+	"time"
+
 	"github.com/data-preservation-programs/RetrievalBot/pkg/convert"
 	"github.com/data-preservation-programs/RetrievalBot/pkg/model"
 	"github.com/data-preservation-programs/RetrievalBot/pkg/net"
@@ -83,9 +87,44 @@ func (e Worker) DoWork(tsk task.Task) (*task.RetrievalResult, error) {
 		return task.NewErrorRetrievalResult(task.ProtocolNotSupported, errors.New("No bitswap multiaddr available")), nil
 	}
 
+	layers, perLayer, rng, err := layerSampling(tsk.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
 	//nolint:wrapcheck
-	return client.Retrieve(ctx, peer.AddrInfo{
+	return client.RetrieveLayers(ctx, peer.AddrInfo{
 		ID:    peerID,
 		Addrs: addrs,
-	}, contentCID)
+	}, contentCID, layers, perLayer, rng)
+}
+
+// layerSampling reads the number of layers below the root to retrieve and the number of blocks to draw per layer
+// from the layers and cids_per_layer metadata. The blocks are drawn from sampling_seed if set.
+func layerSampling(metadata map[string]string) (int, int, *rand.Rand, error) {
+	layers, perLayer := 0, 1
+	var err error
+	if value, ok := metadata["layers"]; ok {
+		layers, err = strconv.Atoi(value)
+		if err != nil {
+			return 0, 0, nil, errors.Wrap(err, "failed to convert layers to int")
+		}
+	}
+	if value, ok := metadata["cids_per_layer"]; ok {
+		perLayer, err = strconv.Atoi(value)
+		if err != nil {
+			return 0, 0, nil, errors.Wrap(err, "failed to convert cids_per_layer to int")
+		}
+	}
+
+	seed := time.Now().UnixNano()
+	if value, ok := metadata["sampling_seed"]; ok {
+		seed, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, 0, nil, errors.Wrap(err, "failed to convert sampling_seed to int")
+		}
+	}
+
+	//nolint:gosec
+	return layers, perLayer, rand.New(rand.NewSource(seed)), nil
 }
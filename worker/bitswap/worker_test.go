@@ -0,0 +1,51 @@
+package bitswap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/testutil/fakesp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorker(t *testing.T) {
+	sp, err := fakesp.New(context.Background(), fakesp.Config{})
+	assert.NoError(t, err)
+	defer sp.Close()
+
+	tsk := task.Task{
+		Module:   task.Bitswap,
+		Provider: sp.Provider(),
+		Content:  task.Content{CID: sp.DAG.Root.String()},
+		Timeout:  10 * time.Second,
+	}
+	result, err := Worker{}.DoWork(tsk)
+	assert.NoError(t, err)
+	assert.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, int64(len(sp.DAG.Blocks[0].RawData())), result.Downloaded)
+
+	// The root, then one node per layer down to a leaf
+	tsk.Metadata = map[string]string{"layers": "2", "cids_per_layer": "1", "sampling_seed": "1"}
+	result, err = Worker{}.DoWork(tsk)
+	assert.NoError(t, err)
+	assert.True(t, result.Success, result.ErrorMessage)
+	assert.Greater(t, result.Downloaded, int64(1024))
+}
+
+func TestWorkerNotBoost(t *testing.T) {
+	sp, err := fakesp.New(context.Background(), fakesp.Config{DisableTransports: true})
+	assert.NoError(t, err)
+	defer sp.Close()
+
+	result, err := Worker{}.DoWork(task.Task{
+		Module:   task.Bitswap,
+		Provider: sp.Provider(),
+		Content:  task.Content{CID: sp.DAG.Root.String()},
+		Timeout:  10 * time.Second,
+	})
+	assert.NoError(t, err)
+	assert.False(t, result.Success)
+	assert.Equal(t, task.ProtocolNotSupported, result.ErrorCode)
+}
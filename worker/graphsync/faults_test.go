@@ -0,0 +1,60 @@
+package graphsync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/model"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/testutil/fakesp"
+	"github.com/stretchr/testify/assert"
+)
+
+func reject(message string) fakesp.Config {
+	return fakesp.Config{Faults: fakesp.Faults{RejectDeals: message}}
+}
+
+func TestFaults(t *testing.T) {
+	tests := []struct {
+		name   string
+		config fakesp.Config
+		code   task.ErrorCode
+	}{
+		{"price too low", reject("Price per byte too low"), task.DealRejectedPricePerByteTooLow},
+		{"unseal price too low", reject("Unseal price too small"), task.DealRejectedUnsealPriceTooLow},
+		{"throttled", reject("Too many retrieval deals received"), task.Throttled},
+		{"no access", reject("Access Control"), task.NoAccess},
+		{"under maintenance", reject("Under maintenance, retry later"), task.UnderMaintenance},
+		{"not online", reject("miner is not accepting online retrieval deals"), task.NotOnline},
+		{"no unsealed piece", reject("there is no unsealed piece containing payload cid"), task.NotFound},
+		{"deal state missing", reject("failed to fetch storage deal state"), task.DealStateMissing},
+		{"dont have", fakesp.Config{Faults: fakesp.Faults{DontHave: true}}, task.NotFound},
+		{"refused", fakesp.Config{Faults: fakesp.Faults{RefuseTransports: []model.ProtocolName{model.Libp2p}}},
+			task.Timeout},
+		{"wrong multiaddrs", fakesp.Config{Faults: fakesp.Faults{WrongMultiaddrs: true}}, task.CannotConnect},
+		{"corrupt blocks", fakesp.Config{Faults: fakesp.Faults{CorruptBlocks: true}}, task.RetrievalFailure},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			sp, err := fakesp.New(context.Background(), test.config)
+			assert.NoError(t, err)
+			defer sp.Close()
+
+			result, err := task.ResolveWorkResult(Worker{}.DoWork(task.Task{
+				Module:   task.GraphSync,
+				Provider: sp.Provider(),
+				Content:  task.Content{CID: sp.DAG.Root.String()},
+				Timeout:  2 * time.Second,
+			}))
+			assert.NoError(t, err)
+			if assert.NotNil(t, result) {
+				assert.False(t, result.Success)
+				assert.Equal(t, test.code, result.ErrorCode, result.ErrorMessage)
+			}
+		})
+	}
+}
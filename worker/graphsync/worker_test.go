@@ -0,0 +1,42 @@
+package graphsync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/testutil/fakesp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorker(t *testing.T) {
+	sp, err := fakesp.New(context.Background(), fakesp.Config{})
+	assert.NoError(t, err)
+	defer sp.Close()
+
+	result, err := Worker{}.DoWork(task.Task{
+		Module:   task.GraphSync,
+		Provider: sp.Provider(),
+		Content:  task.Content{CID: sp.DAG.Root.String()},
+		Timeout:  10 * time.Second,
+	})
+	assert.NoError(t, err)
+	assert.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, int64(len(sp.DAG.Blocks[0].RawData())), result.Downloaded)
+}
+
+func TestWorkerUnknownCID(t *testing.T) {
+	sp, err := fakesp.New(context.Background(), fakesp.Config{})
+	assert.NoError(t, err)
+	defer sp.Close()
+
+	result, err := Worker{}.DoWork(task.Task{
+		Module:   task.GraphSync,
+		Provider: sp.Provider(),
+		Content:  task.Content{CID: sp.PieceCID.String()},
+		Timeout:  10 * time.Second,
+	})
+	assert.NoError(t, err)
+	assert.False(t, result.Success)
+}
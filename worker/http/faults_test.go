@@ -0,0 +1,56 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/model"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/testutil/fakesp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFaults(t *testing.T) {
+	tests := []struct {
+		name   string
+		config fakesp.Config
+		code   task.ErrorCode
+	}{
+		{"not found", fakesp.Config{Faults: fakesp.Faults{HTTPStatus: http.StatusNotFound}}, task.NotFound},
+		{"server error", fakesp.Config{Faults: fakesp.Faults{HTTPStatus: http.StatusInternalServerError}},
+			task.RetrievalFailure},
+		{"too many requests", fakesp.Config{Faults: fakesp.Faults{HTTPStatus: http.StatusTooManyRequests}},
+			task.Throttled},
+		{"stall", fakesp.Config{Faults: fakesp.Faults{StallAfter: 100}}, task.Timeout},
+		{"reset streams", fakesp.Config{Faults: fakesp.Faults{ResetStreams: true}}, task.RetrievalFailure},
+		{"not boost", fakesp.Config{DisableTransports: true}, task.ProtocolNotSupported},
+		{"not advertised", fakesp.Config{DisableHTTP: true}, task.ProtocolNotSupported},
+		{"refused", fakesp.Config{Faults: fakesp.Faults{RefuseTransports: []model.ProtocolName{model.HTTP}}},
+			task.CannotConnect},
+		{"wrong multiaddrs", fakesp.Config{Faults: fakesp.Faults{WrongMultiaddrs: true}}, task.CannotConnect},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			sp, err := fakesp.New(context.Background(), test.config)
+			assert.NoError(t, err)
+			defer sp.Close()
+
+			result, err := task.ResolveWorkResult(Worker{}.DoWork(task.Task{
+				Module:   task.HTTP,
+				Provider: sp.Provider(),
+				Content:  task.Content{CID: sp.PieceCID.String()},
+				Timeout:  2 * time.Second,
+			}))
+			assert.NoError(t, err)
+			if assert.NotNil(t, result) {
+				assert.False(t, result.Success)
+				assert.Equal(t, test.code, result.ErrorCode, result.ErrorMessage)
+			}
+		})
+	}
+}
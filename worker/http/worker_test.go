@@ -0,0 +1,45 @@
+package http
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/testutil/fakesp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorker(t *testing.T) {
+	sp, err := fakesp.New(context.Background(), fakesp.Config{})
+	assert.NoError(t, err)
+	defer sp.Close()
+
+	result, err := Worker{}.DoWork(task.Task{
+		Module:   task.HTTP,
+		Provider: sp.Provider(),
+		Content:  task.Content{CID: sp.PieceCID.String()},
+		Metadata: map[string]string{"retrieve_size": "1024"},
+		Timeout:  10 * time.Second,
+	})
+	assert.NoError(t, err)
+	assert.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, int64(1024), result.Downloaded)
+	assert.Equal(t, []string{sp.DAG.Root.String()}, result.CARRoots)
+}
+
+func TestWorkerNoHTTP(t *testing.T) {
+	sp, err := fakesp.New(context.Background(), fakesp.Config{DisableHTTP: true})
+	assert.NoError(t, err)
+	defer sp.Close()
+
+	result, err := Worker{}.DoWork(task.Task{
+		Module:   task.HTTP,
+		Provider: sp.Provider(),
+		Content:  task.Content{CID: sp.PieceCID.String()},
+		Timeout:  10 * time.Second,
+	})
+	assert.NoError(t, err)
+	assert.False(t, result.Success)
+	assert.Equal(t, task.ProtocolNotSupported, result.ErrorCode)
+}
@@ -8,7 +8,11 @@ import (
 )
 
 func main() {
-	worker := stub.Worker{}
+	worker, err := stub.NewWorkerFromEnv()
+	if err != nil {
+		panic(err)
+	}
+
 	process, err := task.NewTaskWorkerProcess(context.Background(), task.Stub, worker)
 	if err != nil {
 		panic(err)
@@ -0,0 +1,192 @@
+package stub
+
+import (
+	"math"
+	"math/rand"
+	"os"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DistributionFixed     = "fixed"
+	DistributionNormal    = "normal"
+	DistributionLognormal = "lognormal"
+)
+
+// Config of the stub worker. JSON files are accepted as well, as JSON is valid YAML.
+type Config struct {
+	// Seed of the outcomes. The outcome of a task only depends on the seed and the task.
+	Seed    int64    `yaml:"seed"`
+	Default Behavior `yaml:"default"`
+	// Rules override the default behavior for the tasks of a provider and/or module. The first match applies.
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule applies to the tasks of the provider and module, an empty one matching any.
+// The fields of its behavior that are not set are taken from the default behavior.
+type Rule struct {
+	Provider string          `yaml:"provider"`
+	Module   task.ModuleName `yaml:"module"`
+	Behavior `yaml:",inline"`
+}
+
+// Behavior describes the outcomes of the tasks.
+type Behavior struct {
+	// Share of the tasks that succeed, 1 if not set
+	SuccessRate *float64 `yaml:"success_rate"`
+	// Time to first byte, in seconds
+	TTFB Distribution `yaml:"ttfb"`
+	// Download speed, in bytes per second
+	Speed Distribution `yaml:"speed"`
+	// Bytes downloaded by a successful task
+	Size Distribution `yaml:"size"`
+	// Errors of the failed tasks, drawn by weight. retrieval_failure if not set.
+	Errors []WeightedError `yaml:"errors"`
+	// Time to wait before returning, in seconds, e.g. longer than the task timeout to exercise the poll timeout
+	Delay Distribution `yaml:"delay"`
+	// Share of the tasks that make the worker panic, 0 if not set
+	PanicRate *float64 `yaml:"panic_rate"`
+	// Share of the tasks that make the worker exit, 0 if not set
+	CrashRate *float64 `yaml:"crash_rate"`
+}
+
+type WeightedError struct {
+	Code    task.ErrorCode `yaml:"code"`
+	Message string         `yaml:"message"`
+	Weight  float64        `yaml:"weight"`
+}
+
+// Distribution of a value: a fixed value, a normal distribution of mean and stddev, or a lognormal distribution
+// whose logarithm has mean mu and standard deviation sigma. Negative draws are returned as 0.
+type Distribution struct {
+	Type   string  `yaml:"type"`
+	Value  float64 `yaml:"value"`
+	Mean   float64 `yaml:"mean"`
+	StdDev float64 `yaml:"stddev"`
+	Mu     float64 `yaml:"mu"`
+	Sigma  float64 `yaml:"sigma"`
+}
+
+//nolint:gochecknoglobals
+var defaultBehavior = Behavior{
+	TTFB:  Distribution{Type: DistributionFixed, Value: 0.1},
+	Speed: Distribution{Type: DistributionFixed, Value: 10 * 1024 * 1024},
+	Size:  Distribution{Type: DistributionFixed, Value: 1024 * 1024},
+}
+
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, errors.Wrapf(err, "failed to read %s", path)
+	}
+
+	return ParseConfig(data)
+}
+
+func ParseConfig(data []byte) (Config, error) {
+	var config Config
+	err := yaml.Unmarshal(data, &config)
+	if err != nil {
+		return Config{}, errors.Wrap(err, "failed to parse stub worker config")
+	}
+
+	config.Default = config.Default.inherit(defaultBehavior)
+	for i := range config.Rules {
+		config.Rules[i].Behavior = config.Rules[i].Behavior.inherit(config.Default)
+	}
+
+	for _, behavior := range append([]Behavior{config.Default}, config.behaviors()...) {
+		if err := behavior.Validate(); err != nil {
+			return Config{}, err
+		}
+	}
+	return config, nil
+}
+
+func (c Config) behaviors() []Behavior {
+	behaviors := make([]Behavior, 0, len(c.Rules))
+	for _, rule := range c.Rules {
+		behaviors = append(behaviors, rule.Behavior)
+	}
+	return behaviors
+}
+
+// behaviorOf returns the behavior of the first rule matching the task, or the default one.
+func (c Config) behaviorOf(tsk task.Task) Behavior {
+	for _, rule := range c.Rules {
+		if (rule.Provider == "" || rule.Provider == tsk.Provider.ID) && (rule.Module == "" || rule.Module == tsk.Module) {
+			return rule.Behavior
+		}
+	}
+	return c.Default
+}
+
+// inherit returns the behavior with its unset fields taken from parent.
+func (b Behavior) inherit(parent Behavior) Behavior {
+	if b.SuccessRate == nil {
+		b.SuccessRate = parent.SuccessRate
+	}
+	for _, d := range []struct{ child, parent *Distribution }{
+		{&b.TTFB, &parent.TTFB}, {&b.Speed, &parent.Speed}, {&b.Size, &parent.Size}, {&b.Delay, &parent.Delay},
+	} {
+		if d.child.Type == "" {
+			*d.child = *d.parent
+		}
+	}
+	if b.Errors == nil {
+		b.Errors = parent.Errors
+	}
+	if b.PanicRate == nil {
+		b.PanicRate = parent.PanicRate
+	}
+	if b.CrashRate == nil {
+		b.CrashRate = parent.CrashRate
+	}
+	return b
+}
+
+func (b Behavior) Validate() error {
+	for _, rate := range []*float64{b.SuccessRate, b.PanicRate, b.CrashRate} {
+		if rate != nil && (*rate < 0 || *rate > 1) {
+			return errors.Errorf("rate %f must be between 0 and 1", *rate)
+		}
+	}
+	for _, d := range []Distribution{b.TTFB, b.Speed, b.Size, b.Delay} {
+		switch d.Type {
+		case "", DistributionFixed, DistributionNormal, DistributionLognormal:
+		default:
+			return errors.Errorf("unknown distribution %s", d.Type)
+		}
+	}
+	for _, e := range b.Errors {
+		if e.Weight < 0 {
+			return errors.Errorf("weight of error %s must not be negative", e.Code)
+		}
+	}
+	return nil
+}
+
+// rateOr returns the rate, or fallback if it is not set.
+func rateOr(rate *float64, fallback float64) float64 {
+	if rate == nil {
+		return fallback
+	}
+	return *rate
+}
+
+// Draw returns a value of the distribution, 0 if it is not set.
+func (d Distribution) Draw(rng *rand.Rand) float64 {
+	var value float64
+	switch d.Type {
+	case DistributionFixed:
+		value = d.Value
+	case DistributionNormal:
+		value = d.Mean + d.StdDev*rng.NormFloat64()
+	case DistributionLognormal:
+		value = math.Exp(d.Mu + d.Sigma*rng.NormFloat64())
+	}
+	return math.Max(value, 0)
+}
@@ -1,17 +1,121 @@
 package stub
 
 import (
-	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"hash/fnv"
 	"math/rand"
+	"os"
 	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/env"
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/pkg/errors"
 )
 
-type Worker struct{}
+var logger = logging.Logger("stub_worker")
+
+// Worker pretends to retrieve content, with outcomes drawn from its config.
+type Worker struct {
+	config Config
+	sleep  func(time.Duration)
+	exit   func(int)
+}
+
+func NewWorker(config Config) Worker {
+	return Worker{config: config, sleep: time.Sleep, exit: os.Exit}
+}
+
+// NewWorkerFromEnv reads the config from STUB_WORKER_CONFIG if set. STUB_WORKER_SEED overrides its seed.
+func NewWorkerFromEnv() (Worker, error) {
+	config, err := ParseConfig(nil)
+	if err != nil {
+		return Worker{}, err
+	}
+	if path := env.GetString(env.StubWorkerConfig, ""); path != "" {
+		config, err = LoadConfig(path)
+		if err != nil {
+			return Worker{}, err
+		}
+	}
+
+	config.Seed = int64(env.GetInt(env.StubWorkerSeed, int(config.Seed)))
+	return NewWorker(config), nil
+}
+
+func (e Worker) DoWork(tsk task.Task) (*task.RetrievalResult, error) {
+	rng := e.rngOf(tsk)
+	behavior := e.config.behaviorOf(tsk)
+
+	// Draw every value whatever the outcome, so that changing one rate does not shift the other draws
+	crash, panics, success := rng.Float64(), rng.Float64(), rng.Float64()
+	delay := seconds(behavior.Delay.Draw(rng))
+	ttfb := seconds(behavior.TTFB.Draw(rng))
+	speed := behavior.Speed.Draw(rng)
+	size := int64(behavior.Size.Draw(rng))
+	errorDraw := rng.Float64()
+
+	if delay > 0 {
+		e.sleep(delay)
+	}
+	if crash < rateOr(behavior.CrashRate, 0) {
+		logger.With("task", tsk).Error("Injected crash")
+		e.exit(1)
+	}
+	if panics < rateOr(behavior.PanicRate, 0) {
+		panic("injected panic")
+	}
+
+	if success >= rateOr(behavior.SuccessRate, 1) {
+		code, message := pickError(behavior.Errors, errorDraw)
+		return task.NewErrorRetrievalResult(code, errors.New(message)), nil
+	}
+
+	duration := ttfb
+	if speed > 0 {
+		duration += seconds(float64(size) / speed)
+	}
+	if duration == 0 {
+		duration = time.Nanosecond
+	}
+	return task.NewSuccessfulRetrievalResult(ttfb, size, duration), nil
+}
+
+// rngOf seeds the draws of a task from the seed and the task, so that a run can be reproduced whatever the order
+// of the tasks.
+func (e Worker) rngOf(tsk task.Task) *rand.Rand {
+	hash := fnv.New64a()
+	for _, s := range []string{tsk.Provider.ID, string(tsk.Module), tsk.Content.CID, tsk.CreatedAt.String()} {
+		_, _ = hash.Write([]byte(s))
+		_, _ = hash.Write([]byte{0})
+	}
+	//nolint:gosec
+	return rand.New(rand.NewSource(e.config.Seed ^ int64(hash.Sum64())))
+}
+
+func pickError(weighted []WeightedError, draw float64) (task.ErrorCode, string) {
+	var total float64
+	for _, e := range weighted {
+		total += e.Weight
+	}
+	if total == 0 {
+		return task.RetrievalFailure, "injected failure"
+	}
+
+	draw *= total
+	picked := weighted[len(weighted)-1]
+	for _, e := range weighted {
+		if draw < e.Weight {
+			picked = e
+			break
+		}
+		draw -= e.Weight
+	}
+	if picked.Message == "" {
+		return picked.Code, "injected " + string(picked.Code)
+	}
+	return picked.Code, picked.Message
+}
 
-func (e Worker) DoWork(_ task.Task) (*task.RetrievalResult, error) {
-	//nolint: gosec
-	return task.NewSuccessfulRetrievalResult(
-		time.Duration(rand.Int31()),
-		int64(rand.Int31()),
-		time.Duration(rand.Int31())), nil
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
 }
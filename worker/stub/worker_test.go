@@ -0,0 +1,149 @@
+package stub
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/data-preservation-programs/RetrievalBot/pkg/task"
+	"github.com/stretchr/testify/assert"
+)
+
+const testConfig = `
+seed: 42
+default:
+  success_rate: 0.5
+  ttfb: {type: normal, mean: 0.2, stddev: 0.05}
+  speed: {type: lognormal, mu: 16, sigma: 1}
+  errors:
+    - {code: timeout, weight: 3}
+    - {code: cannot_connect, message: refused, weight: 1}
+rules:
+  - provider: f01000
+    module: http
+    success_rate: 0
+    errors: [{code: throttled, weight: 1}]
+  - provider: f01000
+    delay: {type: fixed, value: 30}
+  - module: bitswap
+    panic_rate: 1
+`
+
+func testTask(provider string, module task.ModuleName, i int) task.Task {
+	return task.Task{
+		Module:    module,
+		Provider:  task.Provider{ID: provider},
+		Content:   task.Content{CID: fmt.Sprintf("cid%d", i)},
+		CreatedAt: time.Unix(int64(i), 0),
+	}
+}
+
+func newTestWorker(t *testing.T, data string) (Worker, *[]time.Duration) {
+	config, err := ParseConfig([]byte(data))
+	assert.NoError(t, err)
+	var sleeps []time.Duration
+	worker := NewWorker(config)
+	worker.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+	worker.exit = func(int) { panic("exit") }
+	return worker, &sleeps
+}
+
+func TestReproducible(t *testing.T) {
+	worker, _ := newTestWorker(t, testConfig)
+	other, _ := newTestWorker(t, testConfig)
+	reseeded, _ := newTestWorker(t, testConfig)
+	reseeded.config.Seed = 43
+
+	differs := false
+	counts := map[task.ErrorCode]int{}
+	for i := 0; i < 1000; i++ {
+		result, err := worker.DoWork(testTask("f02000", task.GraphSync, i))
+		assert.NoError(t, err)
+		// Draws of other tasks in between must not change the outcome
+		_, err = other.DoWork(testTask("f02000", task.GraphSync, 999-i))
+		assert.NoError(t, err)
+		again, err := other.DoWork(testTask("f02000", task.GraphSync, i))
+		assert.NoError(t, err)
+		assert.Equal(t, result, again)
+
+		changed, err := reseeded.DoWork(testTask("f02000", task.GraphSync, i))
+		assert.NoError(t, err)
+		differs = differs || !assert.ObjectsAreEqual(changed, result)
+
+		counts[result.ErrorCode]++
+		if result.Success {
+			assert.Greater(t, result.TTFB, time.Duration(0))
+			assert.Equal(t, int64(1024*1024), result.Downloaded)
+			assert.Greater(t, result.Speed, 0.0)
+		}
+	}
+	assert.True(t, differs)
+	assert.InDelta(t, 500, counts[task.ErrorCodeNone], 60)
+	assert.InDelta(t, 375, counts[task.Timeout], 60)
+	assert.InDelta(t, 125, counts[task.CannotConnect], 40)
+}
+
+func TestRules(t *testing.T) {
+	worker, sleeps := newTestWorker(t, testConfig)
+
+	result, err := worker.DoWork(testTask("f01000", task.HTTP, 1))
+	assert.NoError(t, err)
+	assert.False(t, result.Success)
+	assert.Equal(t, task.Throttled, result.ErrorCode)
+	assert.Equal(t, "injected throttled", result.ErrorMessage)
+	assert.Empty(t, *sleeps)
+
+	_, err = worker.DoWork(testTask("f01000", task.GraphSync, 1))
+	assert.NoError(t, err)
+	assert.Equal(t, []time.Duration{30 * time.Second}, *sleeps)
+
+	assert.PanicsWithValue(t, "injected panic", func() {
+		_, _ = worker.DoWork(testTask("f02000", task.Bitswap, 1))
+	})
+}
+
+func TestCrash(t *testing.T) {
+	worker, _ := newTestWorker(t, "default: {crash_rate: 1}")
+	assert.PanicsWithValue(t, "exit", func() {
+		_, _ = worker.DoWork(testTask("f02000", task.HTTP, 1))
+	})
+}
+
+func TestRuleDisablesDefaultRates(t *testing.T) {
+	worker, _ := newTestWorker(t, `
+default: {panic_rate: 1, crash_rate: 1}
+rules:
+  - {provider: f01000, panic_rate: 0, crash_rate: 0}
+  - {provider: f02000, crash_rate: 0}
+`)
+	result, err := worker.DoWork(testTask("f01000", task.HTTP, 1))
+	assert.NoError(t, err)
+	assert.True(t, result.Success)
+
+	assert.PanicsWithValue(t, "injected panic", func() {
+		_, _ = worker.DoWork(testTask("f02000", task.HTTP, 1))
+	})
+	assert.PanicsWithValue(t, "exit", func() {
+		_, _ = worker.DoWork(testTask("f03000", task.HTTP, 1))
+	})
+}
+
+func TestDefaults(t *testing.T) {
+	worker, sleeps := newTestWorker(t, "")
+	result, err := worker.DoWork(testTask("f02000", task.HTTP, 1))
+	assert.NoError(t, err)
+	assert.True(t, result.Success)
+	assert.Equal(t, 100*time.Millisecond, result.TTFB)
+	assert.Equal(t, int64(1024*1024), result.Downloaded)
+	assert.Equal(t, 200*time.Millisecond, result.Duration)
+	assert.Empty(t, *sleeps)
+}
+
+func TestParseConfigInvalid(t *testing.T) {
+	_, err := ParseConfig([]byte("default: {success_rate: 2}"))
+	assert.Error(t, err)
+	_, err = ParseConfig([]byte("rules: [{ttfb: {type: uniform}}]"))
+	assert.Error(t, err)
+	_, err = ParseConfig([]byte("default: {errors: [{code: timeout, weight: -1}]}"))
+	assert.Error(t, err)
+}